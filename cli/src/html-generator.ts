@@ -288,6 +288,8 @@ ${fileListItems}
         </div>
       </div>
       
+      <div class="session-banner" id="sessionBanner" hidden></div>
+      
       <div class="breadcrumb-bar">${breadcrumb}</div>
       
       <div class="content" id="content">
@@ -351,6 +353,14 @@ ${fileListItems}
       opacity: 0.6;
     }
     
+    .session-banner {
+      padding: 10px 24px;
+      font-size: 12px;
+      color: #fcd34d;
+      background: rgba(252, 211, 77, 0.1);
+      border-bottom: 1px solid rgba(252, 211, 77, 0.2);
+    }
+    
     .breadcrumb-bar {
       padding: 12px 24px;
       font-size: 12px;
@@ -661,7 +671,8 @@ ${fileListItems}
     // Live session updates via WebSocket
     if (sessionId) {
       const wsProtocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-      const wsUrl = wsProtocol + '//' + window.location.host + '/viewer-ws/' + sessionId;
+      // Opened next to this page so the share's login cookies are sent with it
+      const wsUrl = wsProtocol + '//' + window.location.host + window.location.pathname.replace(/[^/]*$/, '') + '__ws__';
       let ws = null;
       let reconnectAttempts = 0;
       const maxReconnectAttempts = 5;
@@ -680,9 +691,23 @@ ${fileListItems}
               const count = data.count !== undefined ? data.count : data.viewerCount;
               document.getElementById('viewerCount').textContent = count + ' viewer' + (count !== 1 ? 's' : '');
             }
-            if (data.type === 'init' && data.expiresAt) {
+            if ((data.type === 'init' || data.type === 'expiry') && data.expiresAt) {
               startCountdown(data.expiresAt * 1000);
             }
+            if ((data.type === 'init' && data.paused) || data.type === 'paused') {
+              paused = true;
+              showBanner('The sender has paused sharing. This page will refresh when sharing resumes.');
+            }
+            if (data.type === 'resumed' && paused) {
+              location.reload();
+            }
+            if (data.type === 'expiry' && !paused) {
+              hideBanner();
+            }
+            if (data.type === 'expiringSoon' && !paused) {
+              const mins = Math.max(1, Math.round(data.remaining / 60));
+              showBanner('This share closes in ' + mins + ' minute' + (mins !== 1 ? 's' : '') + '. Download anything you need now.');
+            }
           } catch (e) {}
         };
         
@@ -696,6 +721,16 @@ ${fileListItems}
         ws.onerror = () => ws.close();
       }
       
+      const banner = document.getElementById('sessionBanner');
+      let paused = false;
+      function showBanner(text) {
+        banner.textContent = text;
+        banner.hidden = false;
+      }
+      function hideBanner() {
+        banner.hidden = true;
+      }
+      
       let countdownInterval = null;
       function startCountdown(expiresAtMs) {
         if (countdownInterval) clearInterval(countdownInterval);
@@ -7,10 +7,13 @@
 
 import { Command } from 'commander';
 import * as path from 'path';
+import * as readline from 'readline';
 import * as qrcode from 'qrcode-terminal';
 import { scanDirectory, calculateScanResult } from './scanner';
 import { validateScanResult, formatSize } from './validator';
-import { TunnelClient, TunnelClientConfig, TransferStats } from './tunnel-client';
+import { TunnelClient, TunnelClientConfig, TransferStats, RegistrationRejectedError } from './tunnel-client';
+import { SessionSummary, ViewerActivityMessage } from './protocol';
+import { createPasswordVerifier } from './password';
 
 /**
  * Default relay server URL
@@ -42,6 +45,16 @@ const MAX_RETRY_ATTEMPTS = 10;
  */
 const RETRY_DELAY_MS = 500;
 
+/**
+ * Minutes added or removed by the + and - keys
+ */
+const EXPIRY_STEP_MINUTES = 15;
+
+/**
+ * Number of paths listed in the end-of-session summary
+ */
+const SUMMARY_TOP_PATHS = 5;
+
 /**
  * Default exclude patterns
  */
@@ -56,6 +69,8 @@ interface CliOptions {
   exclude?: string[];
   duration: string;
   qr: boolean;
+  apiKey?: string;
+  activity: boolean;
 }
 
 /**
@@ -76,6 +91,121 @@ function formatSpeed(bytesPerSecond: number): string {
   return formatBytes(bytesPerSecond) + '/s';
 }
 
+/**
+ * Describe a viewer activity event for the terminal
+ */
+function formatActivity(activity: ViewerActivityMessage): string {
+  const time = new Date(activity.time).toLocaleTimeString();
+  switch (activity.type) {
+    case 'viewerJoined':
+      return `[${time}] Viewer ${activity.viewer} joined from ${activity.ip} (${activity.viewerCount ?? 0} watching)`;
+    case 'viewerLeft':
+      return `[${time}] Viewer ${activity.viewer} left (${activity.viewerCount ?? 0} watching)`;
+    case 'authFailed':
+      return `[${time}] Failed ${activity.method ?? 'password'} login from ${activity.ip} (${activity.attempts ?? 1} in a row)`;
+    case 'accessDenied':
+      return `[${time}] Blocked ${activity.ip}: ${activity.reason ?? 'access denied'}`;
+  }
+}
+
+/**
+ * Describe what a session served, most requested paths first
+ */
+function formatSummary(summary: SessionSummary): string {
+  const lines = [
+    `Served ${summary.requests} request${summary.requests !== 1 ? 's' : ''} ` +
+      `(${formatBytes(summary.bytesDelivered)}) to ${summary.uniqueViewers} viewer${summary.uniqueViewers !== 1 ? 's' : ''}.`,
+  ];
+  const failed = summary.canceled + summary.timeouts + summary.errors;
+  if (failed > 0) {
+    lines.push(`  ${summary.canceled} canceled, ${summary.timeouts} timed out, ${summary.errors} failed`);
+  }
+  const top = [...summary.paths].sort((a, b) => b.hits - a.hits).slice(0, SUMMARY_TOP_PATHS);
+  for (const p of top) {
+    lines.push(`  ${p.path}  ${p.hits}× ${formatBytes(p.bytes)}`);
+  }
+  if (summary.paths.length > top.length || summary.otherPaths) {
+    lines.push(`  ...and more`);
+  }
+  return lines.join('\n');
+}
+
+/**
+ * Print a line above the live stats line
+ */
+function printAboveStats(line: string): void {
+  process.stdout.write(`\r\x1b[K${line}\n`);
+}
+
+/**
+ * Move the session's expiry by minutes and report the outcome
+ */
+function changeExpiry(client: TunnelClient, minutes: number): void {
+  client.setExpiry(client.getExpiresAt() + minutes * 60)
+    .then((expiresAt) => {
+      const remaining = Math.max(0, Math.round((expiresAt * 1000 - Date.now()) / 60000));
+      printAboveStats(`Session now expires in ${formatDuration(remaining)}.`);
+    })
+    .catch((error: Error) => {
+      printAboveStats(`Could not change the expiry: ${error.message}`);
+    });
+}
+
+/**
+ * Ask the relay for a one-time link and print it
+ */
+function createOneTimeLink(client: TunnelClient): void {
+  client.createLink(1)
+    .then((link) => {
+      printAboveStats(`One-time link: ${link.url}`);
+    })
+    .catch((error: Error) => {
+      printAboveStats(`Could not create a link: ${error.message}`);
+    });
+}
+
+/**
+ * Keyboard controls while sharing: + and - move the expiry, l prints a
+ * one-time link, p pauses or resumes, q or Ctrl+C stops
+ */
+function listenForKeys(client: TunnelClient, stop: () => void): void {
+  let paused = false;
+  readline.emitKeypressEvents(process.stdin);
+  process.stdin.setRawMode(true);
+  process.stdin.on('keypress', (_str: string, key: readline.Key) => {
+    // Raw mode delivers Ctrl+C as a key instead of SIGINT
+    if (key.ctrl && key.name === 'c') {
+      stop();
+      return;
+    }
+    switch (key.sequence) {
+      case '+':
+      case '=':
+        changeExpiry(client, EXPIRY_STEP_MINUTES);
+        break;
+      case '-':
+        changeExpiry(client, -EXPIRY_STEP_MINUTES);
+        break;
+      case 'l':
+        createOneTimeLink(client);
+        break;
+      case 'p':
+        paused = !paused;
+        if (paused) {
+          client.pause();
+          printAboveStats('Sharing paused: viewers see a "paused" page. Press p to resume.');
+        } else {
+          client.resume();
+          printAboveStats('Sharing resumed.');
+        }
+        break;
+      case 'q':
+        stop();
+        break;
+    }
+  });
+}
+
 /**
  * Sleep for a specified number of milliseconds
  */
@@ -128,6 +258,8 @@ async function main(): Promise<void> {
     .option('-e, --exclude <patterns...>', 'Exclude files/folders matching patterns (e.g., -e .git node_modules)')
     .option('-d, --duration <minutes>', 'Session duration in minutes (1-120)', String(DEFAULT_DURATION_MINUTES))
     .option('-q, --qr', 'Show QR code for easy mobile sharing', true)
+    .option('--no-activity', 'Hide viewer activity (joins, failed logins, blocked viewers)')
+    .option('-k, --api-key <key>', 'API key for relays that require one (or set FWDCAST_API_KEY)')
     .addHelpText('after', `
 Examples:
   $ fwdcast                              Share current directory
@@ -137,6 +269,7 @@ Examples:
   $ fwdcast -d 60                        Session lasts 60 minutes
   $ fwdcast --no-qr                      Hide QR code (shown by default)
   $ fwdcast -p mypass -d 120 -e .git     Combine options
+  $ fwdcast -r wss://relay.example/ws -k KEY   Use a relay that requires an API key
 
 Default excludes (always applied):
   ${DEFAULT_EXCLUDES.join(', ')}
@@ -220,7 +353,11 @@ async function runShare(dirPath: string, options: CliOptions): Promise<void> {
   // Step 4: Connect to relay server
   console.log(`Connecting to relay server...`);
   
-  const expiresAt = Math.floor((Date.now() + durationMs) / 1000); // Unix timestamp in seconds
+  const startedAt = Date.now();
+  const expiresAt = Math.floor((startedAt + durationMs) / 1000); // Unix timestamp in seconds
+  
+  // Register a verifier of a derived key so the relay never sees the password
+  const passwordVerifier = options.password ? await createPasswordVerifier(options.password) : undefined;
   
   const config: TunnelClientConfig = {
     relayUrl: options.relay,
@@ -228,12 +365,17 @@ async function runShare(dirPath: string, options: CliOptions): Promise<void> {
     entries,
     expiresAt,
     password: options.password,
+    passwordVerifier,
     excludePatterns: uniqueExcludes,
+    apiKey: options.apiKey || process.env.FWDCAST_API_KEY,
     onUrl: (url) => {
       console.log(`\nShare active. URL:\n`);
       console.log(`  ${url}\n`);
       if (options.password) {
         console.log(`Password: ${options.password}`);
+        if (passwordVerifier) {
+          console.log(`Access key for scripts: ${passwordVerifier.accessKey}`);
+        }
       }
       console.log(`Session expires in ${formatDuration(durationMinutes)}.`);
       
@@ -243,16 +385,38 @@ async function runShare(dirPath: string, options: CliOptions): Promise<void> {
         qrcode.generate(url, { small: true });
       }
       
-      console.log(`\nPress Ctrl+C to stop sharing.\n`);
+      if (process.stdin.isTTY) {
+        console.log(`\nKeys: + / - move the expiry by ${EXPIRY_STEP_MINUTES} minutes, p pauses or resumes, q stops sharing.\n`);
+      } else {
+        console.log(`\nPress Ctrl+C to stop sharing.\n`);
+      }
     },
     onStats: (stats: TransferStats) => {
-      // Clear line and show stats
-      const viewerText = stats.activeViewers === 1 ? '1 viewer' : `${stats.activeViewers} viewers`;
+      // Clear line and show stats; the relay also counts viewers idling on a page
+      const viewers = stats.relay ? Math.max(stats.relay.liveViewers, stats.activeViewers) : stats.activeViewers;
+      const viewerText = viewers === 1 ? '1 viewer' : `${viewers} viewers`;
       const speedText = stats.currentSpeed > 0 ? ` | ${formatSpeed(stats.currentSpeed)}` : '';
-      process.stdout.write(`\r[${viewerText}] Total: ${formatBytes(stats.totalBytesSent)} | Requests: ${stats.requestCount}${speedText}    `);
+      let relayText = '';
+      if (stats.relay) {
+        const failed = stats.relay.canceled + stats.relay.timeouts + stats.relay.errors;
+        relayText = ` | Delivered: ${formatBytes(stats.relay.bytesDelivered)}`;
+        if (stats.relay.queued > 0) relayText += ` | Queued: ${stats.relay.queued}`;
+        if (failed > 0) relayText += ` | Failed: ${failed}`;
+      }
+      process.stdout.write(`\r[${viewerText}] Total: ${formatBytes(stats.totalBytesSent)}${relayText} | Requests: ${stats.requestCount}${speedText}    `);
     },
-    onExpired: () => {
-      console.log(`\nSession expired after ${formatDuration(durationMinutes)}.`);
+    onActivity: options.activity ? (activity) => printAboveStats(formatActivity(activity)) : undefined,
+    onExpiringSoon: (warning) => {
+      const minutes = Math.max(1, Math.round(warning.remaining / 60));
+      const hint = process.stdin.isTTY ? ' Press + to extend it.' : '';
+      printAboveStats(`Warning: the share closes in ${formatDuration(minutes)}.${hint}`);
+    },
+    onExpired: (summary) => {
+      const sharedMinutes = Math.max(1, Math.round((Date.now() - startedAt) / 60000));
+      console.log(`\nSession expired after ${formatDuration(sharedMinutes)}.`);
+      if (summary) {
+        console.log(formatSummary(summary));
+      }
       console.log('Files are no longer accessible.\n');
       process.exit(0);
     },
@@ -279,6 +443,12 @@ async function runShare(dirPath: string, options: CliOptions): Promise<void> {
     } catch (error) {
       lastError = error as Error;
       
+      // The relay answered and refused: retrying won't change its mind
+      if (lastError instanceof RegistrationRejectedError) {
+        console.error(`\nThe relay refused the share: ${lastError.message} (${lastError.code})\n`);
+        process.exit(1);
+      }
+      
       if (attempt < MAX_RETRY_ATTEMPTS) {
         console.log(`  Attempt ${attempt}/${MAX_RETRY_ATTEMPTS} failed: ${lastError.message}`);
         console.log(`  Retrying...\n`);
@@ -309,6 +479,10 @@ async function runShare(dirPath: string, options: CliOptions): Promise<void> {
   process.on('SIGINT', shutdown);
   process.on('SIGTERM', shutdown);
 
+  if (client && process.stdin.isTTY) {
+    listenForKeys(client, shutdown);
+  }
+
   // Keep the process running
   await new Promise(() => {});
 }
@@ -0,0 +1,35 @@
+import { describe, it, expect } from 'vitest';
+import { pbkdf2Sync, scryptSync } from 'crypto';
+import { createPasswordVerifier, deriveAccessKey, scryptVerifier, KDF_ITERATIONS } from './password';
+
+describe('Password key derivation', () => {
+  it('derives the same key the login page derives with PBKDF2-SHA256', async () => {
+    const salt = Buffer.from('0123456789abcdef');
+    const key = await deriveAccessKey('secret', salt, 1000);
+    expect(key).toBe(pbkdf2Sync('secret', salt, 1000, 32, 'sha256').toString('hex'));
+  });
+
+  it('builds scrypt verifiers in the format the relay parses', async () => {
+    const salt = Buffer.from('saltsaltsaltsalt');
+    const verifier = await scryptVerifier('key', salt);
+    const [, algorithm, params, encodedSalt, encodedKey] = verifier.split('$');
+
+    expect(algorithm).toBe('scrypt');
+    expect(params).toBe('ln=15,r=8,p=1');
+    expect(Buffer.from(encodedSalt, 'base64').equals(salt)).toBe(true);
+    expect(encodedKey).not.toContain('=');
+    const expected = scryptSync('key', salt, 32, { N: 2 ** 15, r: 8, p: 1, maxmem: 64 * 1024 * 1024 });
+    expect(Buffer.from(encodedKey, 'base64').equals(expected)).toBe(true);
+  });
+
+  it('never puts the password in what is registered', async () => {
+    const verifier = await createPasswordVerifier('hunter2');
+    const [algorithm, iterations, salt] = verifier.passwordKdf.split('$');
+
+    expect(algorithm).toBe('pbkdf2-sha256');
+    expect(Number(iterations)).toBe(KDF_ITERATIONS);
+    expect(verifier.accessKey).toBe(await deriveAccessKey('hunter2', Buffer.from(salt, 'base64')));
+    expect(verifier.passwordHash).not.toContain('hunter2');
+    expect(verifier.passwordHash.startsWith('$scrypt$')).toBe(true);
+  });
+});
@@ -0,0 +1,82 @@
+/**
+ * Share Password Key Derivation
+ *
+ * Keeps the share password from the relay: the CLI derives a key from the
+ * password with PBKDF2-SHA256 and registers only a scrypt verifier of that
+ * key, plus the PBKDF2 parameters. Viewers' browsers derive the same key on
+ * the relay's login page and send it instead of the password.
+ */
+
+import { pbkdf2, randomBytes, scrypt } from 'crypto';
+
+/**
+ * PBKDF2 iterations for the client-side key (OWASP recommendation for SHA-256)
+ */
+export const KDF_ITERATIONS = 600_000;
+
+/**
+ * scrypt cost for the verifier the relay stores (N = 2^15, 32 MiB)
+ */
+const SCRYPT_LOG_N = 15;
+const SCRYPT_R = 8;
+const SCRYPT_P = 1;
+
+const SALT_LENGTH = 16;
+const KEY_LENGTH = 32;
+
+/**
+ * What the CLI registers instead of the password
+ */
+export interface PasswordVerifier {
+  passwordKdf: string;  // "pbkdf2-sha256$<iterations>$<base64 salt>"
+  passwordHash: string; // scrypt verifier of the derived key
+  accessKey: string;    // The derived key (hex), for scripted clients
+}
+
+/**
+ * Derive the hex-encoded key viewers send in place of the password
+ */
+export function deriveAccessKey(password: string, salt: Buffer, iterations: number = KDF_ITERATIONS): Promise<string> {
+  return new Promise((resolve, reject) => {
+    pbkdf2(password, salt, iterations, KEY_LENGTH, 'sha256', (err, key) => {
+      if (err) reject(err);
+      else resolve(key.toString('hex'));
+    });
+  });
+}
+
+/**
+ * Build a scrypt verifier: $scrypt$ln=<log2 N>,r=<r>,p=<p>$<salt>$<key>
+ */
+export function scryptVerifier(secret: string, salt: Buffer = randomBytes(SALT_LENGTH)): Promise<string> {
+  const N = 2 ** SCRYPT_LOG_N;
+  return new Promise((resolve, reject) => {
+    scrypt(secret, salt, KEY_LENGTH, { N, r: SCRYPT_R, p: SCRYPT_P, maxmem: 256 * N * SCRYPT_R }, (err, key) => {
+      if (err) {
+        reject(err);
+        return;
+      }
+      resolve(`$scrypt$ln=${SCRYPT_LOG_N},r=${SCRYPT_R},p=${SCRYPT_P}$${rawBase64(salt)}$${rawBase64(key)}`);
+    });
+  });
+}
+
+/**
+ * Derive the access key for a password and a verifier for it
+ */
+export async function createPasswordVerifier(password: string): Promise<PasswordVerifier> {
+  const salt = randomBytes(SALT_LENGTH);
+  const accessKey = await deriveAccessKey(password, salt);
+  return {
+    passwordKdf: `pbkdf2-sha256$${KDF_ITERATIONS}$${salt.toString('base64')}`,
+    passwordHash: await scryptVerifier(accessKey),
+    accessKey,
+  };
+}
+
+/**
+ * Base64 without padding, as used in PHC-style hash strings
+ */
+function rawBase64(data: Buffer): string {
+  return data.toString('base64').replace(/=+$/, '');
+}
@@ -13,18 +13,40 @@ import {
   deserializeMessage,
   isRegisterMessage,
   isRegisteredMessage,
+  isRejectedMessage,
+  isViewerActivityMessage,
+  isStatsMessage,
+  isExpiringSoonMessage,
+  isCreateLinkMessage,
+  isLinkCreatedMessage,
+  isSignUrlMessage,
+  isSignedUrlMessage,
   isRequestMessage,
   isResponseMessage,
   isDataMessage,
   isEndMessage,
   isExpiredMessage,
+  isSetExpiryMessage,
+  isExpiryUpdatedMessage,
+  isPauseMessage,
+  isResumeMessage,
   createRegisterMessage,
   createRegisteredMessage,
+  createRejectedMessage,
+  createViewerActivityMessage,
+  createStatsMessage,
+  createExpiringSoonMessage,
+  createCreateLinkMessage,
+  createSignUrlMessage,
   createRequestMessage,
   createResponseMessage,
   createDataMessage,
   createEndMessage,
   createExpiredMessage,
+  createSetExpiryMessage,
+  createExpiryUpdatedMessage,
+  createPauseMessage,
+  createResumeMessage,
 } from './protocol';
 
 // ============================================================================
@@ -305,6 +327,16 @@ describe('Protocol', () => {
       );
     });
 
+    it('createRegisterMessage includes only the options that are set', () => {
+      const msg = createRegisterMessage('/share', 1700000000, undefined, {
+        passwordHash: '$scrypt$ln=15,r=8,p=1$c2FsdA$a2V5',
+        passwordKdf: undefined,
+      });
+      expect(msg.passwordHash).toBe('$scrypt$ln=15,r=8,p=1$c2FsdA$a2V5');
+      expect('passwordKdf' in msg).toBe(false);
+      expect('password' in msg).toBe(false);
+    });
+
     it('createRegisteredMessage creates valid message', () => {
       fc.assert(
         fc.property(nonEmptyStringArb, nonEmptyStringArb, (sessionId, url) => {
@@ -317,6 +349,61 @@ describe('Protocol', () => {
       );
     });
 
+    it('createRejectedMessage round-trips through deserialization', () => {
+      const msg = createRejectedMessage('unauthorized', 'This relay requires a valid API key');
+      const deserialized = deserializeMessage(serializeMessage(msg));
+      expect(isRejectedMessage(deserialized)).toBe(true);
+      expect(deserialized).toEqual(msg);
+    });
+
+    it('createViewerActivityMessage round-trips through deserialization', () => {
+      for (const type of ['viewerJoined', 'viewerLeft', 'authFailed', 'accessDenied'] as const) {
+        const msg = createViewerActivityMessage(type, 'a1b2c3d4', '203.0.113.4', 1700000000000);
+        const deserialized = deserializeMessage(serializeMessage(msg));
+        expect(isViewerActivityMessage(deserialized)).toBe(true);
+        expect(deserialized).toEqual(msg);
+      }
+      expect(deserializeMessage(JSON.stringify({ type: 'viewerJoined', ip: '203.0.113.4', time: 1 }))).toBeNull();
+    });
+
+    it('createStatsMessage round-trips through deserialization', () => {
+      const msg = createStatsMessage(1700000000000, {
+        bytesDelivered: 1024, activeDownloads: 1, queued: 0, viewers: 2,
+        liveViewers: 2, canceled: 0, timeouts: 1, errors: 0,
+      });
+      const deserialized = deserializeMessage(serializeMessage(msg));
+      expect(isStatsMessage(deserialized)).toBe(true);
+      expect(deserialized).toEqual(msg);
+    });
+
+    it('createExpiringSoonMessage round-trips through deserialization', () => {
+      const msg = createExpiringSoonMessage(1700000300, 300);
+      const deserialized = deserializeMessage(serializeMessage(msg));
+      expect(isExpiringSoonMessage(deserialized)).toBe(true);
+      expect(deserialized).toEqual(msg);
+    });
+
+    it('createCreateLinkMessage includes only the options that are set', () => {
+      const msg = createCreateLinkMessage('1', 1, { path: '/docs/' });
+      expect(isCreateLinkMessage(msg)).toBe(true);
+      expect(msg).toEqual({ type: 'createLink', id: '1', maxUses: 1, path: '/docs/' });
+    });
+
+    it('createSignUrlMessage creates valid message', () => {
+      const msg = createSignUrlMessage('2', '/docs/', 1700000000);
+      expect(isSignUrlMessage(msg)).toBe(true);
+      expect(deserializeMessage(serializeMessage(msg))).toEqual(msg);
+    });
+
+    it('accepts link and signed URL answers carrying either a URL or an error', () => {
+      expect(isLinkCreatedMessage({ type: 'linkCreated', id: '1', token: 't', url: 'https://relay/abc/t/t/' })).toBe(true);
+      expect(isLinkCreatedMessage({ type: 'linkCreated', id: '1', error: 'expiry must be in the future' })).toBe(true);
+      expect(isLinkCreatedMessage({ type: 'linkCreated', id: '1' })).toBe(false);
+      expect(isSignedUrlMessage({ type: 'signedUrl', id: '2', path: '/docs/', url: 'https://relay/abc/s/x/docs/' })).toBe(true);
+      expect(isSignedUrlMessage({ type: 'signedUrl', id: '2', error: 'expiry must be in the future' })).toBe(true);
+      expect(isSignedUrlMessage({ type: 'signedUrl', id: '2' })).toBe(false);
+    });
+
     it('createRequestMessage creates valid message', () => {
       fc.assert(
         fc.property(nonEmptyStringArb, methodArb, pathArb, (id, method, path) => {
@@ -370,6 +457,42 @@ describe('Protocol', () => {
       const msg = createExpiredMessage();
       expect(isExpiredMessage(msg)).toBe(true);
     });
+
+    it('createExpiredMessage carries the session summary', () => {
+      const msg = createExpiredMessage({
+        sessionId: 'abc123def456', reason: 'expired', createdAt: 1700000000000, endedAt: 1700001800000,
+        durationMs: 1800000, uniqueViewers: 2, requests: 3, bytesDelivered: 4096,
+        paths: [{ path: '/report.pdf', hits: 3, bytes: 4096 }], canceled: 0, timeouts: 0, errors: 0,
+      });
+      const deserialized = deserializeMessage(serializeMessage(msg));
+      expect(isExpiredMessage(deserialized)).toBe(true);
+      expect(deserialized).toEqual(msg);
+    });
+
+    it('createSetExpiryMessage creates valid message', () => {
+      fc.assert(
+        fc.property(nonEmptyStringArb, fc.integer({ min: 0 }), (id, expiresAt) => {
+          const msg = createSetExpiryMessage(id, expiresAt);
+          expect(isSetExpiryMessage(msg)).toBe(true);
+          expect(deserializeMessage(serializeMessage(msg))).toEqual(msg);
+        }),
+        { numRuns: 100 }
+      );
+    });
+
+    it('createExpiryUpdatedMessage creates valid message', () => {
+      const msg = createExpiryUpdatedMessage('1', 1700000000);
+      expect(isExpiryUpdatedMessage(msg)).toBe(true);
+      expect(msg.error).toBeUndefined();
+
+      const refused = createExpiryUpdatedMessage('2', 1700000000, 'duration limit exceeded');
+      expect(deserializeMessage(serializeMessage(refused))).toEqual(refused);
+    });
+
+    it('createPauseMessage and createResumeMessage create valid messages', () => {
+      expect(isPauseMessage(createPauseMessage())).toBe(true);
+      expect(isResumeMessage(createResumeMessage())).toBe(true);
+    });
   });
 
   describe('Invalid message handling', () => {
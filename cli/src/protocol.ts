@@ -21,8 +21,18 @@ export interface RegisterMessage {
   path: string;
   expiresAt: number; // Unix timestamp
   password?: string; // Optional password protection
+  passwordHash?: string; // Verifier of a key derived from the password, sent instead of it
+  passwordKdf?: string;  // How viewers derive that key: "pbkdf2-sha256$<iterations>$<salt>"
+  activityFeed?: boolean; // Request viewerJoined, viewerLeft, authFailed and accessDenied messages
+  stats?: boolean;        // Request periodic stats messages
+  expiryWarnings?: boolean; // Request expiringSoon messages ahead of expiry
 }
 
+/**
+ * Optional register fields beyond the share path, expiry and password
+ */
+export type RegisterOptions = Partial<Omit<RegisterMessage, 'type' | 'path' | 'expiresAt' | 'password'>>;
+
 /**
  * Relay → CLI: Registration response
  * Sent after successful session creation
@@ -34,6 +44,16 @@ export interface RegisteredMessage {
   url: string;
 }
 
+/**
+ * Relay → CLI: Registration refused
+ * Sent instead of registered, just before the relay closes the connection
+ */
+export interface RejectedMessage {
+  type: 'rejected';
+  code: string;    // e.g. unauthorized, too_many_sessions, unavailable
+  message: string;
+}
+
 /**
  * Relay → CLI: Forward HTTP request
  * Sent when a viewer requests a resource
@@ -85,6 +105,167 @@ export interface EndMessage {
  */
 export interface ExpiredMessage {
   type: 'expired';
+  summary?: SessionSummary; // What the session served
+}
+
+/**
+ * Requests and bytes served for one path
+ */
+export interface PathSummary {
+  path: string;
+  hits: number;
+  bytes: number;
+}
+
+/**
+ * What a session served, as reported by the relay when it ends
+ */
+export interface SessionSummary {
+  sessionId: string;
+  reason: string;        // expired or disconnected
+  createdAt: number;     // Unix timestamp in milliseconds
+  endedAt: number;       // Unix timestamp in milliseconds
+  durationMs: number;
+  uniqueViewers: number; // Distinct IP and user agent pairs served
+  requests: number;
+  bytesDelivered: number;
+  paths: PathSummary[];     // Sorted by path
+  otherPaths?: PathSummary; // Paths beyond the relay's per-report limit
+  canceled: number;
+  timeouts: number;
+  errors: number;
+}
+
+/**
+ * Relay → CLI: Viewer activity for the sharer's audience feed
+ * Sent only to CLIs that registered with activityFeed
+ */
+export interface ViewerActivityMessage {
+  type: 'viewerJoined' | 'viewerLeft' | 'authFailed' | 'accessDenied';
+  viewer: string;       // Anonymized ID, stable for an IP and user agent within the session
+  ip: string;
+  userAgent?: string;
+  time: number;         // Unix timestamp in milliseconds
+  viewerCount?: number; // viewerJoined/viewerLeft: live viewers now connected
+  method?: string;      // authFailed: password, basic, bearer or token
+  attempts?: number;    // authFailed: consecutive failures
+  reason?: string;      // accessDenied: error code, e.g. ip_not_allowed
+}
+
+/**
+ * Relay → CLI: Transfer statistics as the relay sees them
+ * Sent periodically (when they change) to CLIs that registered with stats
+ */
+export interface StatsMessage {
+  type: 'stats';
+  time: number;            // Unix timestamp in milliseconds
+  bytesDelivered: number;  // Response bytes written to viewers
+  activeDownloads: number; // Responses being streamed
+  queued: number;          // Requests waiting for the CLI to respond
+  viewers: number;         // Viewer requests in flight
+  liveViewers: number;     // Open live-update sockets
+  canceled: number;        // Transfers the viewer abandoned
+  timeouts: number;        // 504 responses
+  errors: number;          // Other 5xx responses
+}
+
+/**
+ * CLI → Relay: Move the session's expiry
+ * May extend or shorten the session, subject to the relay's duration limits
+ */
+export interface SetExpiryMessage {
+  type: 'setExpiry';
+  id: string;        // Correlation ID echoed in expiryUpdated
+  expiresAt: number; // Unix timestamp
+}
+
+/**
+ * Relay → CLI: Answer to setExpiry
+ * expiresAt is the session's expiry after the request; error is set if the
+ * request was refused and the expiry left unchanged
+ */
+export interface ExpiryUpdatedMessage {
+  type: 'expiryUpdated';
+  id: string;
+  expiresAt: number; // Unix timestamp
+  error?: string;
+}
+
+/**
+ * Relay → CLI: The session will expire shortly
+ * Sent at each of the relay's warning thresholds (e.g. 5 and 1 minutes) to
+ * CLIs that registered with expiryWarnings
+ */
+export interface ExpiringSoonMessage {
+  type: 'expiringSoon';
+  expiresAt: number; // Unix timestamp
+  remaining: number; // Seconds left
+}
+
+/**
+ * CLI → Relay: Request a limited-use access link
+ * The link bypasses the session password and allows maxUses requests
+ */
+export interface CreateLinkMessage {
+  type: 'createLink';
+  id: string;         // Correlation ID echoed in linkCreated
+  maxUses: number;    // 1 for a one-time link
+  expiresAt?: number; // Unix timestamp, omitted = session expiry
+  path?: string;      // File or directory the link is limited to, omitted = whole share
+}
+
+/**
+ * Relay → CLI: Answer to createLink
+ * error is set if no link was issued; only id is set alongside it
+ */
+export interface LinkCreatedMessage {
+  type: 'linkCreated';
+  id: string;
+  token?: string;
+  url?: string;
+  maxUses?: number;
+  expiresAt?: number; // Unix timestamp
+  path?: string;      // Normalized path scope
+  error?: string;
+}
+
+/**
+ * CLI → Relay: Request a signed URL for a path
+ * The signed URL bypasses the session password for that path (or directory) only
+ */
+export interface SignUrlMessage {
+  type: 'signUrl';
+  id: string;         // Correlation ID echoed in signedUrl
+  path: string;       // Path prefix within the share, e.g. /docs/
+  expiresAt?: number; // Unix timestamp, omitted = session expiry
+}
+
+/**
+ * Relay → CLI: Answer to signUrl
+ * error is set if no URL was signed; only id is set alongside it
+ */
+export interface SignedUrlMessage {
+  type: 'signedUrl';
+  id: string;
+  path?: string;      // Normalized path scope
+  url?: string;
+  expiresAt?: number; // Unix timestamp
+  error?: string;
+}
+
+/**
+ * CLI → Relay: Stop serving viewers but keep the session
+ * Viewers get a "share paused" page until the CLI sends resume
+ */
+export interface PauseMessage {
+  type: 'pause';
+}
+
+/**
+ * CLI → Relay: Serve viewers again after a pause
+ */
+export interface ResumeMessage {
+  type: 'resume';
 }
 
 /**
@@ -93,11 +274,23 @@ export interface ExpiredMessage {
 export type ProtocolMessage =
   | RegisterMessage
   | RegisteredMessage
+  | RejectedMessage
   | RequestMessage
   | ResponseMessage
   | DataMessage
   | EndMessage
-  | ExpiredMessage;
+  | ExpiredMessage
+  | ViewerActivityMessage
+  | StatsMessage
+  | SetExpiryMessage
+  | ExpiryUpdatedMessage
+  | ExpiringSoonMessage
+  | CreateLinkMessage
+  | LinkCreatedMessage
+  | SignUrlMessage
+  | SignedUrlMessage
+  | PauseMessage
+  | ResumeMessage;
 
 /**
  * Message type literals for type guards
@@ -128,6 +321,16 @@ export function isRegisteredMessage(msg: unknown): msg is RegisteredMessage {
   );
 }
 
+export function isRejectedMessage(msg: unknown): msg is RejectedMessage {
+  return (
+    typeof msg === 'object' &&
+    msg !== null &&
+    (msg as RejectedMessage).type === 'rejected' &&
+    typeof (msg as RejectedMessage).code === 'string' &&
+    typeof (msg as RejectedMessage).message === 'string'
+  );
+}
+
 export function isRequestMessage(msg: unknown): msg is RequestMessage {
   return (
     typeof msg === 'object' &&
@@ -178,15 +381,137 @@ export function isExpiredMessage(msg: unknown): msg is ExpiredMessage {
   );
 }
 
+const VIEWER_ACTIVITY_TYPES: readonly string[] = ['viewerJoined', 'viewerLeft', 'authFailed', 'accessDenied'];
+
+export function isViewerActivityMessage(msg: unknown): msg is ViewerActivityMessage {
+  return (
+    typeof msg === 'object' &&
+    msg !== null &&
+    VIEWER_ACTIVITY_TYPES.includes((msg as ViewerActivityMessage).type) &&
+    typeof (msg as ViewerActivityMessage).viewer === 'string' &&
+    typeof (msg as ViewerActivityMessage).ip === 'string' &&
+    typeof (msg as ViewerActivityMessage).time === 'number'
+  );
+}
+
+export function isStatsMessage(msg: unknown): msg is StatsMessage {
+  return (
+    typeof msg === 'object' &&
+    msg !== null &&
+    (msg as StatsMessage).type === 'stats' &&
+    typeof (msg as StatsMessage).time === 'number' &&
+    typeof (msg as StatsMessage).bytesDelivered === 'number' &&
+    typeof (msg as StatsMessage).liveViewers === 'number'
+  );
+}
+
+export function isSetExpiryMessage(msg: unknown): msg is SetExpiryMessage {
+  return (
+    typeof msg === 'object' &&
+    msg !== null &&
+    (msg as SetExpiryMessage).type === 'setExpiry' &&
+    typeof (msg as SetExpiryMessage).id === 'string' &&
+    typeof (msg as SetExpiryMessage).expiresAt === 'number'
+  );
+}
+
+export function isExpiryUpdatedMessage(msg: unknown): msg is ExpiryUpdatedMessage {
+  return (
+    typeof msg === 'object' &&
+    msg !== null &&
+    (msg as ExpiryUpdatedMessage).type === 'expiryUpdated' &&
+    typeof (msg as ExpiryUpdatedMessage).id === 'string' &&
+    typeof (msg as ExpiryUpdatedMessage).expiresAt === 'number'
+  );
+}
+
+export function isExpiringSoonMessage(msg: unknown): msg is ExpiringSoonMessage {
+  return (
+    typeof msg === 'object' &&
+    msg !== null &&
+    (msg as ExpiringSoonMessage).type === 'expiringSoon' &&
+    typeof (msg as ExpiringSoonMessage).expiresAt === 'number' &&
+    typeof (msg as ExpiringSoonMessage).remaining === 'number'
+  );
+}
+
+export function isCreateLinkMessage(msg: unknown): msg is CreateLinkMessage {
+  return (
+    typeof msg === 'object' &&
+    msg !== null &&
+    (msg as CreateLinkMessage).type === 'createLink' &&
+    typeof (msg as CreateLinkMessage).id === 'string' &&
+    typeof (msg as CreateLinkMessage).maxUses === 'number'
+  );
+}
+
+export function isLinkCreatedMessage(msg: unknown): msg is LinkCreatedMessage {
+  return (
+    typeof msg === 'object' &&
+    msg !== null &&
+    (msg as LinkCreatedMessage).type === 'linkCreated' &&
+    typeof (msg as LinkCreatedMessage).id === 'string' &&
+    (typeof (msg as LinkCreatedMessage).url === 'string' || typeof (msg as LinkCreatedMessage).error === 'string')
+  );
+}
+
+export function isSignUrlMessage(msg: unknown): msg is SignUrlMessage {
+  return (
+    typeof msg === 'object' &&
+    msg !== null &&
+    (msg as SignUrlMessage).type === 'signUrl' &&
+    typeof (msg as SignUrlMessage).id === 'string' &&
+    typeof (msg as SignUrlMessage).path === 'string'
+  );
+}
+
+export function isSignedUrlMessage(msg: unknown): msg is SignedUrlMessage {
+  return (
+    typeof msg === 'object' &&
+    msg !== null &&
+    (msg as SignedUrlMessage).type === 'signedUrl' &&
+    typeof (msg as SignedUrlMessage).id === 'string' &&
+    (typeof (msg as SignedUrlMessage).url === 'string' || typeof (msg as SignedUrlMessage).error === 'string')
+  );
+}
+
+export function isPauseMessage(msg: unknown): msg is PauseMessage {
+  return (
+    typeof msg === 'object' &&
+    msg !== null &&
+    (msg as PauseMessage).type === 'pause'
+  );
+}
+
+export function isResumeMessage(msg: unknown): msg is ResumeMessage {
+  return (
+    typeof msg === 'object' &&
+    msg !== null &&
+    (msg as ResumeMessage).type === 'resume'
+  );
+}
+
 export function isProtocolMessage(msg: unknown): msg is ProtocolMessage {
   return (
     isRegisterMessage(msg) ||
     isRegisteredMessage(msg) ||
+    isRejectedMessage(msg) ||
     isRequestMessage(msg) ||
     isResponseMessage(msg) ||
     isDataMessage(msg) ||
     isEndMessage(msg) ||
-    isExpiredMessage(msg)
+    isExpiredMessage(msg) ||
+    isViewerActivityMessage(msg) ||
+    isStatsMessage(msg) ||
+    isSetExpiryMessage(msg) ||
+    isExpiryUpdatedMessage(msg) ||
+    isExpiringSoonMessage(msg) ||
+    isCreateLinkMessage(msg) ||
+    isLinkCreatedMessage(msg) ||
+    isSignUrlMessage(msg) ||
+    isSignedUrlMessage(msg) ||
+    isPauseMessage(msg) ||
+    isResumeMessage(msg)
   );
 }
 
@@ -221,11 +546,21 @@ export function deserializeMessage(data: string): ProtocolMessage | null {
 // Message Factories
 // ============================================================================
 
-export function createRegisterMessage(path: string, expiresAt: number, password?: string): RegisterMessage {
+export function createRegisterMessage(
+  path: string,
+  expiresAt: number,
+  password?: string,
+  options: RegisterOptions = {}
+): RegisterMessage {
   const msg: RegisterMessage = { type: 'register', path, expiresAt };
   if (password) {
     msg.password = password;
   }
+  for (const [key, value] of Object.entries(options)) {
+    if (value) {
+      (msg as unknown as Record<string, unknown>)[key] = value;
+    }
+  }
   return msg;
 }
 
@@ -233,6 +568,10 @@ export function createRegisteredMessage(sessionId: string, url: string): Registe
   return { type: 'registered', sessionId, url };
 }
 
+export function createRejectedMessage(code: string, message: string): RejectedMessage {
+  return { type: 'rejected', code, message };
+}
+
 export function createRequestMessage(id: string, method: string, path: string): RequestMessage {
   return { type: 'request', id, method, path };
 }
@@ -253,6 +592,70 @@ export function createEndMessage(id: string): EndMessage {
   return { type: 'end', id };
 }
 
-export function createExpiredMessage(): ExpiredMessage {
-  return { type: 'expired' };
+export function createExpiredMessage(summary?: SessionSummary): ExpiredMessage {
+  const msg: ExpiredMessage = { type: 'expired' };
+  if (summary) {
+    msg.summary = summary;
+  }
+  return msg;
+}
+
+export function createViewerActivityMessage(
+  type: ViewerActivityMessage['type'],
+  viewer: string,
+  ip: string,
+  time: number
+): ViewerActivityMessage {
+  return { type, viewer, ip, time };
+}
+
+export function createStatsMessage(time: number, counts: Omit<StatsMessage, 'type' | 'time'>): StatsMessage {
+  return { type: 'stats', time, ...counts };
 }
+
+export function createSetExpiryMessage(id: string, expiresAt: number): SetExpiryMessage {
+  return { type: 'setExpiry', id, expiresAt };
+}
+
+export function createExpiryUpdatedMessage(id: string, expiresAt: number, error?: string): ExpiryUpdatedMessage {
+  const msg: ExpiryUpdatedMessage = { type: 'expiryUpdated', id, expiresAt };
+  if (error) {
+    msg.error = error;
+  }
+  return msg;
+}
+
+export function createExpiringSoonMessage(expiresAt: number, remaining: number): ExpiringSoonMessage {
+  return { type: 'expiringSoon', expiresAt, remaining };
+}
+
+export function createCreateLinkMessage(
+  id: string,
+  maxUses: number,
+  options: { expiresAt?: number; path?: string } = {}
+): CreateLinkMessage {
+  const msg: CreateLinkMessage = { type: 'createLink', id, maxUses };
+  if (options.expiresAt) {
+    msg.expiresAt = options.expiresAt;
+  }
+  if (options.path) {
+    msg.path = options.path;
+  }
+  return msg;
+}
+
+export function createSignUrlMessage(id: string, path: string, expiresAt?: number): SignUrlMessage {
+  const msg: SignUrlMessage = { type: 'signUrl', id, path };
+  if (expiresAt) {
+    msg.expiresAt = expiresAt;
+  }
+  return msg;
+}
+
+export function createPauseMessage(): PauseMessage {
+  return { type: 'pause' };
+}
+
+export function createResumeMessage(): ResumeMessage {
+  return { type: 'resume' };
+}
\ No newline at end of file
@@ -3,7 +3,10 @@ import * as fc from 'fast-check';
 import * as fs from 'fs';
 import * as path from 'path';
 import * as os from 'os';
-import { TunnelClient, TunnelClientConfig } from './tunnel-client';
+import { WebSocketServer } from 'ws';
+import { AddressInfo } from 'net';
+import { TunnelClient, TunnelClientConfig, RegistrationRejectedError } from './tunnel-client';
+import { createRejectedMessage, serializeMessage } from './protocol';
 import { DirectoryEntry } from './scanner';
 
 /**
@@ -167,4 +170,46 @@ describe('TunnelClient', () => {
       expect(lookup('test.unknownext')).toBe(false);
     });
   });
+
+  describe('Registration', () => {
+    let server: WebSocketServer;
+
+    beforeEach(async () => {
+      server = new WebSocketServer({ port: 0 });
+      await new Promise<void>((resolve) => server.once('listening', () => resolve()));
+    });
+
+    afterEach(async () => {
+      await new Promise<void>((resolve) => server.close(() => resolve()));
+    });
+
+    it('sends the API key and fails with the relay\'s reason when rejected', async () => {
+      let presentedKey: string | undefined;
+      server.on('connection', (socket, request) => {
+        presentedKey = request.headers['x-fwdcast-api-key'] as string | undefined;
+        socket.once('message', () => {
+          socket.send(serializeMessage(createRejectedMessage('unauthorized', 'This relay requires a valid API key')));
+          socket.close();
+        });
+      });
+
+      let disconnected = false;
+      const client = new TunnelClient({
+        relayUrl: `ws://localhost:${(server.address() as AddressInfo).port}`,
+        basePath: os.tmpdir(),
+        entries: [],
+        expiresAt: Math.floor(Date.now() / 1000) + 60,
+        apiKey: 'ci-secret',
+        onDisconnect: () => { disconnected = true; },
+      });
+
+      const error = await client.connect().catch((err) => err);
+      expect(error).toBeInstanceOf(RegistrationRejectedError);
+      expect(error.code).toBe('unauthorized');
+      expect(error.message).toBe('This relay requires a valid API key');
+      expect(presentedKey).toBe('ci-secret');
+      expect(disconnected).toBe(false);
+      client.disconnect();
+    });
+  });
 });
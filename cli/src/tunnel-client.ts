@@ -15,23 +15,50 @@ import archiver from 'archiver';
 import {
   RegisterMessage,
   RegisteredMessage,
+  RejectedMessage,
   RequestMessage,
   ResponseMessage,
   DataMessage,
   EndMessage,
+  SetExpiryMessage,
+  ExpiryUpdatedMessage,
+  ExpiredMessage,
+  ExpiringSoonMessage,
+  CreateLinkMessage,
+  LinkCreatedMessage,
+  SignUrlMessage,
+  SignedUrlMessage,
+  SessionSummary,
+  ViewerActivityMessage,
+  StatsMessage,
+  PauseMessage,
+  ResumeMessage,
   serializeMessage,
   deserializeMessage,
   isRegisteredMessage,
+  isRejectedMessage,
   isRequestMessage,
   isExpiredMessage,
+  isExpiryUpdatedMessage,
+  isViewerActivityMessage,
+  isStatsMessage,
+  isExpiringSoonMessage,
+  isLinkCreatedMessage,
+  isSignedUrlMessage,
   createRegisterMessage,
   createResponseMessage,
   createDataMessage,
   createEndMessage,
+  createSetExpiryMessage,
+  createCreateLinkMessage,
+  createSignUrlMessage,
+  createPauseMessage,
+  createResumeMessage,
 } from './protocol';
 import { scanDirectory, calculateScanResult, scanDirectoryShallow } from './scanner';
 import { DirectoryEntry } from './scanner';
 import { generateDirectoryHtml } from './html-generator';
+import { PasswordVerifier } from './password';
 
 /**
  * Transfer statistics
@@ -41,6 +68,7 @@ export interface TransferStats {
   requestCount: number;
   activeViewers: number;
   currentSpeed: number; // bytes per second
+  relay?: StatsMessage; // Latest figures from the relay, which sees what reached viewers
 }
 
 /**
@@ -52,10 +80,14 @@ export interface TunnelClientConfig {
   entries: DirectoryEntry[];
   expiresAt: number;
   password?: string;
+  passwordVerifier?: PasswordVerifier; // Registered instead of password, so the relay never sees it
+  apiKey?: string; // For relays that require API keys
   excludePatterns?: string[];
   onUrl?: (url: string) => void;
   onStats?: (stats: TransferStats) => void;
-  onExpired?: () => void;
+  onExpired?: (summary?: SessionSummary) => void;
+  onExpiringSoon?: (warning: ExpiringSoonMessage) => void; // Setting this requests the relay's expiry warnings
+  onActivity?: (activity: ViewerActivityMessage) => void; // Setting this requests the relay's activity feed
   onDisconnect?: () => void;
   onError?: (error: Error) => void;
 }
@@ -68,6 +100,36 @@ export interface RegistrationResult {
   url: string;
 }
 
+/**
+ * The relay refused to register the session (bad API key, limits, shutdown)
+ */
+export class RegistrationRejectedError extends Error {
+  constructor(public readonly code: string, message: string) {
+    super(message);
+    this.name = 'RegistrationRejectedError';
+  }
+}
+
+/**
+ * Relay answers to CLI requests, matched to them by id
+ */
+type RelayReply = ExpiryUpdatedMessage | LinkCreatedMessage | SignedUrlMessage;
+
+/**
+ * A limited-use link issued by the relay
+ */
+export interface AccessLink {
+  url: string;
+  maxUses: number;
+  expiresAt: number; // Unix timestamp
+  path: string;      // Path scope within the share
+}
+
+/**
+ * Header carrying the API key on the WebSocket upgrade
+ */
+const API_KEY_HEADER = 'X-Fwdcast-Api-Key';
+
 /**
  * Chunk size for file streaming (64KB)
  */
@@ -87,6 +149,11 @@ export class TunnelClient {
     resolve: (result: RegistrationResult) => void;
     reject: (error: Error) => void;
   } | null = null;
+  private pendingReplies: Map<string, {
+    resolve: (reply: RelayReply) => void;
+    reject: (error: Error) => void;
+  }> = new Map();
+  private nextReplyId: number = 1;
   
   // Stats tracking
   private stats: TransferStats = {
@@ -195,7 +262,11 @@ export class TunnelClient {
       this.registrationPromise = { resolve, reject };
 
       try {
-        this.ws = new WebSocket(this.config.relayUrl);
+        const headers: Record<string, string> = {};
+        if (this.config.apiKey) {
+          headers[API_KEY_HEADER] = this.config.apiKey;
+        }
+        this.ws = new WebSocket(this.config.relayUrl, { headers });
 
         this.ws.on('open', () => {
           this.connected = true;
@@ -208,9 +279,10 @@ export class TunnelClient {
 
         this.ws.on('close', () => {
           this.connected = false;
+          this.rejectPendingReplies(new Error('Connection closed'));
           // Only call onDisconnect if we were successfully registered
           // (not during initial connection attempts)
-          if (!this.registrationPromise && this.config.onDisconnect) {
+          if (this.sessionId && this.config.onDisconnect) {
             this.config.onDisconnect();
           }
           // If still trying to register, reject the promise
@@ -259,10 +331,18 @@ export class TunnelClient {
    * Requirements: 5.1
    */
   private sendRegisterMessage(): void {
+    const verifier = this.config.passwordVerifier;
     const message = createRegisterMessage(
       this.config.basePath,
       this.config.expiresAt,
-      this.config.password
+      verifier ? undefined : this.config.password,
+      {
+        passwordHash: verifier?.passwordHash,
+        passwordKdf: verifier?.passwordKdf,
+        activityFeed: !!this.config.onActivity,
+        stats: !!this.config.onStats,
+        expiryWarnings: !!this.config.onExpiringSoon,
+      }
     );
     this.send(message);
   }
@@ -281,11 +361,123 @@ export class TunnelClient {
 
     if (isRegisteredMessage(message)) {
       this.handleRegistered(message);
+    } else if (isRejectedMessage(message)) {
+      this.handleRejected(message);
     } else if (isRequestMessage(message)) {
       this.handleRequest(message);
     } else if (isExpiredMessage(message)) {
-      this.handleExpired();
+      this.handleExpired(message);
+    } else if (isExpiryUpdatedMessage(message) || isLinkCreatedMessage(message) || isSignedUrlMessage(message)) {
+      this.handleReply(message);
+    } else if (isExpiringSoonMessage(message)) {
+      if (this.config.onExpiringSoon) {
+        this.config.onExpiringSoon(message);
+      }
+    } else if (isStatsMessage(message)) {
+      this.stats.relay = message;
+      this.emitStats();
+    } else if (isViewerActivityMessage(message)) {
+      if (this.config.onActivity) {
+        this.config.onActivity(message);
+      }
+    }
+  }
+
+  /**
+   * The session's current expiry (Unix timestamp in seconds)
+   */
+  getExpiresAt(): number {
+    return this.config.expiresAt;
+  }
+
+  /**
+   * Move the session's expiry to expiresAt (Unix timestamp in seconds).
+   * Resolves with the new expiry, or rejects if the relay refused the change.
+   */
+  async setExpiry(expiresAt: number): Promise<number> {
+    const reply = await this.request((id) => createSetExpiryMessage(id, expiresAt)) as ExpiryUpdatedMessage;
+    this.config.expiresAt = reply.expiresAt;
+    return reply.expiresAt;
+  }
+
+  /**
+   * Ask the relay for a link that bypasses the password for maxUses requests,
+   * optionally limited to a path and expiring before the session does
+   */
+  async createLink(maxUses: number, options: { expiresAt?: number; path?: string } = {}): Promise<AccessLink> {
+    const reply = await this.request((id) => createCreateLinkMessage(id, maxUses, options)) as LinkCreatedMessage;
+    return {
+      url: reply.url ?? '',
+      maxUses: reply.maxUses ?? maxUses,
+      expiresAt: reply.expiresAt ?? this.config.expiresAt,
+      path: reply.path ?? '/',
+    };
+  }
+
+  /**
+   * Ask the relay for a URL that bypasses the password for path (a file or
+   * directory) until expiresAt, or the session's expiry. Resolves with the URL.
+   */
+  async signUrl(path: string, expiresAt?: number): Promise<string> {
+    const reply = await this.request((id) => createSignUrlMessage(id, path, expiresAt)) as SignedUrlMessage;
+    return reply.url ?? '';
+  }
+
+  /**
+   * Send a message that the relay answers, resolving with the answer or
+   * rejecting with the error it carries
+   */
+  private request(build: (id: string) => SetExpiryMessage | CreateLinkMessage | SignUrlMessage): Promise<RelayReply> {
+    if (!this.isConnected()) {
+      return Promise.reject(new Error('Not connected'));
     }
+    const id = String(this.nextReplyId++);
+    return new Promise((resolve, reject) => {
+      this.pendingReplies.set(id, { resolve, reject });
+      this.send(build(id));
+    });
+  }
+
+  /**
+   * Pause sharing: viewers get a "share paused" page until resume() is called.
+   * The session and its URL stay alive.
+   */
+  pause(): void {
+    this.send(createPauseMessage());
+  }
+
+  /**
+   * Resume sharing after pause()
+   */
+  resume(): void {
+    this.send(createResumeMessage());
+  }
+
+  /**
+   * Handle the relay's answer to setExpiry, createLink or signUrl
+   */
+  private handleReply(message: RelayReply): void {
+    const request = this.pendingReplies.get(message.id);
+    if (!request) {
+      return;
+    }
+    this.pendingReplies.delete(message.id);
+
+    if (message.error) {
+      request.reject(new Error(message.error));
+      return;
+    }
+    request.resolve(message);
+  }
+
+  /**
+   * Fail requests still waiting for an answer
+   */
+  private rejectPendingReplies(error: Error): void {
+    for (const request of this.pendingReplies.values()) {
+      request.reject(error);
+    }
+    this.pendingReplies.clear();
   }
 
   /**
@@ -314,6 +506,16 @@ export class TunnelClient {
     this.startStatsInterval();
   }
 
+  /**
+   * Handle the relay refusing the registration; it closes the connection next
+   */
+  private handleRejected(message: RejectedMessage): void {
+    if (this.registrationPromise) {
+      this.registrationPromise.reject(new RegistrationRejectedError(message.code, message.message));
+      this.registrationPromise = null;
+    }
+  }
+
   /**
    * Handle incoming request from relay
    * Routes to file server or directory listing
@@ -548,9 +750,9 @@ export class TunnelClient {
   /**
    * Handle session expired message
    */
-  private handleExpired(): void {
+  private handleExpired(message: ExpiredMessage): void {
     if (this.config.onExpired) {
-      this.config.onExpired();
+      this.config.onExpired(message.summary);
     }
     this.disconnect();
   }
@@ -744,7 +946,7 @@ export class TunnelClient {
   /**
    * Send a message through the WebSocket
    */
-  private send(message: RegisterMessage | ResponseMessage | DataMessage | EndMessage): void {
+  private send(message: RegisterMessage | ResponseMessage | DataMessage | EndMessage | SetExpiryMessage | CreateLinkMessage | SignUrlMessage | PauseMessage | ResumeMessage): void {
     if (this.ws && this.ws.readyState === WebSocket.OPEN) {
       this.ws.send(serializeMessage(message));
     }
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Access Log
+// One line per viewer request, in Combined Log Format or JSON, for abuse
+// investigations. File names in a share may be sensitive, so the resource
+// path after the session ID is redacted according to PathRedaction, and
+// link/signed URL tokens are never written.
+// ============================================================================
+
+// Access log formats
+const (
+	AccessLogCombined = "combined"
+	AccessLogJSON     = "json"
+)
+
+// PathRedaction controls how much of the resource path is logged
+type PathRedaction string
+
+const (
+	RedactHash     PathRedaction = "hash"     // /{id}/#<hash of the rest>
+	RedactTruncate PathRedaction = "truncate" // /{id}/ followed by the first segment only
+	RedactKeep     PathRedaction = "keep"     // The full path and query
+)
+
+// Defaults for access log rotation
+const (
+	DefaultAccessLogMaxSizeMB  = 100
+	DefaultAccessLogMaxBackups = 5
+)
+
+// AccessLogger writes access log lines
+type AccessLogger struct {
+	out       io.Writer
+	format    string
+	redaction PathRedaction
+	mu        sync.Mutex
+}
+
+// NewAccessLogger creates an access logger writing to out
+func NewAccessLogger(out io.Writer, format string, redaction PathRedaction) (*AccessLogger, error) {
+	switch format {
+	case AccessLogCombined, AccessLogJSON:
+	default:
+		return nil, fmt.Errorf("invalid access log format %q (want combined or json)", format)
+	}
+	switch redaction {
+	case RedactHash, RedactTruncate, RedactKeep:
+	default:
+		return nil, fmt.Errorf("invalid path redaction %q (want hash, truncate or keep)", redaction)
+	}
+	return &AccessLogger{out: out, format: format, redaction: redaction}, nil
+}
+
+// AccessLoggerFromEnv creates the access logger configured by ACCESS_LOG (a
+// file path, or "-" for stdout), ACCESS_LOG_FORMAT, ACCESS_LOG_PATHS,
+// ACCESS_LOG_MAX_SIZE_MB and ACCESS_LOG_MAX_BACKUPS.
+// Returns nil if ACCESS_LOG is unset.
+func AccessLoggerFromEnv() (*AccessLogger, error) {
+	path := os.Getenv("ACCESS_LOG")
+	if path == "" {
+		return nil, nil
+	}
+
+	format := strings.ToLower(os.Getenv("ACCESS_LOG_FORMAT"))
+	if format == "" {
+		format = AccessLogCombined
+	}
+	redaction := PathRedaction(strings.ToLower(os.Getenv("ACCESS_LOG_PATHS")))
+	if redaction == "" {
+		redaction = RedactHash
+	}
+
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		maxSize, err := envUint("ACCESS_LOG_MAX_SIZE_MB", DefaultAccessLogMaxSizeMB, 32)
+		if err != nil {
+			return nil, err
+		}
+		backups, err := envUint("ACCESS_LOG_MAX_BACKUPS", DefaultAccessLogMaxBackups, 16)
+		if err != nil {
+			return nil, err
+		}
+		file, err := OpenRotatingFile(path, int64(maxSize)<<20, int(backups))
+		if err != nil {
+			return nil, err
+		}
+		out = file
+	}
+	return NewAccessLogger(out, format, redaction)
+}
+
+// Close closes the log file, if the logger writes to one
+func (l *AccessLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if file, ok := l.out.(*RotatingFile); ok {
+		return file.Close()
+	}
+	return nil
+}
+
+// SetAccessLogger enables access logging of viewer requests
+func (h *Handlers) SetAccessLogger(logger *AccessLogger) {
+	h.accessLog = logger
+}
+
+// WithAccessLog wraps a viewer handler so each request is access-logged
+func (h *Handlers) WithAccessLog(next http.HandlerFunc) http.HandlerFunc {
+	if h.accessLog == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &loggingResponseWriter{ResponseWriter: w}
+		next(lw, r)
+		h.accessLog.Log(&AccessLogEntry{
+			Time:      start,
+			RemoteIP:  h.clientIP(r).String(),
+			Method:    r.Method,
+			URL:       r.URL,
+			Proto:     r.Proto,
+			Status:    int(lw.status.Load()),
+			Bytes:     lw.bytes.Load(),
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+			Duration:  time.Since(start),
+		})
+	}
+}
+
+// AccessLogEntry describes one viewer request
+type AccessLogEntry struct {
+	Time      time.Time
+	RemoteIP  string
+	Method    string
+	URL       *url.URL
+	Proto     string
+	Status    int
+	Bytes     int64
+	Referer   string
+	UserAgent string
+	Duration  time.Duration
+}
+
+// accessLogJSON is the JSON lines record format
+type accessLogJSON struct {
+	Time       string `json:"time"`
+	RemoteIP   string `json:"remote_ip"`
+	SessionID  string `json:"session_id,omitempty"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Proto      string `json:"proto"`
+	Status     int    `json:"status"`
+	Bytes      int64  `json:"bytes"`
+	Referer    string `json:"referer,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Log writes an entry
+func (l *AccessLogger) Log(e *AccessLogEntry) {
+	path := l.redactURL(e.URL)
+	referer := l.redactReferer(e.Referer)
+	if e.Status == 0 {
+		e.Status = http.StatusOK
+	}
+
+	var line []byte
+	if l.format == AccessLogJSON {
+		sessionID, _, _ := strings.Cut(strings.TrimPrefix(e.URL.Path, "/"), "/")
+		line, _ = json.Marshal(&accessLogJSON{
+			Time:       e.Time.UTC().Format(time.RFC3339Nano),
+			RemoteIP:   e.RemoteIP,
+			SessionID:  sessionID,
+			Method:     e.Method,
+			Path:       path,
+			Proto:      e.Proto,
+			Status:     e.Status,
+			Bytes:      e.Bytes,
+			Referer:    referer,
+			UserAgent:  e.UserAgent,
+			DurationMS: e.Duration.Milliseconds(),
+		})
+	} else {
+		size := "-"
+		if e.Bytes > 0 {
+			size = fmt.Sprint(e.Bytes)
+		}
+		line = fmt.Appendf(nil, `%s - - [%s] "%s %s %s" %d %s "%s" "%s"`,
+			orDash(e.RemoteIP), e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			e.Method, path, e.Proto, e.Status, size,
+			clfEscape(orDash(referer)), clfEscape(orDash(e.UserAgent)))
+	}
+
+	l.mu.Lock()
+	l.out.Write(append(line, '\n'))
+	l.mu.Unlock()
+}
+
+// redactURL applies the path redaction to a viewer URL. Link and signed URL
+// tokens are credentials, so they are masked in every mode.
+func (l *AccessLogger) redactURL(u *url.URL) string {
+	sessionID, rest, found := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if !found {
+		return "/" + sessionID
+	}
+	rest = "/" + rest
+
+	// Mask /t/{token}/ and /s/{token}/ prefixes
+	prefix := ""
+	if strings.HasPrefix(rest, accessLinkPrefix) || strings.HasPrefix(rest, signedURLPrefix) {
+		kind := rest[:3]
+		_, after, _ := strings.Cut(rest[3:], "/")
+		prefix = kind + "REDACTED"
+		rest = "/" + after
+	}
+
+	switch l.redaction {
+	case RedactKeep:
+		if u.RawQuery != "" {
+			rest += "?" + u.RawQuery
+		}
+	case RedactTruncate:
+		if first, _, more := strings.Cut(strings.TrimPrefix(rest, "/"), "/"); more {
+			rest = "/" + first + "/..."
+		}
+	default:
+		if rest != "/" {
+			rest = "/#" + pathHash(rest)
+		}
+	}
+	return "/" + sessionID + prefix + rest
+}
+
+// redactReferer reduces a referer to its origin unless paths are kept,
+// since it may be another share URL
+func (l *AccessLogger) redactReferer(referer string) string {
+	if referer == "" || l.redaction == RedactKeep {
+		return referer
+	}
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + "/"
+}
+
+// orDash returns "-" for empty CLF fields
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// clfEscape escapes quotes and backslashes in quoted CLF fields
+func clfEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// ============================================================================
+// Log Rotation
+// ============================================================================
+
+// RotatingFile is an append-only file that rotates to path.1, path.2, ...
+// once it exceeds maxSize bytes, keeping at most backups old files
+type RotatingFile struct {
+	path    string
+	maxSize int64
+	backups int
+	maxAge  time.Duration // Delete backups older than this on rotation (0 to keep)
+	file    *os.File
+	size    int64
+	closed  bool
+	mu      sync.Mutex
+}
+
+// OpenRotatingFile opens (or creates) a rotating log file
+func OpenRotatingFile(path string, maxSize int64, backups int) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, maxSize: maxSize, backups: backups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// SetMaxAge deletes rotated files last written more than maxAge ago,
+// checked now and whenever the file rotates
+func (rf *RotatingFile) SetMaxAge(maxAge time.Duration) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	rf.maxAge = maxAge
+	rf.removeOldBackups()
+}
+
+// removeOldBackups applies the maximum age to rotated files
+func (rf *RotatingFile) removeOldBackups() {
+	if rf.maxAge <= 0 {
+		return
+	}
+	for i := 1; i <= rf.backups; i++ {
+		name := fmt.Sprintf("%s.%d", rf.path, i)
+		if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > rf.maxAge {
+			os.Remove(name)
+		}
+	}
+}
+
+// open opens the current log file for appending
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file = file
+	rf.size = info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if it would exceed the size limit
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.closed {
+		return 0, os.ErrClosed
+	}
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate shifts path.N to path.N+1, dropping the oldest, and starts a new file
+func (rf *RotatingFile) rotate() error {
+	rf.file.Close()
+	if rf.backups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.backups))
+		for i := rf.backups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+		}
+		os.Rename(rf.path, rf.path+".1")
+		rf.removeOldBackups()
+	} else {
+		os.Remove(rf.path)
+	}
+	return rf.open()
+}
+
+// Close closes the current log file. Later writes fail with os.ErrClosed.
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.closed {
+		return nil
+	}
+	rf.closed = true
+	return rf.file.Close()
+}
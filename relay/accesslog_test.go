@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAccessLog_PathRedaction checks each redaction mode, and that link and
+// signed URL tokens are masked in all of them
+func TestAccessLog_PathRedaction(t *testing.T) {
+	cases := []struct {
+		redaction PathRedaction
+		path      string
+		want      string
+	}{
+		{RedactKeep, "/abc123def456/docs/plan.pdf?dl=1", "/abc123def456/docs/plan.pdf?dl=1"},
+		{RedactTruncate, "/abc123def456/docs/plan.pdf", "/abc123def456/docs/..."},
+		{RedactTruncate, "/abc123def456/readme.md", "/abc123def456/readme.md"},
+		{RedactHash, "/abc123def456/docs/plan.pdf", "/abc123def456/#" + pathHash("/docs/plan.pdf")},
+		{RedactHash, "/abc123def456/", "/abc123def456/"},
+		{RedactHash, "/abc123def456", "/abc123def456"},
+		{RedactKeep, "/abc123def456/t/secrettoken/plan.pdf", "/abc123def456/t/REDACTED/plan.pdf"},
+		{RedactTruncate, "/abc123def456/s/1.a.b/docs/plan.pdf", "/abc123def456/s/REDACTED/docs/..."},
+	}
+	for _, c := range cases {
+		l, _ := NewAccessLogger(&bytes.Buffer{}, AccessLogCombined, c.redaction)
+		u, _ := url.Parse(c.path)
+		if got := l.redactURL(u); got != c.want {
+			t.Errorf("%s %q: got %q, want %q", c.redaction, c.path, got, c.want)
+		}
+	}
+}
+
+// TestAccessLog_CombinedFormat checks the Combined Log Format line
+func TestAccessLog_CombinedFormat(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := NewAccessLogger(&buf, AccessLogCombined, RedactTruncate)
+	u, _ := url.Parse("/abc123def456/docs/plan.pdf")
+	l.Log(&AccessLogEntry{
+		Time:      time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+		RemoteIP:  "203.0.113.7",
+		Method:    "GET",
+		URL:       u,
+		Proto:     "HTTP/1.1",
+		Status:    200,
+		Bytes:     1234,
+		Referer:   "https://relay.example.com/abc123def456/docs/",
+		UserAgent: `curl/8.0 "quoted"`,
+	})
+
+	want := `203.0.113.7 - - [01/Mar/2024:12:30:00 +0000] "GET /abc123def456/docs/... HTTP/1.1" 200 1234 "https://relay.example.com/" "curl/8.0 \"quoted\""` + "\n"
+	if buf.String() != want {
+		t.Errorf("Got  %q\nwant %q", buf.String(), want)
+	}
+}
+
+// TestAccessLog_Middleware checks requests are logged as JSON lines
+func TestAccessLog_Middleware(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandlers(NewSessionStore("localhost:8080"))
+	l, _ := NewAccessLogger(&buf, AccessLogJSON, RedactHash)
+	h.SetAccessLogger(l)
+
+	handler := h.WithAccessLog(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+	r := httptest.NewRequest(http.MethodGet, "/abc123def456/secret.txt", nil)
+	r.RemoteAddr = "198.51.100.4:5555"
+	handler(httptest.NewRecorder(), r)
+
+	var record accessLogJSON
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a JSON line, got %q", buf.String())
+	}
+	if record.SessionID != "abc123def456" || record.Status != http.StatusTeapot || record.Bytes != 15 || record.RemoteIP != "198.51.100.4" {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Error("Expected file name to be redacted")
+	}
+}
+
+// TestRotatingFile checks the log rotates and keeps a bounded number of backups
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer rf.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	for name, want := range map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	} {
+		got, err := os.ReadFile(name)
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got %q (%v), want %q", filepath.Base(name), got, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Expected oldest backup to be dropped")
+	}
+
+	// Writes after Close fail rather than reopening the file on rotation
+	rf.Close()
+	if _, err := rf.Write([]byte("fifth\n")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Expected os.ErrClosed after Close, got %v", err)
+	}
+}
+
+// TestRotatingFile_MaxAge checks backups past the retention age are deleted
+func TestRotatingFile_MaxAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{path + ".1", path + ".2"} {
+		os.WriteFile(name, []byte("old\n"), 0640)
+	}
+	os.Chtimes(path+".2", old, old)
+
+	rf, err := OpenRotatingFile(path, 1<<20, 5)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer rf.Close()
+	rf.SetMaxAge(24 * time.Hour)
+
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Error("Expected recent backup to be kept")
+	}
+	if _, err := os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Error("Expected expired backup to be deleted")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// ============================================================================
+// Viewer Activity Feed
+// Tells CLIs that registered with activityFeed who is watching: viewers
+// opening and closing the share page, failing the password or being
+// refused. Viewers are identified by an anonymized ID derived from their IP
+// and user agent, so the sharer can follow one viewer across messages.
+// ============================================================================
+
+// SetActivityFeed turns the viewer activity feed on or off for a session
+func (s *SessionStore) SetActivityFeed(id string, enabled bool) error {
+	session := s.GetSession(id)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+
+	session.mu.Lock()
+	session.ActivityFeed = enabled
+	session.mu.Unlock()
+	return nil
+}
+
+// anonymousViewerID derives a viewer's anonymized ID. It is keyed with the
+// relay's secret and the session ID, so it can't be reversed to an IP or
+// linked across sessions.
+func (s *SessionStore) anonymousViewerID(sessionID, ip, userAgent string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte("viewer\x00" + sessionID + "\x00" + ip + "\x00" + userAgent))
+	return hex.EncodeToString(mac.Sum(nil)[:4])
+}
+
+// subscribeActivityFeed forwards viewer events to CLIs that asked for them
+func (s *SessionStore) subscribeActivityFeed() {
+	s.events.SubscribeAll(func(e Event) {
+		var session *Session
+		var msg *ViewerActivityMessage
+		switch e := e.(type) {
+		case ViewerJoinedEvent:
+			session = e.Session
+			msg = s.viewerActivity(TypeViewerJoined, session, e.Viewer.RemoteIP, e.Viewer.UserAgent)
+			msg.ViewerCount = session.liveViewerCount()
+		case ViewerLeftEvent:
+			session = e.Session
+			msg = s.viewerActivity(TypeViewerLeft, session, e.Viewer.RemoteIP, e.Viewer.UserAgent)
+			msg.ViewerCount = session.liveViewerCount()
+		case AuthFailedEvent:
+			session = e.Session
+			msg = s.viewerActivity(TypeAuthFailed, session, e.RemoteIP, e.UserAgent)
+			msg.Method = e.Method
+			msg.Attempts = e.Attempts
+		case AccessDeniedEvent:
+			session = e.Session
+			msg = s.viewerActivity(TypeAccessDenied, session, e.RemoteIP, e.UserAgent)
+			msg.Reason = e.Reason
+		default:
+			return
+		}
+		session.sendActivity(msg)
+	})
+}
+
+// viewerActivity starts an activity message about a viewer
+func (s *SessionStore) viewerActivity(msgType MessageType, session *Session, ip, userAgent string) *ViewerActivityMessage {
+	viewer := s.anonymousViewerID(session.ID, ip, userAgent)
+	return NewViewerActivityMessage(msgType, viewer, ip, userAgent, time.Now())
+}
+
+// liveViewerCount returns the number of connected live-update sockets
+func (s *Session) liveViewerCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.ViewerSockets)
+}
+
+// sendActivity sends an activity message to the CLI if it asked for the feed
+func (s *Session) sendActivity(msg *ViewerActivityMessage) {
+	msgBytes, err := SerializeMessage(msg)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ActivityFeed || s.WebSocket == nil {
+		return
+	}
+	if err := s.sendNotice(msgBytes); err != nil {
+		s.logger().Debug("Failed to send viewer activity", "type", msg.Type, "error", err)
+	}
+}
+
+// accessDenied publishes a refused viewer request for the session's activity
+// feed. The session may be unknown (sessionID empty or expired).
+func (h *Handlers) accessDenied(r *http.Request, sessionID, reason string) {
+	if sessionID == "" {
+		return
+	}
+	session := h.store.GetSession(sessionID)
+	if session == nil {
+		return
+	}
+	h.store.Events().Publish(AccessDeniedEvent{
+		Session:   session,
+		Reason:    reason,
+		RemoteIP:  h.clientIP(r).String(),
+		UserAgent: r.UserAgent(),
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readActivity reads the next message, which must be viewer activity of the given type
+func (c *testCLI) readActivity(msgType MessageType) *ViewerActivityMessage {
+	c.t.Helper()
+	msg, ok := c.read().(*ViewerActivityMessage)
+	if !ok || msg.Type != msgType {
+		c.t.Fatalf("Expected %s message, got %+v", msgType, msg)
+	}
+	return msg
+}
+
+// TestActivityFeed_ViewersAndAuthFailures checks the CLI hears about viewers
+// joining, leaving and failing the password
+func TestActivityFeed_ViewersAndAuthFailures(t *testing.T) {
+	relay := newTestRelay(t)
+	register := NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix())
+	register.Password = "hunter2"
+	register.ActivityFeed = true
+	cli := relay.connectCLI(t, register)
+
+	req, _ := http.NewRequest(http.MethodGet, relay.server.URL+"/"+cli.sessionID+"/", nil)
+	req.SetBasicAuth("viewer", "wrong")
+	req.Header.Set("User-Agent", "feed-test")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Viewer request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	failed := cli.readActivity(TypeAuthFailed)
+	if failed.IP != "127.0.0.1" || failed.UserAgent != "feed-test" || failed.Method != AuthMethodBasic || failed.Attempts != 1 {
+		t.Errorf("Unexpected authFailed message %+v", failed)
+	}
+	if failed.Viewer == "" || strings.Contains(failed.Viewer, "127.0.0.1") {
+		t.Errorf("Expected an anonymized viewer ID, got %q", failed.Viewer)
+	}
+
+	header := http.Header{"User-Agent": {"feed-test"}}
+	header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("viewer:hunter2")))
+	viewer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(relay.server.URL, "http")+"/viewer-ws/"+cli.sessionID, header)
+	if err != nil {
+		t.Fatalf("Failed to connect viewer: %v", err)
+	}
+	joined := cli.readActivity(TypeViewerJoined)
+	if joined.Viewer != failed.Viewer || joined.ViewerCount != 1 {
+		t.Errorf("Expected the same viewer to join, got %+v", joined)
+	}
+
+	viewer.Close()
+	if left := cli.readActivity(TypeViewerLeft); left.Viewer != failed.Viewer || left.ViewerCount != 0 {
+		t.Errorf("Unexpected viewerLeft message %+v", left)
+	}
+}
+
+// TestActivityFeed_AccessDenied checks refused viewers are reported, and only
+// to CLIs that asked for the feed
+func TestActivityFeed_AccessDenied(t *testing.T) {
+	relay := newTestRelay(t)
+	register := NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix())
+	register.DenyCIDRs = []string{"127.0.0.1"}
+	quiet := relay.connectCLI(t, register)
+	register.ActivityFeed = true
+	cli := relay.connectCLI(t, register)
+
+	for _, id := range []string{quiet.sessionID, cli.sessionID} {
+		resp, err := http.Get(relay.server.URL + "/" + id + "/")
+		if err != nil {
+			t.Fatalf("Viewer request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("Expected 403, got %d", resp.StatusCode)
+		}
+	}
+
+	if denied := cli.readActivity(TypeAccessDenied); denied.Reason != ErrCodeIPNotAllowed {
+		t.Errorf("Unexpected accessDenied message %+v", denied)
+	}
+
+	quiet.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := quiet.conn.ReadMessage(); err == nil {
+		t.Errorf("Expected no activity without the feed, got %s", data)
+	}
+}
+
+// TestAnonymousViewerID checks viewer IDs are stable within a session only
+func TestAnonymousViewerID(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	id := store.anonymousViewerID("a1b2c3d4e5f6", "203.0.113.7", "curl/8.0")
+	if len(id) != 8 || id != store.anonymousViewerID("a1b2c3d4e5f6", "203.0.113.7", "curl/8.0") {
+		t.Errorf("Expected a stable 8 character ID, got %q", id)
+	}
+	if id == store.anonymousViewerID("f6e5d4c3b2a1", "203.0.113.7", "curl/8.0") {
+		t.Error("Expected IDs to differ between sessions")
+	}
+	if id == store.anonymousViewerID("a1b2c3d4e5f6", "203.0.113.8", "curl/8.0") {
+		t.Error("Expected IDs to differ between viewers")
+	}
+}
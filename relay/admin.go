@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ============================================================================
+// Admin API
+// Lets operators inspect and manage sessions without restarting the relay.
+// Enabled by ADMIN_TOKEN and served under AdminPrefix, either on the main
+// listener or on a separate one (ADMIN_ADDR, e.g. 127.0.0.1:9090).
+// ============================================================================
+
+// AdminPrefix is where the admin API and dashboard are served
+const AdminPrefix = "/__admin__/"
+
+// adminAPIPrefix is the JSON API within AdminPrefix
+const adminAPIPrefix = AdminPrefix + "api/"
+
+// Error types for admin operations
+var (
+	ErrViewerNotFound = errors.New("viewer not found")
+	ErrExpiryInPast   = errors.New("expiry must be in the future")
+)
+
+// AdminConfig configures the admin API
+type AdminConfig struct {
+	Token string // Required bearer token
+	Addr  string // Separate listen address (empty to share the main listener)
+}
+
+// AdminConfigFromEnv reads ADMIN_TOKEN and ADMIN_ADDR.
+// Returns nil if ADMIN_TOKEN is unset (admin API disabled).
+func AdminConfigFromEnv() (*AdminConfig, error) {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		if os.Getenv("ADMIN_ADDR") != "" {
+			return nil, errors.New("ADMIN_ADDR requires ADMIN_TOKEN")
+		}
+		return nil, nil
+	}
+	if len(token) < 16 {
+		return nil, errors.New("ADMIN_TOKEN must be at least 16 characters")
+	}
+	return &AdminConfig{Token: token, Addr: os.Getenv("ADMIN_ADDR")}, nil
+}
+
+// SessionInfo is a session as reported by the admin API
+type SessionInfo struct {
+	ID              string       `json:"id"`
+	URL             string       `json:"url"`
+	CreatedAt       time.Time    `json:"createdAt"`
+	ExpiresAt       time.Time    `json:"expiresAt"`
+	ViewerCount     int          `json:"viewerCount"`
+	MaxViewers      int          `json:"maxViewers"`
+	Viewers         []ViewerInfo `json:"viewers"`
+	PendingRequests int          `json:"pendingRequests"`
+	BytesSent       int64        `json:"bytesSent"`
+	HasPassword     bool         `json:"hasPassword"`
+	OIDC            bool         `json:"oidc"`
+	APIKey          string       `json:"apiKey,omitempty"`
+	Paused          bool         `json:"paused"`
+}
+
+// ViewerInfo is a connected viewer socket as reported by the admin API
+type ViewerInfo struct {
+	ID          string    `json:"id"`
+	RemoteIP    string    `json:"remoteIp"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// ExpiryUpdate is the body of a session PATCH: an absolute expiry,
+// or a number of seconds to extend by (negative to shorten)
+type ExpiryUpdate struct {
+	ExpiresAt int64 `json:"expiresAt,omitempty"` // Unix timestamp
+	ExtendBy  int64 `json:"extendBy,omitempty"`  // Seconds
+}
+
+// ListSessions returns all live sessions, oldest first
+func (s *SessionStore) ListSessions() []*Session {
+	s.mu.RLock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions
+}
+
+// SessionInfo describes a session for the admin API
+func (s *SessionStore) SessionInfo(session *Session) *SessionInfo {
+	session.mu.Lock()
+	info := &SessionInfo{
+		ID:              session.ID,
+		URL:             s.GenerateURL(session.ID),
+		CreatedAt:       session.CreatedAt,
+		ExpiresAt:       session.ExpiresAt,
+		ViewerCount:     session.ViewerCount,
+		MaxViewers:      session.MaxViewers,
+		Viewers:         make([]ViewerInfo, 0, len(session.ViewerSockets)),
+		PendingRequests: len(session.PendingReqs),
+		HasPassword:     len(session.PasswordHash) > 0,
+		OIDC:            len(session.OIDCAllow) > 0,
+		Paused:          session.Paused,
+	}
+	if session.APIKey != nil {
+		info.APIKey = session.APIKey.Name
+	}
+	for _, viewer := range session.ViewerSockets {
+		info.Viewers = append(info.Viewers, ViewerInfo{
+			ID:          viewer.ID,
+			RemoteIP:    viewer.RemoteIP,
+			ConnectedAt: viewer.ConnectedAt,
+		})
+	}
+	session.mu.Unlock()
+
+	info.BytesSent = session.BytesSent.Load()
+	sort.Slice(info.Viewers, func(i, j int) bool {
+		return info.Viewers[i].ConnectedAt.Before(info.Viewers[j].ConnectedAt)
+	})
+	return info
+}
+
+// SetExpiry changes when a session expires. Access tokens, links and
+// signed URLs already issued keep their own (earlier) expiry.
+func (s *SessionStore) SetExpiry(id string, expiresAt time.Time) error {
+	session := s.GetSession(id)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+	if !expiresAt.After(time.Now()) {
+		return ErrExpiryInPast
+	}
+	if err := s.checkMaxDuration(session.CreatedAt, expiresAt); err != nil {
+		return err
+	}
+
+	session.mu.Lock()
+	session.ExpiresAt = expiresAt
+	session.mu.Unlock()
+
+	s.events.Publish(SessionExpiryChangedEvent{Session: session, ExpiresAt: expiresAt})
+	return nil
+}
+
+// KickViewer disconnects a viewer's live-update socket
+func (s *SessionStore) KickViewer(sessionID, viewerID string) error {
+	session := s.GetSession(sessionID)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+
+	session.mu.Lock()
+	var target *websocket.Conn
+	for conn, viewer := range session.ViewerSockets {
+		if viewer.ID == viewerID {
+			target = conn
+			break
+		}
+	}
+	session.mu.Unlock()
+
+	if target == nil {
+		return ErrViewerNotFound
+	}
+	// The viewer's handler notices the closed socket and cleans up
+	target.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "disconnected by administrator"),
+		time.Now().Add(time.Second))
+	target.Close()
+	return nil
+}
+
+// AdminHandler serves the admin API and dashboard. API requests need token
+// as a bearer token or a dashboard login cookie.
+func (h *Handlers) AdminHandler(token string) http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("GET "+adminAPIPrefix+"sessions", h.handleAdminListSessions)
+	api.HandleFunc("GET "+adminAPIPrefix+"sessions/{id}", h.handleAdminGetSession)
+	api.HandleFunc("PATCH "+adminAPIPrefix+"sessions/{id}", h.handleAdminUpdateSession)
+	api.HandleFunc("DELETE "+adminAPIPrefix+"sessions/{id}", h.handleAdminExpireSession)
+	api.HandleFunc("DELETE "+adminAPIPrefix+"sessions/{id}/viewers/{viewer}", h.handleAdminKickViewer)
+	api.HandleFunc("GET "+adminAPIPrefix+"events", h.handleAdminEvents)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+AdminPrefix+"{$}", h.handleDashboard(token))
+	mux.HandleFunc("POST "+AdminPrefix+"login", h.handleDashboardLogin(token))
+	mux.HandleFunc("POST "+AdminPrefix+"logout", h.handleDashboardLogout)
+	mux.Handle(adminAPIPrefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !adminAuthorized(r, token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="fwdcast admin"`)
+			writeAdminError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Admin token required")
+			return
+		}
+		api.ServeHTTP(w, r)
+	}))
+	return mux
+}
+
+// handleAdminListSessions lists all sessions
+func (h *Handlers) handleAdminListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions := h.store.ListSessions()
+	infos := make([]*SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, h.store.SessionInfo(session))
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// handleAdminGetSession describes one session
+func (h *Handlers) handleAdminGetSession(w http.ResponseWriter, r *http.Request) {
+	session := h.store.GetSession(r.PathValue("id"))
+	if session == nil {
+		writeAdminError(w, http.StatusNotFound, ErrCodeNotFound, ErrSessionNotFound.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, h.store.SessionInfo(session))
+}
+
+// handleAdminUpdateSession extends or shortens a session's expiry
+func (h *Handlers) handleAdminUpdateSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	session := h.store.GetSession(id)
+	if session == nil {
+		writeAdminError(w, http.StatusNotFound, ErrCodeNotFound, ErrSessionNotFound.Error())
+		return
+	}
+
+	var update ExpiryUpdate
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&update); err != nil {
+		writeAdminError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid JSON body")
+		return
+	}
+
+	var expiresAt time.Time
+	switch {
+	case update.ExpiresAt != 0 && update.ExtendBy != 0:
+		writeAdminError(w, http.StatusBadRequest, ErrCodeBadRequest, "Set either expiresAt or extendBy, not both")
+		return
+	case update.ExpiresAt != 0:
+		expiresAt = time.Unix(update.ExpiresAt, 0)
+	case update.ExtendBy != 0:
+		expiresAt = session.expiry().Add(time.Duration(update.ExtendBy) * time.Second)
+	default:
+		writeAdminError(w, http.StatusBadRequest, ErrCodeBadRequest, "Set expiresAt or extendBy")
+		return
+	}
+
+	if err := h.store.SetExpiry(id, expiresAt); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			writeAdminError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+			return
+		}
+		writeAdminError(w, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+	session.logger().Info("Session expiry changed by admin", "expires_at", expiresAt)
+	writeJSON(w, http.StatusOK, h.store.SessionInfo(session))
+}
+
+// handleAdminExpireSession ends a session immediately
+func (h *Handlers) handleAdminExpireSession(w http.ResponseWriter, r *http.Request) {
+	session := h.store.GetSession(r.PathValue("id"))
+	if session == nil {
+		writeAdminError(w, http.StatusNotFound, ErrCodeNotFound, ErrSessionNotFound.Error())
+		return
+	}
+	session.logger().Info("Session expired by admin")
+	h.store.ExpireSession(session.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminKickViewer disconnects one viewer socket
+func (h *Handlers) handleAdminKickViewer(w http.ResponseWriter, r *http.Request) {
+	err := h.store.KickViewer(r.PathValue("id"), r.PathValue("viewer"))
+	switch {
+	case errors.Is(err, ErrSessionNotFound), errors.Is(err, ErrViewerNotFound):
+		writeAdminError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+		return
+	}
+	slog.Info("Viewer kicked by admin", "session_id", r.PathValue("id"), "viewer_id", r.PathValue("viewer"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeAdminError writes a JSON error for the admin API
+func writeAdminError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, &ErrorResponse{Code: code, Status: status, Message: message})
+}
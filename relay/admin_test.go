@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const testAdminToken = "test-admin-token-0123456789"
+
+// adminRequest calls the admin API with the test token
+func adminRequest(t *testing.T, h *Handlers, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, adminAPIPrefix+path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	h.AdminHandler(testAdminToken).ServeHTTP(w, r)
+	return w
+}
+
+// TestAdmin_RequiresToken checks the admin API refuses missing or wrong tokens
+func TestAdmin_RequiresToken(t *testing.T) {
+	h := NewHandlers(NewSessionStore("localhost:8080"))
+	for _, auth := range []string{"", "Bearer wrong-token", "Basic " + testAdminToken} {
+		r := httptest.NewRequest(http.MethodGet, adminAPIPrefix+"sessions", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.AdminHandler(testAdminToken).ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected 401, got %d", auth, w.Code)
+		}
+	}
+}
+
+// TestAdmin_ListAndInspect checks sessions are listed with their state
+func TestAdmin_ListAndInspect(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	h := NewHandlers(store)
+	first, _ := store.CreateSessionWithPassword(nil, time.Now().Add(30*time.Minute), "hunter2")
+	store.CreateSession(nil, time.Now().Add(time.Hour))
+	first.BytesSent.Add(1234)
+
+	w := adminRequest(t, h, http.MethodGet, "sessions", "")
+	var infos []SessionInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &infos); err != nil || len(infos) != 2 {
+		t.Fatalf("Expected 2 sessions, got %s", w.Body.String())
+	}
+	if infos[0].ID != first.ID || !infos[0].HasPassword || infos[0].BytesSent != 1234 {
+		t.Errorf("Unexpected first session: %+v", infos[0])
+	}
+
+	w = adminRequest(t, h, http.MethodGet, "sessions/"+first.ID, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), first.ID) {
+		t.Errorf("Expected session details, got %d %s", w.Code, w.Body.String())
+	}
+	if w := adminRequest(t, h, http.MethodGet, "sessions/000000000000", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown session, got %d", w.Code)
+	}
+}
+
+// TestAdmin_UpdateExpiry checks sessions can be extended and shortened
+func TestAdmin_UpdateExpiry(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	h := NewHandlers(store)
+	expiresAt := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	session, _ := store.CreateSession(nil, expiresAt)
+
+	adminRequest(t, h, http.MethodPatch, "sessions/"+session.ID, `{"extendBy": 600}`)
+	if got := session.expiry(); !got.Equal(expiresAt.Add(10 * time.Minute)) {
+		t.Errorf("Expected expiry extended by 10 minutes, got %v", got)
+	}
+
+	adminRequest(t, h, http.MethodPatch, "sessions/"+session.ID, `{"extendBy": -1200}`)
+	if got := session.expiry(); !got.Equal(expiresAt.Add(-10 * time.Minute)) {
+		t.Errorf("Expected expiry shortened by 20 minutes, got %v", got)
+	}
+
+	for _, body := range []string{`{"extendBy": -7200}`, `{}`, `{"expiresAt": 1, "extendBy": 1}`, `not json`} {
+		if w := adminRequest(t, h, http.MethodPatch, "sessions/"+session.ID, body); w.Code != http.StatusBadRequest {
+			t.Errorf("Body %s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
+
+// TestAdmin_ExpireSessionAndKickViewer checks sessions can be ended and viewers disconnected
+func TestAdmin_ExpireSessionAndKickViewer(t *testing.T) {
+	relay := newTestRelay(t)
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+
+	viewer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(relay.server.URL, "http")+"/viewer-ws/"+cli.sessionID, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect viewer: %v", err)
+	}
+	defer viewer.Close()
+	viewer.ReadMessage() // init
+
+	info := relay.store.SessionInfo(relay.store.GetSession(cli.sessionID))
+	if len(info.Viewers) != 1 {
+		t.Fatalf("Expected 1 viewer, got %+v", info.Viewers)
+	}
+	w := adminRequest(t, relay.handlers, http.MethodDelete, "sessions/"+cli.sessionID+"/viewers/"+info.Viewers[0].ID, "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d %s", w.Code, w.Body.String())
+	}
+	viewer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := viewer.ReadMessage(); err != nil {
+			break // Disconnected
+		}
+	}
+
+	w = adminRequest(t, relay.handlers, http.MethodDelete, "sessions/"+cli.sessionID, "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", w.Code)
+	}
+	if _, ok := cli.read().(*ExpiredMessage); !ok {
+		t.Error("Expected CLI to be told the session expired")
+	}
+	if relay.store.SessionExists(cli.sessionID) {
+		t.Error("Expected session to be removed")
+	}
+}
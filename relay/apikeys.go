@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// CLI Registration API Keys
+// When API_KEYS_FILE is set, /ws only accepts CLIs presenting a known key,
+// and each key's sessions are held to its limits.
+// ============================================================================
+
+// APIKeyHeader is the alternative to "Authorization: Bearer" for presenting a key
+const APIKeyHeader = "X-Fwdcast-Api-Key"
+
+// Registration rejection codes sent to the CLI in rejected messages
+const (
+	RejectUnauthorized     = "unauthorized"
+	RejectTooManySessions  = "too_many_sessions"
+	RejectDurationExceeded = "duration_exceeded"
+	RejectInvalidRequest   = "invalid_request"
+	RejectUnavailable      = "unavailable"
+)
+
+// APIKey is a key's entry in the key store file
+type APIKey struct {
+	Name               string `json:"name"`
+	Key                string `json:"key,omitempty"`                // Plaintext key
+	SHA256             string `json:"sha256,omitempty"`             // Or hex SHA-256 of the key
+	MaxSessions        int    `json:"maxSessions,omitempty"`        // Concurrent sessions, 0 = unlimited
+	MaxDurationMinutes int    `json:"maxDurationMinutes,omitempty"` // Session duration, 0 = unlimited
+	MaxBytesPerSecond  int64  `json:"maxBytesPerSecond,omitempty"`  // Per-session bandwidth, 0 = unlimited
+}
+
+// APIKeyStore holds the configured keys and tracks their active sessions
+type APIKeyStore struct {
+	keys   map[string]*APIKey // By hex SHA-256 of the key
+	active map[string]int     // Active session count by key name
+	mu     sync.Mutex
+}
+
+// apiKeyFile is the on-disk key store format
+type apiKeyFile struct {
+	Keys []*APIKey `json:"keys"`
+}
+
+// LoadAPIKeyStore reads a JSON key store file:
+//
+//	{"keys": [{"name": "ci", "sha256": "...", "maxSessions": 2,
+//	           "maxDurationMinutes": 60, "maxBytesPerSecond": 1048576}]}
+func LoadAPIKeyStore(path string) (*APIKeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file apiKeyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid key store %s: %w", path, err)
+	}
+
+	store := &APIKeyStore{
+		keys:   make(map[string]*APIKey),
+		active: make(map[string]int),
+	}
+	for i, key := range file.Keys {
+		if key.Name == "" {
+			return nil, fmt.Errorf("key %d in %s has no name", i, path)
+		}
+		hash := strings.ToLower(key.SHA256)
+		if key.Key != "" {
+			hash = hashAPIKey(key.Key)
+		}
+		if len(hash) != sha256.Size*2 {
+			return nil, fmt.Errorf("key %q in %s needs a key or a hex sha256", key.Name, path)
+		}
+		if _, dup := store.keys[hash]; dup {
+			return nil, fmt.Errorf("key %q in %s is a duplicate", key.Name, path)
+		}
+		store.keys[hash] = key
+	}
+	return store, nil
+}
+
+// APIKeyStoreFromEnv loads the key store named by API_KEYS_FILE.
+// Returns nil if unset (anonymous registration allowed).
+func APIKeyStoreFromEnv() (*APIKeyStore, error) {
+	path := os.Getenv("API_KEYS_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	return LoadAPIKeyStore(path)
+}
+
+// hashAPIKey returns the hex SHA-256 of a key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup returns the key entry for a presented key, or nil if unknown
+func (s *APIKeyStore) Lookup(key string) *APIKey {
+	if key == "" {
+		return nil
+	}
+	return s.keys[hashAPIKey(key)]
+}
+
+// Acquire reserves a concurrent session slot for a key.
+// Returns false if the key is at its MaxSessions limit.
+func (s *APIKeyStore) Acquire(key *APIKey) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key.MaxSessions > 0 && s.active[key.Name] >= key.MaxSessions {
+		return false
+	}
+	s.active[key.Name]++
+	return true
+}
+
+// Release frees a session slot reserved with Acquire
+func (s *APIKeyStore) Release(key *APIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active[key.Name] > 0 {
+		s.active[key.Name]--
+	}
+}
+
+// ActiveSessions returns the number of sessions currently using a key
+func (s *APIKeyStore) ActiveSessions(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active[name]
+}
+
+// CheckDuration returns an error if a session ending at expiresAt exceeds the key's limit
+func (k *APIKey) CheckDuration(expiresAt time.Time) error {
+	return k.CheckDurationFrom(time.Now(), expiresAt)
+}
+
+// CheckDurationFrom returns an error if a session that started at start and
+// ends at expiresAt exceeds the key's limit
+func (k *APIKey) CheckDurationFrom(start, expiresAt time.Time) error {
+	if k.MaxDurationMinutes <= 0 {
+		return nil
+	}
+	limit := time.Duration(k.MaxDurationMinutes) * time.Minute
+	if expiresAt.Sub(start) > limit+time.Minute { // Allow for clock skew
+		return fmt.Errorf("session duration exceeds this key's limit of %d minutes", k.MaxDurationMinutes)
+	}
+	return nil
+}
+
+// SetAPIKeyStore requires CLIs to present a key from store when registering
+func (h *Handlers) SetAPIKeyStore(store *APIKeyStore) {
+	h.apiKeys = store
+}
+
+// SetAPIKey records the key a session registered with and applies its bandwidth limit
+func (s *SessionStore) SetAPIKey(id string, key *APIKey) error {
+	session := s.GetSession(id)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+
+	session.mu.Lock()
+	session.APIKey = key
+	if key.MaxBytesPerSecond > 0 {
+		session.Bandwidth = newBandwidthLimiter(key.MaxBytesPerSecond)
+	}
+	session.mu.Unlock()
+	return nil
+}
+
+// apiKeyFromRequest extracts a key from the WebSocket upgrade request
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	if token, ok := bearerToken(r); ok {
+		return token
+	}
+	return ""
+}
+
+// ============================================================================
+// Bandwidth Limiting
+// ============================================================================
+
+// bandwidthLimiter is a token bucket limiting bytes per second,
+// with a burst of one second's worth of bytes
+type bandwidthLimiter struct {
+	rate   float64 // Bytes per second
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+// newBandwidthLimiter creates a limiter allowing bytesPerSecond
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	return &bandwidthLimiter{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes n bytes from the bucket and returns how long the caller
+// must wait before sending them
+func (l *bandwidthLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// Wait blocks until n bytes may be sent
+func (l *bandwidthLimiter) Wait(n int) {
+	if l == nil {
+		return
+	}
+	if delay := l.reserve(n); delay > 0 {
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeKeyStore writes a key store file for a test
+func writeKeyStore(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write key store: %v", err)
+	}
+	return path
+}
+
+// TestLoadAPIKeyStore checks plaintext and hashed keys are both accepted
+func TestLoadAPIKeyStore(t *testing.T) {
+	path := writeKeyStore(t, `{"keys": [
+		{"name": "alice", "key": "alice-secret"},
+		{"name": "ci", "sha256": "`+hashAPIKey("ci-secret")+`", "maxSessions": 1}
+	]}`)
+
+	store, err := LoadAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("Failed to load key store: %v", err)
+	}
+	if key := store.Lookup("alice-secret"); key == nil || key.Name != "alice" {
+		t.Errorf("Expected plaintext key to resolve to alice, got %v", key)
+	}
+	if key := store.Lookup("ci-secret"); key == nil || key.Name != "ci" {
+		t.Errorf("Expected hashed key to resolve to ci, got %v", key)
+	}
+	if store.Lookup("wrong") != nil || store.Lookup("") != nil {
+		t.Error("Expected unknown and empty keys to be refused")
+	}
+}
+
+// TestLoadAPIKeyStore_Invalid checks malformed key stores are refused at startup
+func TestLoadAPIKeyStore_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"not json":  `{"keys": [`,
+		"no name":   `{"keys": [{"key": "secret"}]}`,
+		"no key":    `{"keys": [{"name": "alice"}]}`,
+		"bad hash":  `{"keys": [{"name": "alice", "sha256": "abc"}]}`,
+		"duplicate": `{"keys": [{"name": "a", "key": "secret"}, {"name": "b", "key": "secret"}]}`,
+	}
+	for name, content := range cases {
+		if _, err := LoadAPIKeyStore(writeKeyStore(t, content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// TestAPIKeyStore_SessionLimit checks concurrent sessions are capped per key
+func TestAPIKeyStore_SessionLimit(t *testing.T) {
+	store, err := LoadAPIKeyStore(writeKeyStore(t, `{"keys": [{"name": "ci", "key": "ci-secret", "maxSessions": 2}]}`))
+	if err != nil {
+		t.Fatalf("Failed to load key store: %v", err)
+	}
+	key := store.Lookup("ci-secret")
+
+	if !store.Acquire(key) || !store.Acquire(key) {
+		t.Fatal("Expected two sessions to be allowed")
+	}
+	if store.Acquire(key) {
+		t.Error("Expected third session to be refused")
+	}
+	store.Release(key)
+	if !store.Acquire(key) {
+		t.Error("Expected a released slot to be reusable")
+	}
+	if got := store.ActiveSessions("ci"); got != 2 {
+		t.Errorf("Expected 2 active sessions, got %d", got)
+	}
+}
+
+// TestAPIKey_CheckDuration checks the per-key session duration limit
+func TestAPIKey_CheckDuration(t *testing.T) {
+	key := &APIKey{Name: "ci", MaxDurationMinutes: 60}
+	if err := key.CheckDuration(time.Now().Add(time.Hour)); err != nil {
+		t.Errorf("Expected 60 minutes to be allowed, got %v", err)
+	}
+	if err := key.CheckDuration(time.Now().Add(2 * time.Hour)); err == nil {
+		t.Error("Expected 120 minutes to be refused")
+	}
+
+	unlimited := &APIKey{Name: "admin"}
+	if err := unlimited.CheckDuration(time.Now().Add(24 * time.Hour)); err != nil {
+		t.Errorf("Expected no limit, got %v", err)
+	}
+}
+
+// TestAPIKeyFromRequest checks both ways a CLI can present its key
+func TestAPIKeyFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/ws", nil)
+	r.Header.Set(APIKeyHeader, "header-key")
+	if got := apiKeyFromRequest(r); got != "header-key" {
+		t.Errorf("Expected header key, got %q", got)
+	}
+
+	r = httptest.NewRequest("GET", "/ws", nil)
+	r.Header.Set("Authorization", "Bearer bearer-key")
+	if got := apiKeyFromRequest(r); got != "bearer-key" {
+		t.Errorf("Expected bearer key, got %q", got)
+	}
+}
+
+// TestBandwidthLimiter checks bursts beyond the rate are delayed
+func TestBandwidthLimiter(t *testing.T) {
+	l := newBandwidthLimiter(1000)
+	if delay := l.reserve(1000); delay != 0 {
+		t.Errorf("Expected first second's worth to pass immediately, got %v", delay)
+	}
+	delay := l.reserve(500)
+	if delay < 400*time.Millisecond || delay > 600*time.Millisecond {
+		t.Errorf("Expected ~500ms delay, got %v", delay)
+	}
+
+	var unlimited *bandwidthLimiter
+	unlimited.Wait(1 << 30) // Must not block or panic
+}
+
+// TestBandwidthLimit_DoesNotStallOtherRequests checks a throttled transfer
+// leaves the CLI connection free to serve the session's other requests
+func TestBandwidthLimit_DoesNotStallOtherRequests(t *testing.T) {
+	keys, err := LoadAPIKeyStore(writeKeyStore(t, `{"keys": [{"name": "ci", "key": "ci-secret", "maxBytesPerSecond": 1000}]}`))
+	if err != nil {
+		t.Fatalf("Failed to load key store: %v", err)
+	}
+	relay := newTestRelay(t)
+	relay.handlers.SetAPIKeyStore(keys)
+	register := NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix())
+	register.APIKey = "ci-secret"
+	cli := relay.connectCLI(t, register)
+
+	get := func(path string, done chan<- time.Duration) {
+		start := time.Now()
+		resp, err := http.Get(relay.server.URL + "/" + cli.sessionID + path)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		done <- time.Since(start)
+	}
+
+	// Three seconds' worth of data: held back for about two seconds
+	large := make(chan time.Duration, 1)
+	go get("/large.bin", large)
+	req := cli.read().(*RequestMessage)
+	cli.send(NewResponseMessage(req.ID, http.StatusOK, map[string]string{}))
+	cli.send(NewDataMessage(req.ID, base64.StdEncoding.EncodeToString(make([]byte, 3000))))
+	cli.send(NewEndMessage(req.ID))
+
+	small := make(chan time.Duration, 1)
+	go get("/empty.txt", small)
+	req = cli.read().(*RequestMessage)
+	cli.send(NewResponseMessage(req.ID, http.StatusOK, map[string]string{}))
+	cli.send(NewEndMessage(req.ID))
+
+	if elapsed := <-small; elapsed > time.Second {
+		t.Errorf("Expected the second request to be served promptly, took %v", elapsed)
+	}
+	if elapsed := <-large; elapsed < time.Second {
+		t.Errorf("Expected the large transfer to be throttled, took %v", elapsed)
+	}
+}
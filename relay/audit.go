@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Audit Log
+// An append-only JSON lines record of share activity, kept to answer "who
+// downloaded what from this share and when" after the fact. Unlike the
+// diagnostic and access logs, paths are recorded in full, so the file must
+// be protected accordingly. Fed from the event bus.
+// ============================================================================
+
+// Audit record types
+const (
+	AuditRegistered  = "registered"
+	AuditAuthSuccess = "auth_success"
+	AuditAuthFailure = "auth_failure"
+	AuditTransfer    = "transfer"
+)
+
+// Defaults for audit log rotation and retention
+const (
+	DefaultAuditLogMaxSizeMB  = 100
+	DefaultAuditLogMaxBackups = 30
+)
+
+// AuditRecord is one line of the audit log
+type AuditRecord struct {
+	Time       string `json:"time"`
+	Event      string `json:"event"`
+	SessionID  string `json:"session_id"`
+	ClientIP   string `json:"client_ip,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	APIKey     string `json:"api_key,omitempty"`     // Registrations
+	AuthMethod string `json:"auth_method,omitempty"` // Auth events
+	Identity   string `json:"identity,omitempty"`    // OIDC e-mail
+	RequestID  string `json:"request_id,omitempty"`  // Transfers
+	Method     string `json:"method,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Status     int    `json:"status,omitempty"`
+	Bytes      int64  `json:"bytes,omitempty"`
+	DurationMS int64  `json:"duration_ms,omitempty"`
+}
+
+// AuditLogger writes audit records
+type AuditLogger struct {
+	out io.Writer
+	mu  sync.Mutex
+}
+
+// NewAuditLogger creates an audit logger writing to out
+func NewAuditLogger(out io.Writer) *AuditLogger {
+	return &AuditLogger{out: out}
+}
+
+// AuditLoggerFromEnv creates the audit logger configured by AUDIT_LOG (a
+// file path, or "-" for stdout), AUDIT_LOG_MAX_SIZE_MB,
+// AUDIT_LOG_MAX_BACKUPS and AUDIT_LOG_MAX_AGE_DAYS.
+// Returns nil if AUDIT_LOG is unset.
+func AuditLoggerFromEnv() (*AuditLogger, error) {
+	path := os.Getenv("AUDIT_LOG")
+	if path == "" {
+		return nil, nil
+	}
+	if path == "-" {
+		return NewAuditLogger(os.Stdout), nil
+	}
+
+	maxSize, err := envUint("AUDIT_LOG_MAX_SIZE_MB", DefaultAuditLogMaxSizeMB, 32)
+	if err != nil {
+		return nil, err
+	}
+	backups, err := envUint("AUDIT_LOG_MAX_BACKUPS", DefaultAuditLogMaxBackups, 16)
+	if err != nil {
+		return nil, err
+	}
+	maxAgeDays, err := envUint("AUDIT_LOG_MAX_AGE_DAYS", 0, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := OpenRotatingFile(path, int64(maxSize)<<20, int(backups))
+	if err != nil {
+		return nil, err
+	}
+	file.SetMaxAge(time.Duration(maxAgeDays) * 24 * time.Hour)
+	return NewAuditLogger(file), nil
+}
+
+// Close closes the log file, if the logger writes to one
+func (l *AuditLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if file, ok := l.out.(*RotatingFile); ok {
+		return file.Close()
+	}
+	return nil
+}
+
+// SetAuditLogger records share activity in an audit log
+func (h *Handlers) SetAuditLogger(logger *AuditLogger) {
+	h.store.Events().SubscribeAll(logger.handleEvent)
+}
+
+// handleEvent writes the audit record for an event, if it has one
+func (l *AuditLogger) handleEvent(e Event) {
+	switch e := e.(type) {
+	case SessionRegisteredEvent:
+		record := &AuditRecord{
+			Event:     AuditRegistered,
+			SessionID: e.Session.ID,
+			ClientIP:  e.RemoteIP,
+			UserAgent: e.UserAgent,
+		}
+		e.Session.mu.Lock()
+		if e.Session.APIKey != nil {
+			record.APIKey = e.Session.APIKey.Name
+		}
+		e.Session.mu.Unlock()
+		l.Write(record)
+	case AuthSucceededEvent:
+		l.Write(&AuditRecord{
+			Event:      AuditAuthSuccess,
+			SessionID:  e.Session.ID,
+			ClientIP:   e.RemoteIP,
+			UserAgent:  e.UserAgent,
+			AuthMethod: e.Method,
+			Identity:   e.Identity,
+		})
+	case AuthFailedEvent:
+		l.Write(&AuditRecord{
+			Event:      AuditAuthFailure,
+			SessionID:  e.Session.ID,
+			ClientIP:   e.RemoteIP,
+			UserAgent:  e.UserAgent,
+			AuthMethod: e.Method,
+		})
+	case RequestFinishedEvent:
+		if !e.Forwarded {
+			return // Refused before reaching the share; see the access log
+		}
+		status := e.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		l.Write(&AuditRecord{
+			Time:       e.Start.UTC().Format(time.RFC3339Nano),
+			Event:      AuditTransfer,
+			SessionID:  e.SessionID,
+			ClientIP:   e.RemoteIP,
+			UserAgent:  e.UserAgent,
+			RequestID:  e.RequestID,
+			Method:     e.Method,
+			Path:       e.Path,
+			Status:     status,
+			Bytes:      e.Bytes,
+			DurationMS: e.Duration.Milliseconds(),
+		})
+	}
+}
+
+// Write appends a record, stamping it with the current time if unset
+func (l *AuditLogger) Write(record *AuditRecord) {
+	if record.Time == "" {
+		record.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	l.out.Write(append(line, '\n'))
+	l.mu.Unlock()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe to read while the relay writes to it
+type lockedBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records parses the audit lines written so far
+func (b *lockedBuffer) records(t *testing.T) []AuditRecord {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []AuditRecord
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// TestAuditLog_ShareActivity checks registrations, logins and transfers are recorded
+func TestAuditLog_ShareActivity(t *testing.T) {
+	relay := newTestRelay(t)
+	out := &lockedBuffer{}
+	relay.handlers.SetAuditLogger(NewAuditLogger(out))
+
+	register := NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix())
+	register.Password = "hunter2"
+	cli := relay.connectCLI(t, register)
+
+	get := func(password string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, relay.server.URL+"/"+cli.sessionID+"/report.pdf", nil)
+		req.SetBasicAuth("viewer", password)
+		req.Header.Set("User-Agent", "audit-test")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Viewer request failed: %v", err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := get("wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected 401, got %d", resp.StatusCode)
+	}
+	go cli.serve("%PDF")
+	get("hunter2")
+
+	var records []AuditRecord
+	deadline := time.Now().Add(5 * time.Second)
+	for records = out.records(t); len(records) < 4 && time.Now().Before(deadline); records = out.records(t) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	want := []string{AuditRegistered, AuditAuthFailure, AuditAuthSuccess, AuditTransfer}
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d records, got %+v", len(want), records)
+	}
+	for i, record := range records {
+		if record.Event != want[i] || record.SessionID != cli.sessionID || record.ClientIP != "127.0.0.1" {
+			t.Errorf("Record %d: unexpected %+v", i, record)
+		}
+	}
+	if records[1].AuthMethod != AuthMethodBasic || records[1].UserAgent != "audit-test" {
+		t.Errorf("Unexpected auth failure record %+v", records[1])
+	}
+	transfer := records[3]
+	if transfer.Path != "/report.pdf" || transfer.Status != http.StatusOK || transfer.Bytes != 4 || transfer.RequestID == "" {
+		t.Errorf("Unexpected transfer record %+v", transfer)
+	}
+}
+
+// TestAuditLoggerFromEnv checks the audit log is opened with its retention settings
+func TestAuditLoggerFromEnv(t *testing.T) {
+	if logger, err := AuditLoggerFromEnv(); logger != nil || err != nil {
+		t.Fatalf("Expected audit log disabled by default, got %v, %v", logger, err)
+	}
+
+	t.Setenv("AUDIT_LOG", t.TempDir()+"/audit.log")
+	t.Setenv("AUDIT_LOG_MAX_AGE_DAYS", "90")
+	if logger, err := AuditLoggerFromEnv(); logger == nil || err != nil {
+		t.Fatalf("Expected audit log, got %v, %v", logger, err)
+	}
+
+	t.Setenv("AUDIT_LOG_MAX_BACKUPS", "lots")
+	if _, err := AuditLoggerFromEnv(); err == nil {
+		t.Error("Expected error for invalid AUDIT_LOG_MAX_BACKUPS")
+	}
+}
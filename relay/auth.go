@@ -0,0 +1,258 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Scripted Access: HTTP Basic and Bearer Token Authentication
+// ============================================================================
+
+const (
+	// MaxFailedAttempts is how many wrong passwords are allowed before lockout
+	MaxFailedAttempts = 5
+
+	// AuthLockoutDuration is how long a session refuses logins after MaxFailedAttempts
+	AuthLockoutDuration = 30 * time.Second
+
+	// AuthTokenTTL is how long a relay-issued bearer token stays valid
+	AuthTokenTTL = time.Hour
+
+	// authTokenPath is the path (within a session) that issues bearer tokens
+	authTokenPath = "/__auth__/token"
+
+	// viewerSocketName is the last path segment of a viewer's live-update
+	// socket, opened from the directory of the page being viewed
+	viewerSocketName = "__ws__"
+)
+
+// ErrInvalidVerifier is returned when a registered password verifier cannot be used
+var ErrInvalidVerifier = errors.New("invalid password verifier")
+
+// AuthTokenResponse is returned by the token endpoint
+type AuthTokenResponse struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"` // Unix timestamp
+}
+
+// beginAuthAttempt checks the brute-force limiter before a password check.
+// Returns the number of seconds the caller must wait, or 0 if the attempt may proceed.
+func (s *Session) beginAuthAttempt() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.FailedAttempts >= MaxFailedAttempts {
+		timeSinceLastAttempt := time.Since(s.LastAttemptTime)
+		if timeSinceLastAttempt < AuthLockoutDuration {
+			return int((AuthLockoutDuration - timeSinceLastAttempt).Seconds()) + 1
+		}
+		// Reset after cooldown
+		s.FailedAttempts = 0
+	}
+	s.LastAttemptTime = time.Now()
+	return 0
+}
+
+// recordAuthFailure counts a failed attempt against the brute-force limiter
+// and returns the number of consecutive failures
+func (s *Session) recordAuthFailure() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.FailedAttempts++
+	return s.FailedAttempts
+}
+
+// recordAuthSuccess resets the brute-force limiter
+func (s *Session) recordAuthSuccess() {
+	s.mu.Lock()
+	s.FailedAttempts = 0
+	s.mu.Unlock()
+}
+
+// authSucceeded records a successful viewer login. Only password logins
+// reset the brute-force limiter.
+func (h *Handlers) authSucceeded(r *http.Request, session *Session, method string) {
+	if method != AuthMethodBearer {
+		session.recordAuthSuccess()
+	}
+	h.store.Events().Publish(AuthSucceededEvent{
+		Session:   session,
+		Method:    method,
+		RemoteIP:  h.clientIP(r).String(),
+		UserAgent: r.UserAgent(),
+	})
+}
+
+// authFailed records a wrong password or token. Only wrong passwords count
+// towards the lockout; relay-issued tokens are too long to guess.
+func (h *Handlers) authFailed(r *http.Request, session *Session, method string) {
+	attempts := 0
+	if method != AuthMethodBearer {
+		attempts = session.recordAuthFailure()
+	}
+	h.store.Events().Publish(AuthFailedEvent{
+		Session:   session,
+		Method:    method,
+		RemoteIP:  h.clientIP(r).String(),
+		UserAgent: r.UserAgent(),
+		Attempts:  attempts,
+	})
+}
+
+// checkPassword verifies a password against the session's stored hash
+func (s *Session) checkPassword(password string) bool {
+	return VerifyPassword(s.PasswordHash, []byte(password))
+}
+
+// issueAuthToken creates a new token for the session, used as a bearer token
+// or as the value of the login cookie. The token's expiry is not capped at the
+// session's: checkAuthToken checks the live session expiry, so tokens keep
+// working when the CLI extends the session.
+func (s *Session) issueAuthToken() (string, time.Time, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(bytes)
+
+	expiresAt := time.Now().Add(AuthTokenTTL)
+
+	s.mu.Lock()
+	s.AuthTokens[token] = expiresAt
+	s.mu.Unlock()
+
+	return token, expiresAt, nil
+}
+
+// checkAuthToken reports whether token is a valid, unexpired relay-issued token
+// for a session that has not expired
+func (s *Session) checkAuthToken(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.AuthTokens[token]
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	if now.After(s.ExpiresAt) {
+		return false
+	}
+	if now.After(expiresAt) {
+		delete(s.AuthTokens, token)
+		return false
+	}
+	return true
+}
+
+// authorizeHeader authenticates a request carrying an Authorization header.
+// Accepts "Basic" (any user name, share password) and relay-issued "Bearer" tokens.
+// Returns true if the request may proceed; otherwise the response has been written.
+// Only Basic credentials are rate-limited: bearer tokens keep working while
+// password logins are locked out.
+func (h *Handlers) authorizeHeader(w http.ResponseWriter, r *http.Request, session *Session) bool {
+	if token, isBearer := bearerToken(r); isBearer {
+		if !session.checkAuthToken(token) {
+			h.authFailed(r, session, AuthMethodBearer)
+			h.send401(w, r, session.ID, "Invalid credentials")
+			return false
+		}
+		h.authSucceeded(r, session, AuthMethodBearer)
+		return true
+	}
+
+	_, password, isBasic := r.BasicAuth()
+	if !isBasic {
+		h.send401(w, r, session.ID, "Unsupported authorization scheme")
+		return false
+	}
+
+	if wait := session.beginAuthAttempt(); wait > 0 {
+		h.sendRateLimitPage(w, r, session.ID, "/"+session.ID+"/", wait)
+		return false
+	}
+	if !session.checkPassword(password) {
+		h.authFailed(r, session, AuthMethodBasic)
+		h.send401(w, r, session.ID, "Invalid credentials")
+		return false
+	}
+
+	h.authSucceeded(r, session, AuthMethodBasic)
+	return true
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// handleTokenRequest issues a bearer token in exchange for the share password.
+// The password may be sent with Basic auth or as a "password" form field.
+func (h *Handlers) handleTokenRequest(w http.ResponseWriter, r *http.Request, session *Session) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if wait := session.beginAuthAttempt(); wait > 0 {
+		h.sendRateLimitPage(w, r, session.ID, "/"+session.ID+"/", wait)
+		return
+	}
+
+	_, password, ok := r.BasicAuth()
+	if !ok {
+		r.ParseForm()
+		password = r.FormValue("password")
+	}
+
+	if !session.checkPassword(password) {
+		h.authFailed(r, session, AuthMethodToken)
+		h.send401(w, r, session.ID, "Invalid credentials")
+		return
+	}
+	h.authSucceeded(r, session, AuthMethodToken)
+
+	token, expiresAt, err := session.issueAuthToken()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(&AuthTokenResponse{
+		Token:     token,
+		ExpiresAt: expiresAt.Unix(),
+	})
+}
+
+// send401 sends a 401 response challenging for Basic or Bearer credentials
+func (h *Handlers) send401(w http.ResponseWriter, r *http.Request, sessionID, message string) {
+	w.Header().Add("WWW-Authenticate", `Basic realm="fwdcast", charset="UTF-8"`)
+	w.Header().Add("WWW-Authenticate", `Bearer realm="fwdcast"`)
+	if sendNegotiatedError(w, r, &ErrorResponse{
+		Code:      ErrCodeUnauthorized,
+		Status:    http.StatusUnauthorized,
+		Message:   message,
+		SessionID: sessionID,
+	}) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(message + "\n"))
+}
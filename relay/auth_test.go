@@ -0,0 +1,356 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newProtectedSession creates a password-protected session without a CLI connection
+func newProtectedSession(t *testing.T, password string) (*Handlers, *Session) {
+	t.Helper()
+	store := NewSessionStore("localhost:8080")
+	session, err := store.CreateSessionWithPassword(nil, time.Now().Add(30*time.Minute), password)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	return NewHandlers(store), session
+}
+
+// TestAuthorizeHeader_Basic checks Basic auth with any user name and the share password
+func TestAuthorizeHeader_Basic(t *testing.T) {
+	h, session := newProtectedSession(t, "secret")
+
+	r := httptest.NewRequest(http.MethodGet, "/"+session.ID+"/file.txt", nil)
+	r.SetBasicAuth("anyone", "secret")
+	if !h.authorizeHeader(httptest.NewRecorder(), r, session) {
+		t.Fatal("Expected correct Basic credentials to be accepted")
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/"+session.ID+"/file.txt", nil)
+	r.SetBasicAuth("anyone", "wrong")
+	w := httptest.NewRecorder()
+	if h.authorizeHeader(w, r, session) {
+		t.Fatal("Expected wrong Basic credentials to be rejected")
+	}
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+	if len(w.Header().Values("WWW-Authenticate")) == 0 {
+		t.Error("Expected WWW-Authenticate challenge")
+	}
+}
+
+// TestAuthorizeHeader_SharedLimiter checks that header auth counts against the form login limiter
+func TestAuthorizeHeader_SharedLimiter(t *testing.T) {
+	h, session := newProtectedSession(t, "secret")
+
+	for i := 0; i < MaxFailedAttempts; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/"+session.ID+"/", nil)
+		r.SetBasicAuth("", "wrong")
+		h.authorizeHeader(httptest.NewRecorder(), r, session)
+	}
+
+	// Even the right password is refused during lockout
+	r := httptest.NewRequest(http.MethodGet, "/"+session.ID+"/", nil)
+	r.SetBasicAuth("", "secret")
+	w := httptest.NewRecorder()
+	if h.authorizeHeader(w, r, session) {
+		t.Fatal("Expected request to be refused during lockout")
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header during lockout")
+	}
+}
+
+// TestAuthorizeHeader_BearerBypassesLimiter checks that bearer tokens are
+// neither counted towards nor blocked by the password lockout
+func TestAuthorizeHeader_BearerBypassesLimiter(t *testing.T) {
+	h, session := newProtectedSession(t, "secret")
+	token, _, err := session.issueAuthToken()
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+
+	// Unknown tokens don't lock out password logins
+	for i := 0; i < MaxFailedAttempts; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/"+session.ID+"/", nil)
+		r.Header.Set("Authorization", "Bearer not-a-token")
+		h.authorizeHeader(httptest.NewRecorder(), r, session)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/"+session.ID+"/", nil)
+	r.SetBasicAuth("", "secret")
+	if !h.authorizeHeader(httptest.NewRecorder(), r, session) {
+		t.Fatal("Expected the password to be accepted after token misses")
+	}
+
+	// Valid tokens keep working during a password lockout
+	for i := 0; i < MaxFailedAttempts; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/"+session.ID+"/", nil)
+		r.SetBasicAuth("", "wrong")
+		h.authorizeHeader(httptest.NewRecorder(), r, session)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/"+session.ID+"/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if !h.authorizeHeader(httptest.NewRecorder(), r, session) {
+		t.Fatal("Expected the token to be accepted during lockout")
+	}
+	if wait := session.beginAuthAttempt(); wait == 0 {
+		t.Error("Expected the token not to lift the password lockout")
+	}
+}
+
+// TestAuthToken_FollowsSessionExpiry checks tokens outlive the session's
+// expiry at issue time when it is extended, and stop when it passes
+func TestAuthToken_FollowsSessionExpiry(t *testing.T) {
+	h, session := newProtectedSession(t, "secret")
+	token, expiresAt, err := session.issueAuthToken()
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	if !expiresAt.After(session.expiry()) {
+		t.Errorf("Expected the token to outlast the session's current expiry, got %v", expiresAt)
+	}
+
+	if err := h.store.SetExpiry(session.ID, time.Now().Add(50*time.Minute)); err != nil {
+		t.Fatalf("Failed to extend session: %v", err)
+	}
+	if !session.checkAuthToken(token) {
+		t.Error("Expected the token to work after the session was extended")
+	}
+
+	session.mu.Lock()
+	session.ExpiresAt = time.Now().Add(-time.Second)
+	session.mu.Unlock()
+	if session.checkAuthToken(token) {
+		t.Error("Expected the token to stop working once the session expired")
+	}
+}
+
+// TestBearerToken_IssueAndUse checks the token endpoint and bearer authentication
+func TestBearerToken_IssueAndUse(t *testing.T) {
+	h, session := newProtectedSession(t, "secret")
+
+	r := httptest.NewRequest(http.MethodPost, "/"+session.ID+authTokenPath,
+		strings.NewReader("password=secret"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.HandleViewerRequest(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var resp AuthTokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Token == "" {
+		t.Fatalf("Expected token in response, got %q (%v)", w.Body.String(), err)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/"+session.ID+"/", nil)
+	r.Header.Set("Authorization", "Bearer "+resp.Token)
+	if !h.authorizeHeader(httptest.NewRecorder(), r, session) {
+		t.Error("Expected issued token to be accepted")
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/"+session.ID+"/", nil)
+	r.Header.Set("Authorization", "Bearer not-a-token")
+	if h.authorizeHeader(httptest.NewRecorder(), r, session) {
+		t.Error("Expected unknown token to be rejected")
+	}
+}
+
+// TestHandleAuth_CookieHoldsToken checks a login sets a relay-issued token
+// as the auth cookie rather than the password
+func TestHandleAuth_CookieHoldsToken(t *testing.T) {
+	h, session := newProtectedSession(t, "secret")
+
+	r := httptest.NewRequest(http.MethodPost, "/"+session.ID+"/__auth__", strings.NewReader("password=secret"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.HandleViewerRequest(w, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected redirect after login, got %d", w.Code)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "fwdcast_auth_"+session.ID {
+		t.Fatalf("Expected the auth cookie, got %v", cookies)
+	}
+	if cookies[0].Value == "secret" || !session.checkAuthToken(cookies[0].Value) {
+		t.Errorf("Expected the cookie to hold an issued token, got %q", cookies[0].Value)
+	}
+
+	// A cookie holding the password is not a login
+	r = httptest.NewRequest(http.MethodGet, "/"+session.ID+"/file.txt", nil)
+	r.AddCookie(&http.Cookie{Name: "fwdcast_auth_" + session.ID, Value: "secret"})
+	w = httptest.NewRecorder()
+	h.HandleViewerRequest(w, r)
+	if w.Code != http.StatusFound || !strings.Contains(w.Header().Get("Location"), "__auth__") {
+		t.Errorf("Expected redirect to login, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+}
+
+// TestViewerSocket_RequiresAuth checks the live-update socket of a protected
+// share needs the same credentials as its pages
+func TestViewerSocket_RequiresAuth(t *testing.T) {
+	relay := newTestRelay(t)
+	register := NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix())
+	register.Password = "secret"
+	cli := relay.connectCLI(t, register)
+	session := relay.store.GetSession(cli.sessionID)
+	base := "ws" + strings.TrimPrefix(relay.server.URL, "http")
+
+	for _, path := range []string{"/viewer-ws/" + cli.sessionID, "/" + cli.sessionID + "/docs/" + viewerSocketName} {
+		if _, resp, err := websocket.DefaultDialer.Dial(base+path, nil); err == nil {
+			t.Errorf("%s: expected the socket to be refused without credentials", path)
+		} else if resp == nil || resp.StatusCode == http.StatusSwitchingProtocols {
+			t.Errorf("%s: expected an HTTP refusal, got %v", path, err)
+		}
+	}
+
+	// The share's auth cookie is sent to sockets opened under the share
+	token, _, err := session.issueAuthToken()
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	header := http.Header{"Cookie": {"fwdcast_auth_" + cli.sessionID + "=" + token}}
+	viewer, _, err := websocket.DefaultDialer.Dial(base+"/"+cli.sessionID+"/docs/"+viewerSocketName, header)
+	if err != nil {
+		t.Fatalf("Expected the logged-in viewer to connect: %v", err)
+	}
+	defer viewer.Close()
+
+	var init struct {
+		Type        string `json:"type"`
+		ViewerCount int    `json:"viewerCount"`
+	}
+	if err := viewer.ReadJSON(&init); err != nil || init.Type != "init" || init.ViewerCount != 1 {
+		t.Errorf("Expected the initial state, got %+v (%v)", init, err)
+	}
+
+	// Older pages connect at /viewer-ws/ with credentials in the header
+	header = http.Header{"Authorization": {"Bearer " + token}}
+	legacy, _, err := websocket.DefaultDialer.Dial(base+"/viewer-ws/"+cli.sessionID, header)
+	if err != nil {
+		t.Fatalf("Expected a bearer token to open the socket: %v", err)
+	}
+	legacy.Close()
+}
+
+// TestCreateSessionWithVerifier checks that a CLI-computed bcrypt verifier
+// authenticates viewers without the relay storing the password
+func TestCreateSessionWithVerifier(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	expiresAt := time.Now().Add(30 * time.Minute)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	session, err := store.CreateSessionWithVerifier(nil, expiresAt, hash)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if !session.checkPassword("secret") {
+		t.Error("Expected password matching the verifier to be accepted")
+	}
+	if session.checkPassword("wrong") {
+		t.Error("Expected wrong password to be rejected")
+	}
+
+	// Malformed and low-cost verifiers are refused
+	if _, err := store.CreateSessionWithVerifier(nil, expiresAt, []byte("secret")); !errors.Is(err, ErrInvalidVerifier) {
+		t.Errorf("Expected ErrInvalidVerifier for plaintext, got %v", err)
+	}
+	weak, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if _, err := store.CreateSessionWithVerifier(nil, expiresAt, weak); !errors.Is(err, ErrInvalidVerifier) {
+		t.Errorf("Expected ErrInvalidVerifier for low cost, got %v", err)
+	}
+
+	// The relay's own hasher is not held to the verifier bounds
+	store.SetPasswordHasher(&BcryptHasher{Cost: bcrypt.MinCost})
+	if _, err := store.CreateSessionWithPassword(nil, expiresAt, "secret"); err != nil {
+		t.Errorf("Expected a relay-hashed password below the verifier minimum to work, got %v", err)
+	}
+
+	// bcrypt reads the cost from the hash prefix, so no need to pay for it here
+	costly := []byte(strings.Replace(string(hash), "$10$", "$20$", 1))
+	if _, err := store.CreateSessionWithVerifier(nil, expiresAt, costly); !errors.Is(err, ErrInvalidVerifier) {
+		t.Errorf("Expected ErrInvalidVerifier for high cost, got %v", err)
+	}
+}
+
+// TestClientSideKDF checks a CLI can register a verifier of a derived key so
+// that viewers log in with the key and the password never reaches the relay
+func TestClientSideKDF(t *testing.T) {
+	relay := newTestRelay(t)
+	salt := []byte("0123456789abcdef")
+	key, err := pbkdf2.Key(sha256.New, "secret", salt, MinPasswordKDFIterations, 32)
+	if err != nil {
+		t.Fatalf("Failed to derive key: %v", err)
+	}
+	derived := hex.EncodeToString(key)
+
+	register := NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix())
+	register.PasswordHash = string(scryptVerifier(t, []byte(derived), MinVerifierScryptLogN, 8, 1))
+	register.PasswordKDF = "pbkdf2-sha256$100000$" + base64.StdEncoding.EncodeToString(salt)
+	cli := relay.connectCLI(t, register)
+
+	// The login page derives the key in the browser instead of posting the password
+	resp, err := http.Get(relay.server.URL + "/" + cli.sessionID + "/__auth__")
+	if err != nil {
+		t.Fatalf("Failed to load login page: %v", err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), base64.StdEncoding.EncodeToString(salt)) ||
+		strings.Contains(string(page), `id="password" name="password"`) {
+		t.Errorf("Expected a login page that derives the key, got %s", page)
+	}
+
+	login := func(password string) int {
+		r := httptest.NewRequest(http.MethodPost, "/"+cli.sessionID+"/__auth__", strings.NewReader("password="+password))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		relay.handlers.HandleViewerRequest(w, r)
+		return w.Code
+	}
+	if code := login(derived); code != http.StatusFound {
+		t.Errorf("Expected the derived key to log in, got %d", code)
+	}
+	if code := login("secret"); code != http.StatusOK {
+		t.Errorf("Expected the plain password to be refused, got %d", code)
+	}
+}
+
+// TestValidateRegisterMessage_PasswordAndVerifier checks the two are mutually exclusive
+func TestValidateRegisterMessage_PasswordAndVerifier(t *testing.T) {
+	msg := NewRegisterMessage("/share", time.Now().Add(time.Hour).Unix())
+	msg.Password = "secret"
+	msg.PasswordHash = "$2a$10$abcdefghijklmnopqrstuv"
+	if err := ValidateRegisterMessage(msg); err != ErrInvalidMessage {
+		t.Errorf("Expected ErrInvalidMessage, got %v", err)
+	}
+
+	// Derivation parameters without a verifier are meaningless
+	msg.PasswordHash = ""
+	msg.PasswordKDF = "pbkdf2-sha256$600000$MDEyMzQ1Njc4OWFiY2RlZg=="
+	if err := ValidateRegisterMessage(msg); err != ErrInvalidMessage {
+		t.Errorf("Expected ErrInvalidMessage for a KDF without verifier, got %v", err)
+	}
+}
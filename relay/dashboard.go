@@ -0,0 +1,620 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Admin Dashboard
+// A single page served at AdminPrefix showing live sessions, viewers,
+// throughput and recent errors, fed by a server-sent event stream of
+// snapshots. Browsers log in once with the admin token and get a signed
+// cookie, which the admin API accepts in place of the bearer token.
+// ============================================================================
+
+const (
+	// DashboardUpdateInterval is how often the event stream sends a snapshot
+	DashboardUpdateInterval = 2 * time.Second
+
+	// AdminCookieTTL is how long a dashboard login lasts
+	AdminCookieTTL = 12 * time.Hour
+
+	// adminCookie holds the signed dashboard login
+	adminCookie = "fwdcast_admin"
+
+	// recentErrorLimit is how many failed viewer requests the dashboard keeps
+	recentErrorLimit = 50
+
+	// adminLoginTrackLimit bounds how many client addresses the login
+	// limiter remembers before forgetting ones no longer locked out
+	adminLoginTrackLimit = 10000
+)
+
+// RecentError is a failed viewer request shown on the dashboard
+type RecentError struct {
+	Time      time.Time `json:"time"`
+	SessionID string    `json:"sessionId,omitempty"`
+	RequestID string    `json:"requestId"`
+	Method    string    `json:"method"`
+	PathHash  string    `json:"pathHash"`
+	Status    int       `json:"status"`
+}
+
+// errorLog is a fixed-size ring of the most recent failed requests
+type errorLog struct {
+	entries []RecentError
+	next    int
+	mu      sync.Mutex
+}
+
+// Add records a failed request, dropping the oldest once full
+func (l *errorLog) Add(e RecentError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) < recentErrorLimit {
+		l.entries = append(l.entries, e)
+		return
+	}
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % recentErrorLimit
+}
+
+// List returns the recorded failures, newest first
+func (l *errorLog) List() []RecentError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := make([]RecentError, 0, len(l.entries))
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		list = append(list, l.entries[(l.next+i)%len(l.entries)])
+	}
+	return list
+}
+
+// RecordError remembers a failed viewer request for the dashboard
+func (m *Metrics) RecordError(e RecentError) {
+	m.recentErrors.Add(e)
+}
+
+// RecentErrors returns the most recent failed viewer requests, newest first
+func (m *Metrics) RecentErrors() []RecentError {
+	return m.recentErrors.List()
+}
+
+// DashboardSnapshot is one update on the dashboard's event stream. Byte
+// counters are cumulative; the page derives throughput from successive
+// snapshots.
+type DashboardSnapshot struct {
+	Time          time.Time      `json:"time"`
+	Draining      bool           `json:"draining"`
+	Sessions      []*SessionInfo `json:"sessions"`
+	BytesToViewer uint64         `json:"bytesToViewer"`
+	BytesToCLI    uint64         `json:"bytesToCli"`
+	Errors        []RecentError  `json:"errors"`
+}
+
+// dashboardSnapshot captures the relay's current state
+func (h *Handlers) dashboardSnapshot() *DashboardSnapshot {
+	sessions := h.store.ListSessions()
+	snapshot := &DashboardSnapshot{
+		Time:          time.Now(),
+		Draining:      h.Draining(),
+		Sessions:      make([]*SessionInfo, 0, len(sessions)),
+		BytesToViewer: h.store.Metrics().BytesToViewer.Load(),
+		BytesToCLI:    h.store.Metrics().BytesToCLI.Load(),
+		Errors:        h.store.Metrics().RecentErrors(),
+	}
+	for _, session := range sessions {
+		snapshot.Sessions = append(snapshot.Sessions, h.store.SessionInfo(session))
+	}
+	return snapshot
+}
+
+// handleAdminEvents streams dashboard snapshots as server-sent events.
+// The stream ends when the relay starts draining so it can't hold up
+// shutdown; the browser reconnects on its own.
+func (h *Handlers) handleAdminEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx response buffering
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(DashboardUpdateInterval)
+	defer ticker.Stop()
+	for {
+		data, err := json.Marshal(h.dashboardSnapshot())
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: snapshot\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+		if h.Draining() {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// adminAuthorized reports whether a request carries the admin token, either
+// as a bearer token or as a dashboard login cookie
+func adminAuthorized(r *http.Request, token string) bool {
+	if presented, ok := bearerToken(r); ok {
+		return subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1
+	}
+	cookie, err := r.Cookie(adminCookie)
+	return err == nil && verifyAdminCookie(token, cookie.Value)
+}
+
+// signAdminCookie creates a dashboard login valid until expiresAt.
+// It is keyed by the admin token, so rotating the token logs everyone out.
+func signAdminCookie(token string, expiresAt time.Time) string {
+	exp := expiresAt.Unix()
+	return strconv.FormatInt(exp, 10) + "." +
+		base64.RawURLEncoding.EncodeToString(adminCookieSignature(token, exp))
+}
+
+// verifyAdminCookie checks a dashboard login cookie value
+func verifyAdminCookie(token, value string) bool {
+	expStr, sigStr, ok := strings.Cut(value, ".")
+	if !ok {
+		return false
+	}
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil || time.Now().After(time.Unix(exp, 0)) {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigStr)
+	return err == nil && hmac.Equal(sig, adminCookieSignature(token, exp))
+}
+
+// adminCookieSignature is the MAC binding a dashboard login to its expiry
+func adminCookieSignature(token string, exp int64) []byte {
+	mac := hmac.New(sha256.New, []byte(token))
+	fmt.Fprintf(mac, "fwdcast-admin\x00%d", exp)
+	return mac.Sum(nil)
+}
+
+// handleDashboard serves the dashboard, or the login page if the browser
+// isn't logged in
+func (h *Handlers) handleDashboard(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminAuthorized(r, token) {
+			sendAdminLoginPage(w, http.StatusOK, "")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Write([]byte(dashboardHTML))
+	}
+}
+
+// loginLimiter locks out client addresses after MaxFailedAttempts wrong
+// dashboard logins, for AuthLockoutDuration
+type loginLimiter struct {
+	attempts map[netip.Addr]*loginAttempts
+	mu       sync.Mutex
+}
+
+// loginAttempts is one client's run of failed logins
+type loginAttempts struct {
+	failures int
+	last     time.Time
+}
+
+// begin checks the limiter before a login attempt from addr.
+// Returns the number of seconds the caller must wait, or 0 if the attempt may proceed.
+func (l *loginLimiter) begin(addr netip.Addr) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a := l.attempts[addr]
+	if a == nil || a.failures < MaxFailedAttempts {
+		return 0
+	}
+	if wait := AuthLockoutDuration - time.Since(a.last); wait > 0 {
+		return int(wait.Seconds()) + 1
+	}
+	// Reset after cooldown
+	delete(l.attempts, addr)
+	return 0
+}
+
+// failed counts a wrong login from addr
+func (l *loginLimiter) failed(addr netip.Addr) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.attempts == nil {
+		l.attempts = make(map[netip.Addr]*loginAttempts)
+	}
+	if len(l.attempts) >= adminLoginTrackLimit {
+		for other, a := range l.attempts {
+			if time.Since(a.last) >= AuthLockoutDuration {
+				delete(l.attempts, other)
+			}
+		}
+	}
+	a := l.attempts[addr]
+	if a == nil {
+		a = &loginAttempts{}
+		l.attempts[addr] = a
+	}
+	a.failures++
+	a.last = time.Now()
+}
+
+// succeeded resets addr's failed logins
+func (l *loginLimiter) succeeded(addr netip.Addr) {
+	l.mu.Lock()
+	delete(l.attempts, addr)
+	l.mu.Unlock()
+}
+
+// handleDashboardLogin exchanges the admin token for a login cookie
+func (h *Handlers) handleDashboardLogin(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		addr := h.clientIP(r)
+		if wait := h.adminLogins.begin(addr); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(wait))
+			sendAdminLoginPage(w, http.StatusTooManyRequests,
+				fmt.Sprintf("Too many failed attempts. Try again in %d seconds.", wait))
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, 4096)
+		presented := r.PostFormValue("token")
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			h.adminLogins.failed(addr)
+			sendAdminLoginPage(w, http.StatusUnauthorized, "Incorrect admin token.")
+			return
+		}
+		h.adminLogins.succeeded(addr)
+
+		expiresAt := time.Now().Add(AdminCookieTTL)
+		http.SetCookie(w, &http.Cookie{
+			Name:     adminCookie,
+			Value:    signAdminCookie(token, expiresAt),
+			Path:     AdminPrefix,
+			Expires:  expiresAt,
+			HttpOnly: true,
+			Secure:   requestIsHTTPS(r),
+			SameSite: http.SameSiteStrictMode,
+		})
+		http.Redirect(w, r, AdminPrefix, http.StatusSeeOther)
+	}
+}
+
+// handleDashboardLogout clears the login cookie
+func (h *Handlers) handleDashboardLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: adminCookie, Path: AdminPrefix, MaxAge: -1})
+	http.Redirect(w, r, AdminPrefix, http.StatusSeeOther)
+}
+
+// requestIsHTTPS reports whether the browser reached the relay over HTTPS,
+// directly or through a TLS-terminating proxy. The proxy's header is taken
+// on trust: a spoofed one can only make the client's own cookie stricter.
+func requestIsHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// sendAdminLoginPage renders the dashboard login form, with errMsg above it if set
+func sendAdminLoginPage(w http.ResponseWriter, status int, errMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+
+	errorHTML := ""
+	if errMsg != "" {
+		errorHTML = `<div class="error">` + errMsg + `</div>`
+	}
+
+	html := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+  <title>Admin Login - fwdcast</title>
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <style>
+    * { box-sizing: border-box; }
+    body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; background: #1e1e1e; margin: 0; min-height: 100vh; display: flex; align-items: center; justify-content: center; padding: 20px; }
+    .container { max-width: 400px; width: 100%%; background: #2d2d2d; padding: 40px; border-radius: 8px; box-shadow: 0 4px 20px rgba(0,0,0,0.3); }
+    h1 { color: #cccccc; margin: 0 0 24px 0; font-size: 24px; font-weight: 500; text-align: center; }
+    .error { background: rgba(231, 76, 60, 0.2); border: 1px solid #e74c3c; color: #e74c3c; padding: 10px 16px; border-radius: 4px; margin-bottom: 20px; font-size: 14px; }
+    label { display: block; color: #858585; font-size: 12px; margin-bottom: 6px; }
+    input { width: 100%%; padding: 12px; border: 1px solid #3c3c3c; border-radius: 4px; background: #1e1e1e; color: #cccccc; font-size: 16px; margin-bottom: 20px; }
+    input:focus { outline: none; border-color: #007acc; }
+    button { width: 100%%; padding: 12px; background: #007acc; color: white; border: none; border-radius: 4px; font-size: 16px; cursor: pointer; }
+    button:hover { background: #005a9e; }
+  </style>
+</head>
+<body>
+  <div class="container">
+    <h1>fwdcast admin</h1>
+    %s
+    <form method="POST" action="%slogin">
+      <label for="token">Admin token</label>
+      <input type="password" id="token" name="token" autofocus required>
+      <button type="submit">Log in</button>
+    </form>
+  </div>
+</body>
+</html>`, errorHTML, AdminPrefix)
+
+	w.Write([]byte(html))
+}
+
+// dashboardHTML is the dashboard page. All session data is inserted with
+// textContent, never as markup.
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Dashboard - fwdcast admin</title>
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <style>
+    * { box-sizing: border-box; }
+    body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; background: #1e1e1e; color: #cccccc; margin: 0; padding: 20px; }
+    header { display: flex; align-items: center; justify-content: space-between; margin-bottom: 20px; }
+    h1 { font-size: 20px; font-weight: 500; margin: 0; }
+    h2 { font-size: 14px; font-weight: 500; color: #858585; text-transform: uppercase; margin: 0 0 12px 0; }
+    .status { font-size: 13px; color: #858585; }
+    .status.offline, .status.draining { color: #f39c12; }
+    .cards { display: grid; grid-template-columns: repeat(auto-fit, minmax(160px, 1fr)); gap: 12px; margin-bottom: 20px; }
+    .card, section { background: #2d2d2d; border-radius: 8px; padding: 16px; }
+    section { margin-bottom: 20px; overflow-x: auto; }
+    .card .value { font-size: 28px; color: #ffffff; }
+    .card .label { font-size: 12px; color: #858585; }
+    canvas { width: 100%; height: 160px; display: block; }
+    .legend { font-size: 12px; color: #858585; margin-top: 8px; }
+    .legend span { display: inline-block; width: 10px; height: 10px; border-radius: 2px; margin: 0 4px 0 12px; }
+    table { width: 100%; border-collapse: collapse; font-size: 13px; }
+    th { text-align: left; color: #858585; font-weight: normal; padding: 6px 8px; border-bottom: 1px solid #3c3c3c; }
+    td { padding: 6px 8px; border-bottom: 1px solid #333333; vertical-align: top; }
+    td.mono { font-family: ui-monospace, Menlo, Consolas, monospace; }
+    .viewers { color: #858585; font-size: 12px; }
+    .viewers div { margin-top: 4px; }
+    .empty { color: #858585; font-size: 13px; }
+    button { background: #3c3c3c; color: #cccccc; border: none; border-radius: 4px; padding: 4px 10px; font-size: 12px; cursor: pointer; margin-right: 4px; }
+    button:hover { background: #4c4c4c; }
+    button.danger { background: #7a2e26; color: #ffffff; }
+    button.danger:hover { background: #a33a2f; }
+    form { display: inline; }
+  </style>
+</head>
+<body>
+  <header>
+    <h1>fwdcast admin</h1>
+    <div>
+      <span id="status" class="status">Connecting…</span>
+      <form method="POST" action="logout"><button type="submit">Log out</button></form>
+    </div>
+  </header>
+
+  <div class="cards">
+    <div class="card"><div class="value" id="session-count">-</div><div class="label">Sessions</div></div>
+    <div class="card"><div class="value" id="viewer-count">-</div><div class="label">Viewer sockets</div></div>
+    <div class="card"><div class="value" id="pending-count">-</div><div class="label">Pending requests</div></div>
+    <div class="card"><div class="value" id="viewer-rate">-</div><div class="label">To viewers</div></div>
+  </div>
+
+  <section>
+    <h2>Throughput (last 5 minutes)</h2>
+    <canvas id="graph"></canvas>
+    <div class="legend"><span style="background:#007acc"></span>To viewers<span style="background:#27ae60"></span>To CLIs</div>
+  </section>
+
+  <section>
+    <h2>Sessions</h2>
+    <table>
+      <thead><tr><th>Session</th><th>Created</th><th>Expires</th><th>Access</th><th>Viewers</th><th>Sent</th><th></th></tr></thead>
+      <tbody id="sessions"></tbody>
+    </table>
+    <p class="empty" id="no-sessions" hidden>No active sessions.</p>
+  </section>
+
+  <section>
+    <h2>Recent errors</h2>
+    <table>
+      <thead><tr><th>Time</th><th>Status</th><th>Session</th><th>Request</th><th>Path hash</th></tr></thead>
+      <tbody id="errors"></tbody>
+    </table>
+    <p class="empty" id="no-errors" hidden>No errors.</p>
+  </section>
+
+  <script>
+    const api = 'api/';
+    const samples = [];
+    const historyLimit = 150; // 5 minutes of 2 second snapshots
+    let previous = null;
+
+    function el(tag, text, className) {
+      const node = document.createElement(tag);
+      if (text !== undefined) node.textContent = text;
+      if (className) node.className = className;
+      return node;
+    }
+
+    function formatBytes(n) {
+      const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+      let i = 0;
+      while (n >= 1024 && i < units.length - 1) { n /= 1024; i++; }
+      return (i === 0 ? n : n.toFixed(1)) + ' ' + units[i];
+    }
+
+    function formatTime(iso) {
+      return new Date(iso).toLocaleTimeString();
+    }
+
+    async function call(method, path, body) {
+      const resp = await fetch(api + path, {
+        method: method,
+        headers: body ? { 'Content-Type': 'application/json' } : {},
+        body: body ? JSON.stringify(body) : undefined,
+      });
+      if (!resp.ok) {
+        const err = await resp.json().catch(() => ({ message: resp.statusText }));
+        alert(err.message || resp.statusText);
+      }
+    }
+
+    function button(label, className, onClick) {
+      const b = el('button', label, className);
+      b.addEventListener('click', onClick);
+      return b;
+    }
+
+    function renderSessions(sessions) {
+      const tbody = document.getElementById('sessions');
+      tbody.replaceChildren();
+      document.getElementById('no-sessions').hidden = sessions.length > 0;
+
+      for (const s of sessions) {
+        const row = el('tr');
+        const id = el('td', s.id, 'mono');
+        row.appendChild(id);
+        row.appendChild(el('td', formatTime(s.createdAt)));
+        row.appendChild(el('td', formatTime(s.expiresAt)));
+
+        const access = [];
+        if (s.hasPassword) access.push('password');
+        if (s.oidc) access.push('OIDC');
+        if (s.apiKey) access.push('key: ' + s.apiKey);
+        row.appendChild(el('td', access.join(', ') || 'public'));
+
+        const viewers = el('td');
+        viewers.appendChild(el('div', s.viewerCount + ' / ' + s.maxViewers));
+        const list = el('div', undefined, 'viewers');
+        for (const v of s.viewers) {
+          const line = el('div');
+          line.appendChild(button('Kick', 'danger', () => call('DELETE', 'sessions/' + s.id + '/viewers/' + v.id)));
+          line.appendChild(document.createTextNode(v.remoteIp + ' since ' + formatTime(v.connectedAt)));
+          list.appendChild(line);
+        }
+        viewers.appendChild(list);
+        row.appendChild(viewers);
+
+        row.appendChild(el('td', formatBytes(s.bytesSent)));
+
+        const actions = el('td');
+        actions.appendChild(button('+30 min', '', () => call('PATCH', 'sessions/' + s.id, { extendBy: 1800 })));
+        actions.appendChild(button('Expire', 'danger', () => {
+          if (confirm('Expire session ' + s.id + ' now?')) call('DELETE', 'sessions/' + s.id);
+        }));
+        row.appendChild(actions);
+
+        tbody.appendChild(row);
+      }
+    }
+
+    function renderErrors(errors) {
+      const tbody = document.getElementById('errors');
+      tbody.replaceChildren();
+      document.getElementById('no-errors').hidden = errors.length > 0;
+
+      for (const e of errors) {
+        const row = el('tr');
+        row.appendChild(el('td', formatTime(e.time)));
+        row.appendChild(el('td', String(e.status)));
+        row.appendChild(el('td', e.sessionId || '-', 'mono'));
+        row.appendChild(el('td', e.requestId, 'mono'));
+        row.appendChild(el('td', e.method + ' #' + e.pathHash, 'mono'));
+        tbody.appendChild(row);
+      }
+    }
+
+    function drawGraph() {
+      const canvas = document.getElementById('graph');
+      const ratio = window.devicePixelRatio || 1;
+      canvas.width = canvas.clientWidth * ratio;
+      canvas.height = canvas.clientHeight * ratio;
+      const ctx = canvas.getContext('2d');
+      ctx.scale(ratio, ratio);
+      const width = canvas.clientWidth, height = canvas.clientHeight;
+
+      const max = Math.max(1024, ...samples.map(p => Math.max(p.toViewer, p.toCli)));
+      ctx.fillStyle = '#858585';
+      ctx.font = '11px sans-serif';
+      ctx.fillText(formatBytes(max) + '/s', 4, 12);
+
+      for (const [key, color] of [['toViewer', '#007acc'], ['toCli', '#27ae60']]) {
+        ctx.strokeStyle = color;
+        ctx.lineWidth = 2;
+        ctx.beginPath();
+        samples.forEach((p, i) => {
+          const x = width - (samples.length - 1 - i) * (width / (historyLimit - 1));
+          const y = height - (p[key] / max) * (height - 16);
+          if (i === 0) ctx.moveTo(x, y); else ctx.lineTo(x, y);
+        });
+        ctx.stroke();
+      }
+    }
+
+    function update(snapshot) {
+      let viewers = 0, pending = 0;
+      for (const s of snapshot.sessions) {
+        viewers += s.viewers.length;
+        pending += s.pendingRequests;
+      }
+      document.getElementById('session-count').textContent = snapshot.sessions.length;
+      document.getElementById('viewer-count').textContent = viewers;
+      document.getElementById('pending-count').textContent = pending;
+
+      if (previous) {
+        const seconds = (new Date(snapshot.time) - new Date(previous.time)) / 1000;
+        if (seconds > 0) {
+          const point = {
+            toViewer: Math.max(0, snapshot.bytesToViewer - previous.bytesToViewer) / seconds,
+            toCli: Math.max(0, snapshot.bytesToCli - previous.bytesToCli) / seconds,
+          };
+          samples.push(point);
+          if (samples.length > historyLimit) samples.shift();
+          document.getElementById('viewer-rate').textContent = formatBytes(point.toViewer) + '/s';
+        }
+      }
+      previous = snapshot;
+
+      const status = document.getElementById('status');
+      status.textContent = snapshot.draining ? 'Draining for shutdown' : 'Live · updated ' + formatTime(snapshot.time);
+      status.className = snapshot.draining ? 'status draining' : 'status';
+
+      renderSessions(snapshot.sessions);
+      renderErrors(snapshot.errors);
+      drawGraph();
+    }
+
+    const events = new EventSource(api + 'events');
+    events.addEventListener('snapshot', e => update(JSON.parse(e.data)));
+    events.onerror = () => {
+      const status = document.getElementById('status');
+      status.textContent = 'Disconnected, retrying…';
+      status.className = 'status offline';
+    };
+    window.addEventListener('resize', drawGraph);
+  </script>
+</body>
+</html>`
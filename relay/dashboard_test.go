@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestErrorLog_KeepsMostRecent checks the ring drops the oldest failures
+func TestErrorLog_KeepsMostRecent(t *testing.T) {
+	log := &errorLog{}
+	for i := 0; i < recentErrorLimit+5; i++ {
+		log.Add(RecentError{Status: i})
+	}
+	list := log.List()
+	if len(list) != recentErrorLimit {
+		t.Fatalf("Expected %d entries, got %d", recentErrorLimit, len(list))
+	}
+	if list[0].Status != recentErrorLimit+4 || list[len(list)-1].Status != 5 {
+		t.Errorf("Expected newest first, got %d..%d", list[0].Status, list[len(list)-1].Status)
+	}
+}
+
+// TestAdminCookie checks dashboard logins are bound to the token and expiry
+func TestAdminCookie(t *testing.T) {
+	value := signAdminCookie(testAdminToken, time.Now().Add(time.Hour))
+	if !verifyAdminCookie(testAdminToken, value) {
+		t.Error("Expected cookie to verify")
+	}
+	if verifyAdminCookie("another-admin-token-0123", value) {
+		t.Error("Expected cookie signed with another token to be rejected")
+	}
+	if verifyAdminCookie(testAdminToken, signAdminCookie(testAdminToken, time.Now().Add(-time.Minute))) {
+		t.Error("Expected expired cookie to be rejected")
+	}
+	exp, sig, _ := strings.Cut(value, ".")
+	if verifyAdminCookie(testAdminToken, exp+"0."+sig) {
+		t.Error("Expected cookie with altered expiry to be rejected")
+	}
+}
+
+// TestDashboard_Login checks the login form issues a cookie the API accepts
+func TestDashboard_Login(t *testing.T) {
+	h := NewHandlers(NewSessionStore("localhost:8080"))
+	admin := h.AdminHandler(testAdminToken)
+
+	// Not logged in: the login form is shown
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, httptest.NewRequest(http.MethodGet, AdminPrefix, nil))
+	if !strings.Contains(w.Body.String(), `name="token"`) {
+		t.Fatal("Expected login form")
+	}
+
+	login := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, AdminPrefix+"login", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := login("wrong"); w.Code != http.StatusUnauthorized || len(w.Result().Cookies()) != 0 {
+		t.Errorf("Expected wrong token to be refused, got %d", w.Code)
+	}
+
+	w = login(testAdminToken)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected redirect after login, got %d", w.Code)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != adminCookie || !cookies[0].HttpOnly {
+		t.Fatalf("Expected HttpOnly admin cookie, got %v", cookies)
+	}
+
+	for _, path := range []string{AdminPrefix, adminAPIPrefix + "sessions"} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `name="token"`) {
+			t.Errorf("%s: expected access with cookie, got %d", path, w.Code)
+		}
+	}
+}
+
+// TestDashboard_LoginLockout checks repeated wrong tokens lock out the
+// client's address, and only that address
+func TestDashboard_LoginLockout(t *testing.T) {
+	h := NewHandlers(NewSessionStore("localhost:8080"))
+	admin := h.AdminHandler(testAdminToken)
+
+	login := func(token, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, AdminPrefix+"login", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < MaxFailedAttempts; i++ {
+		if w := login("wrong", "203.0.113.7:1234"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected 401, got %d", i+1, w.Code)
+		}
+	}
+	w := login(testAdminToken, "203.0.113.7:1234")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" || len(w.Result().Cookies()) != 0 {
+		t.Errorf("Expected the locked-out address to be refused, got %d", w.Code)
+	}
+
+	if w := login(testAdminToken, "203.0.113.8:1234"); w.Code != http.StatusSeeOther {
+		t.Errorf("Expected another address to log in, got %d", w.Code)
+	}
+}
+
+// TestDashboard_LoginCookieSecure checks the cookie is Secure only when the
+// browser used HTTPS, directly or through a proxy
+func TestDashboard_LoginCookieSecure(t *testing.T) {
+	h := NewHandlers(NewSessionStore("localhost:8080"))
+	admin := h.AdminHandler(testAdminToken)
+
+	for _, tc := range []struct {
+		proto  string
+		secure bool
+	}{{"", false}, {"https", true}, {"http", false}} {
+		r := httptest.NewRequest(http.MethodPost, AdminPrefix+"login", strings.NewReader(url.Values{"token": {testAdminToken}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tc.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", tc.proto)
+		}
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, r)
+		if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Secure != tc.secure {
+			t.Errorf("X-Forwarded-Proto %q: expected Secure=%v, got %v", tc.proto, tc.secure, cookies)
+		}
+	}
+}
+
+// TestDashboard_Events checks the event stream carries sessions and recent errors
+func TestDashboard_Events(t *testing.T) {
+	relay := newTestRelay(t)
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+
+	resp, err := http.Get(relay.server.URL + "/000000000000/missing.txt")
+	if err != nil {
+		t.Fatalf("Viewer request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	server := httptest.NewServer(relay.handlers.AdminHandler(testAdminToken))
+	defer server.Close()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+adminAPIPrefix+"events", nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Events request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected event stream, got %q", ct)
+	}
+
+	var snapshot DashboardSnapshot
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			if err := json.Unmarshal([]byte(data), &snapshot); err != nil {
+				t.Fatalf("Invalid snapshot: %v", err)
+			}
+			break
+		}
+	}
+
+	if len(snapshot.Sessions) != 1 || snapshot.Sessions[0].ID != cli.sessionID {
+		t.Errorf("Expected the CLI's session, got %+v", snapshot.Sessions)
+	}
+	if len(snapshot.Errors) != 1 || snapshot.Errors[0].Status != http.StatusNotFound || snapshot.Errors[0].SessionID != "000000000000" {
+		t.Errorf("Expected the 404 in recent errors, got %+v", snapshot.Errors)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// Error Responses
+// ============================================================================
+
+// Error codes returned in structured error bodies
+const (
+	ErrCodeNotFound         = "not_found"
+	ErrCodeUnauthorized     = "unauthorized"
+	ErrCodeTooManyViewers   = "too_many_viewers"
+	ErrCodeGatewayTimeout   = "gateway_timeout"
+	ErrCodeTooManyAttempts  = "too_many_attempts"
+	ErrCodeLinkUsed         = "link_used"
+	ErrCodeLinkExpired      = "link_expired"
+	ErrCodeLinkScope        = "link_out_of_scope"
+	ErrCodeInvalidSignature = "invalid_signature"
+	ErrCodeIPNotAllowed     = "ip_not_allowed"
+	ErrCodeLoginFailed      = "login_failed"
+	ErrCodeBadRequest       = "bad_request"
+	ErrCodeSharePaused      = "share_paused"
+)
+
+// ErrorResponse is the structured error body sent to API clients
+// that prefer JSON over the HTML error pages
+type ErrorResponse struct {
+	Code       string `json:"code"`
+	Status     int    `json:"status"`
+	Message    string `json:"message"`
+	SessionID  string `json:"sessionId,omitempty"`
+	RetryAfter int    `json:"retryAfter,omitempty"` // Seconds, 0 if not applicable
+}
+
+// errorFormat is the representation chosen for an error response
+type errorFormat int
+
+const (
+	errorFormatHTML errorFormat = iota
+	errorFormatJSON
+	errorFormatText
+)
+
+// errorFormatOffers lists the media types we can produce, in order of
+// preference when the client rates several of them equally
+var errorFormatOffers = []struct {
+	mediaType string
+	format    errorFormat
+}{
+	{"text/html", errorFormatHTML},
+	{"application/json", errorFormatJSON},
+	{"text/plain", errorFormatText},
+}
+
+// negotiateErrorFormat picks the error representation from the Accept header.
+// Browsers and clients without a preference (no header or */*) get HTML.
+func negotiateErrorFormat(r *http.Request) errorFormat {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return errorFormatHTML
+	}
+
+	best := errorFormatHTML
+	bestQ := -1.0
+	for _, offer := range errorFormatOffers {
+		q := acceptQuality(accept, offer.mediaType)
+		if q > bestQ {
+			best = offer.format
+			bestQ = q
+		}
+	}
+	if bestQ <= 0 {
+		return errorFormatHTML
+	}
+	return best
+}
+
+// acceptQuality returns the q-value the Accept header assigns to mediaType,
+// using the most specific matching media range
+func acceptQuality(accept, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+
+	q := 0.0
+	specificity := -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+
+		var s int
+		switch {
+		case mediaRange == mediaType:
+			s = 2
+		case mediaRange == typ+"/*":
+			s = 1
+		case mediaRange == "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s < specificity {
+			continue
+		}
+
+		rangeQ := 1.0
+		for _, param := range params[1:] {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(key, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					rangeQ = parsed
+				}
+			}
+		}
+		specificity = s
+		q = rangeQ
+	}
+	return q
+}
+
+// sendNegotiatedError writes errResp as JSON or plain text if the client
+// prefers either over HTML. Returns false if the caller should render HTML.
+func sendNegotiatedError(w http.ResponseWriter, r *http.Request, errResp *ErrorResponse) bool {
+	w.Header().Set("Vary", "Accept")
+	format := negotiateErrorFormat(r)
+	if format == errorFormatHTML {
+		return false
+	}
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if errResp.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(errResp.RetryAfter))
+	}
+
+	switch format {
+	case errorFormatJSON:
+		body, err := json.Marshal(errResp)
+		if err != nil {
+			return false
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(errResp.Status)
+		w.Write(append(body, '\n'))
+	case errorFormatText:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(errResp.Status)
+		fmt.Fprintf(w, "%d %s: %s\n", errResp.Status, errResp.Code, errResp.Message)
+	}
+	return true
+}
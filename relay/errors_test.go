@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestNegotiateErrorFormat checks Accept header handling for error responses
+func TestNegotiateErrorFormat(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   errorFormat
+	}{
+		{"", errorFormatHTML},
+		{"*/*", errorFormatHTML},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", errorFormatHTML},
+		{"application/json", errorFormatJSON},
+		{"application/json, text/plain;q=0.5", errorFormatJSON},
+		{"text/plain", errorFormatText},
+		{"text/html;q=0.1, application/json;q=0.9", errorFormatJSON},
+		{"application/*", errorFormatJSON},
+		{"image/png", errorFormatHTML},
+	}
+
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+		if tc.accept != "" {
+			r.Header.Set("Accept", tc.accept)
+		}
+		if got := negotiateErrorFormat(r); got != tc.want {
+			t.Errorf("Accept %q: got format %d, want %d", tc.accept, got, tc.want)
+		}
+	}
+}
+
+// TestSend503_JSON checks the structured body returned to API clients
+func TestSend503_JSON(t *testing.T) {
+	h := NewHandlers(NewSessionStore("localhost:8080"))
+	r := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+
+	h.send503(w, r, "abc", "Too many viewers")
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Expected Retry-After 30, got %q", got)
+	}
+
+	var body ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode JSON body: %v", err)
+	}
+	if body.Code != ErrCodeTooManyViewers || body.SessionID != "abc" || body.RetryAfter != 30 {
+		t.Errorf("Unexpected error body: %+v", body)
+	}
+}
+
+// TestSend404_PlainText checks the single-line body for text/plain clients
+func TestSend404_PlainText(t *testing.T) {
+	h := NewHandlers(NewSessionStore("localhost:8080"))
+	r := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+	r.Header.Set("Accept", "text/plain")
+	w := httptest.NewRecorder()
+
+	h.send404(w, r, "abc", "Session not found")
+
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected text/plain, got %q", w.Header().Get("Content-Type"))
+	}
+	if got := w.Body.String(); got != "404 not_found: Session not found\n" {
+		t.Errorf("Unexpected body: %q", got)
+	}
+}
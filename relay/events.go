@@ -0,0 +1,237 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Event Bus
+// SessionStore and Handlers publish what happens to sessions and viewer
+// requests; metrics, webhooks and viewer live-updates subscribe. New
+// consumers hook in here instead of into the handlers.
+//
+// Publish calls subscribers synchronously on the publishing goroutine, after
+// the publisher has released its locks. Publishers include the expiry
+// checker, which serves every session, so subscribers must not wait on
+// anything unbounded. Appending to local files (audit log, reports) is fine,
+// as is a CLI notice, which gives up after cliNoticeTimeout; viewer sockets
+// are written through their outbox, and network I/O such as webhooks goes
+// through a queue.
+// ============================================================================
+
+// Event is something that happened on the relay. Each kind of event is its
+// own type; subscribers switch on it or use Subscribe with a concrete type.
+type Event interface {
+	event()
+}
+
+// SessionCreatedEvent is published when a CLI registers a session
+type SessionCreatedEvent struct {
+	Session *Session
+}
+
+// SessionRegisteredEvent is published once a registering CLI's session is
+// fully configured (API key, viewer restrictions) and about to be confirmed
+type SessionRegisteredEvent struct {
+	Session   *Session
+	RemoteIP  string
+	UserAgent string
+}
+
+// SessionExpiredEvent is published when a session expires or is ended by
+// an admin, just before it is removed
+type SessionExpiredEvent struct {
+	Session *Session
+}
+
+// SessionExpiryChangedEvent is published when a running session's expiry is
+// moved by its CLI or an admin
+type SessionExpiryChangedEvent struct {
+	Session   *Session
+	ExpiresAt time.Time
+}
+
+// SessionExpiringEvent is published when a session passes one of the
+// relay's expiry warning thresholds
+type SessionExpiringEvent struct {
+	Session   *Session
+	ExpiresAt time.Time
+	Remaining time.Duration
+}
+
+// SessionPausedEvent is published when a CLI pauses or resumes sharing
+type SessionPausedEvent struct {
+	Session *Session
+	Paused  bool // false when resumed
+}
+
+// SessionEndedEvent is published once a session has been removed, however
+// it ended
+type SessionEndedEvent struct {
+	Session *Session
+	Report  *SessionReport
+}
+
+// ViewerJoinedEvent is published when a viewer opens a live-update socket
+type ViewerJoinedEvent struct {
+	Session *Session
+	Viewer  *ViewerSocket
+}
+
+// ViewerLeftEvent is published when a viewer's live-update socket closes
+type ViewerLeftEvent struct {
+	Session *Session
+	Viewer  *ViewerSocket
+}
+
+// ViewerLimitEvent is published when a viewer request is turned away
+// because the session is at its viewer limit
+type ViewerLimitEvent struct {
+	Session *Session
+}
+
+// RequestStartedEvent is published when a viewer request is admitted and
+// about to be forwarded to the CLI
+type RequestStartedEvent struct {
+	Session   *Session
+	RequestID string
+	Method    string
+	Path      string // Resource path within the share
+	RemoteIP  string
+}
+
+// RequestFinishedEvent is published when any viewer request completes,
+// including ones refused before reaching a session
+type RequestFinishedEvent struct {
+	SessionID string // Empty if the URL named no session
+	RequestID string
+	Method    string
+	URLPath   string // Full request path, including the session ID
+	Path      string // Resource path within the share, once parsed
+	Forwarded bool   // The request reached the CLI
+	RemoteIP  string
+	UserAgent string
+	Status    int
+	Bytes     int64
+	Start     time.Time
+	Duration  time.Duration
+}
+
+// AccessDeniedEvent is published when a viewer request is refused for a
+// reason other than a wrong password: IP restrictions, OIDC allow lists,
+// used or expired links and invalid signed URLs
+type AccessDeniedEvent struct {
+	Session   *Session
+	Reason    string // Error code, e.g. ip_not_allowed
+	RemoteIP  string
+	UserAgent string
+}
+
+// Viewer authentication methods, for auth events
+const (
+	AuthMethodPassword = "password" // Login form
+	AuthMethodBasic    = "basic"    // HTTP Basic
+	AuthMethodBearer   = "bearer"   // Relay-issued bearer token
+	AuthMethodToken    = "token"    // Bearer token endpoint
+	AuthMethodOIDC     = "oidc"
+)
+
+// AuthSucceededEvent is published when a viewer authenticates
+type AuthSucceededEvent struct {
+	Session   *Session
+	Method    string
+	Identity  string // Verified e-mail for OIDC logins
+	RemoteIP  string
+	UserAgent string
+}
+
+// AuthFailedEvent is published for each wrong password or token
+type AuthFailedEvent struct {
+	Session   *Session
+	Method    string
+	RemoteIP  string
+	UserAgent string
+	Attempts  int // Consecutive password failures, including this one; 0 for bearer tokens
+}
+
+func (SessionCreatedEvent) event()       {}
+func (SessionRegisteredEvent) event()    {}
+func (SessionExpiredEvent) event()       {}
+func (SessionEndedEvent) event()         {}
+func (SessionExpiryChangedEvent) event() {}
+func (SessionExpiringEvent) event()      {}
+func (SessionPausedEvent) event()        {}
+func (ViewerJoinedEvent) event()         {}
+func (ViewerLeftEvent) event()           {}
+func (ViewerLimitEvent) event()          {}
+func (RequestStartedEvent) event()       {}
+func (RequestFinishedEvent) event()      {}
+func (AuthSucceededEvent) event()        {}
+func (AuthFailedEvent) event()           {}
+func (AccessDeniedEvent) event()         {}
+
+// EventBus delivers published events to subscribers, in the order they
+// subscribed
+type EventBus struct {
+	subscribers []subscriber
+	nextID      int
+	mu          sync.RWMutex
+}
+
+// subscriber is one subscription on an EventBus
+type subscriber struct {
+	id int
+	fn func(Event)
+}
+
+// NewEventBus creates an event bus with no subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// SubscribeAll calls fn with every published event. Returns a function
+// that removes the subscription.
+func (b *EventBus) SubscribeAll(fn func(Event)) (unsubscribe func()) {
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subscribers = append(b.subscribers, subscriber{id: id, fn: fn})
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, sub := range b.subscribers {
+			if sub.id == id {
+				b.subscribers = append(b.subscribers[:i:i], b.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Subscribe calls fn with each published event of type T
+func Subscribe[T Event](b *EventBus, fn func(T)) (unsubscribe func()) {
+	return b.SubscribeAll(func(e Event) {
+		if typed, ok := e.(T); ok {
+			fn(typed)
+		}
+	})
+}
+
+// Publish delivers an event to all subscribers
+func (b *EventBus) Publish(e Event) {
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, sub := range subscribers {
+		sub.fn(e)
+	}
+}
+
+// Events returns the bus the store and handlers publish to
+func (s *SessionStore) Events() *EventBus {
+	return s.events
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestEventBus_Subscribe checks delivery order, typed subscriptions and unsubscribing
+func TestEventBus_Subscribe(t *testing.T) {
+	bus := NewEventBus()
+	var got []string
+	bus.SubscribeAll(func(e Event) { got = append(got, fmt.Sprintf("all:%T", e)) })
+	unsubscribe := Subscribe(bus, func(e AuthFailedEvent) { got = append(got, fmt.Sprintf("auth:%d", e.Attempts)) })
+	bus.SubscribeAll(func(e Event) { got = append(got, "last") })
+
+	bus.Publish(AuthFailedEvent{Attempts: 2})
+	bus.Publish(ViewerLimitEvent{})
+	unsubscribe()
+	bus.Publish(AuthFailedEvent{Attempts: 3})
+
+	want := []string{
+		"all:main.AuthFailedEvent", "auth:2", "last",
+		"all:main.ViewerLimitEvent", "last",
+		"all:main.AuthFailedEvent", "last",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+// eventRecorder collects events published on a bus
+type eventRecorder struct {
+	events []Event
+	mu     sync.Mutex
+}
+
+func recordEvents(bus *EventBus) *eventRecorder {
+	rec := &eventRecorder{}
+	bus.SubscribeAll(func(e Event) {
+		rec.mu.Lock()
+		rec.events = append(rec.events, e)
+		rec.mu.Unlock()
+	})
+	return rec
+}
+
+// types lists the recorded event types, in order
+func (rec *eventRecorder) types() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	types := make([]string, len(rec.events))
+	for i, e := range rec.events {
+		types[i] = strings.TrimPrefix(fmt.Sprintf("%T", e), "main.")
+	}
+	return types
+}
+
+// waitFor polls until the recorder holds want events
+func (rec *eventRecorder) waitFor(t *testing.T, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Join(rec.types(), ",") != strings.Join(want, ",") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Got events %v, want %v", rec.types(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestBroadcastToViewers_DoesNotBlock checks a viewer that has stopped
+// reading can't hold up a publisher broadcasting to the session
+func TestBroadcastToViewers_DoesNotBlock(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	session, _ := store.CreateSession(nil, time.Now().Add(time.Hour))
+
+	// No writer drains this viewer's outbox
+	stalled := &ViewerSocket{outbox: make(chan []byte, 1), done: make(chan struct{})}
+	session.ViewerSockets[&websocket.Conn{}] = stalled
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < viewerOutboxSize+1; i++ {
+			session.broadcastToViewers([]byte(fmt.Sprintf(`{"n":%d}`, i)))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected broadcasts to drop messages for a stalled viewer")
+	}
+	if msg := <-stalled.outbox; string(msg) != `{"n":0}` {
+		t.Errorf("Expected the first message to stay queued, got %s", msg)
+	}
+}
+
+// TestEvents_SessionLifecycle checks the store and handlers publish events
+// as a session is viewed and expires
+func TestEvents_SessionLifecycle(t *testing.T) {
+	relay := newTestRelay(t)
+	rec := recordEvents(relay.store.Events())
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+	rec.waitFor(t, "SessionCreatedEvent", "SessionRegisteredEvent")
+
+	go cli.serve("hello")
+	resp, err := http.Get(relay.server.URL + "/" + cli.sessionID + "/hello.txt")
+	if err != nil {
+		t.Fatalf("Viewer request failed: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	rec.waitFor(t, "SessionCreatedEvent", "SessionRegisteredEvent", "RequestStartedEvent", "RequestFinishedEvent")
+
+	rec.mu.Lock()
+	started := rec.events[2].(RequestStartedEvent)
+	finished := rec.events[3].(RequestFinishedEvent)
+	rec.mu.Unlock()
+	if started.Path != "/hello.txt" || started.RequestID != finished.RequestID {
+		t.Errorf("Unexpected request started event %+v", started)
+	}
+	if finished.SessionID != cli.sessionID || finished.Status != http.StatusOK || finished.Bytes != 5 {
+		t.Errorf("Unexpected request finished event %+v", finished)
+	}
+
+	viewer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(relay.server.URL, "http")+"/viewer-ws/"+cli.sessionID, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect viewer: %v", err)
+	}
+	viewer.ReadMessage() // init
+	viewer.Close()
+	rec.waitFor(t, "SessionCreatedEvent", "SessionRegisteredEvent", "RequestStartedEvent", "RequestFinishedEvent",
+		"ViewerJoinedEvent", "ViewerLeftEvent")
+
+	relay.store.ExpireSession(cli.sessionID)
+	rec.waitFor(t, "SessionCreatedEvent", "SessionRegisteredEvent", "RequestStartedEvent", "RequestFinishedEvent",
+		"ViewerJoinedEvent", "ViewerLeftEvent", "SessionExpiredEvent", "SessionEndedEvent")
+}
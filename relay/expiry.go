@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ============================================================================
+// Changing Expiry Mid-Session and Expiry Warnings
+// A CLI may move its session's expiry with setExpiry, e.g. when a meeting
+// runs long, instead of restarting and handing out a new URL. Viewers'
+// live-update sockets are told the new deadline so their countdowns follow.
+//
+// Ahead of expiry, the expiry checker warns at each threshold (5 and 1
+// minutes by default): viewers get an expiringSoon event so the page can
+// show a banner, and CLIs that asked get an expiringSoon message.
+//
+// MAX_SESSION_DURATION caps how long any session may last, counted from
+// registration, however its expiry is set: at registration, by the CLI or
+// through the admin API.
+// ============================================================================
+
+// DefaultExpiryWarnings are the default warning thresholds before expiry
+var DefaultExpiryWarnings = []time.Duration{5 * time.Minute, time.Minute}
+
+// handleSetExpiryMessage moves the session's expiry and answers with expiryUpdated
+func (h *Handlers) handleSetExpiryMessage(session *Session, msg *SetExpiryMessage) {
+	expiresAt := time.Unix(msg.ExpiresAt, 0)
+
+	var err error
+	session.mu.Lock()
+	apiKey := session.APIKey
+	session.mu.Unlock()
+	if apiKey != nil {
+		err = apiKey.CheckDurationFrom(session.CreatedAt, expiresAt)
+	}
+	if err == nil {
+		err = h.store.SetExpiry(session.ID, expiresAt)
+	}
+
+	reply := NewExpiryUpdatedMessage(msg.ID, session.expiry().Unix(), "")
+	if err != nil {
+		session.logger().Info("Refused expiry change", "error", err)
+		reply.Error = err.Error()
+	} else {
+		session.logger().Info("Session expiry changed by CLI", "expires_in", time.Until(expiresAt).Round(time.Minute))
+	}
+
+	respBytes, err := SerializeMessage(reply)
+	if err != nil {
+		session.logger().Error("Failed to serialize expiryUpdated message", "error", err)
+		return
+	}
+
+	session.mu.Lock()
+	err = session.WebSocket.WriteMessage(websocket.TextMessage, respBytes)
+	session.mu.Unlock()
+	if err != nil {
+		session.logger().Warn("Failed to send expiryUpdated message", "error", err)
+	}
+}
+
+// subscribeViewerExpiry tells viewers' live-update sockets when the
+// session's expiry moves
+func (s *SessionStore) subscribeViewerExpiry() {
+	Subscribe(s.events, func(e SessionExpiryChangedEvent) {
+		msg := fmt.Sprintf(`{"type":"expiry","expiresAt":%d}`, e.ExpiresAt.Unix())
+		e.Session.broadcastToViewers([]byte(msg))
+	})
+}
+
+// MaxSessionDurationFromEnv reads MAX_SESSION_DURATION (a duration such as
+// "4h"); unset or 0 means unlimited
+func MaxSessionDurationFromEnv() (time.Duration, error) {
+	value := os.Getenv("MAX_SESSION_DURATION")
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid MAX_SESSION_DURATION %q", value)
+	}
+	return duration, nil
+}
+
+// SetMaxSessionDuration caps how long sessions may last (0 = unlimited)
+func (s *SessionStore) SetMaxSessionDuration(d time.Duration) {
+	s.maxDuration = d
+}
+
+// checkMaxDuration returns an error if a session that started at start and
+// ends at expiresAt would exceed the relay's limit
+func (s *SessionStore) checkMaxDuration(start, expiresAt time.Time) error {
+	if s.maxDuration <= 0 {
+		return nil
+	}
+	if expiresAt.Sub(start) > s.maxDuration+time.Minute { // Allow for clock skew
+		return fmt.Errorf("session duration exceeds this relay's limit of %v", s.maxDuration)
+	}
+	return nil
+}
+
+// ExpiryWarningsFromEnv returns the warning thresholds configured by
+// EXPIRY_WARNINGS, a comma-separated list of durations (e.g. "10m,2m"), or
+// "off" for none
+func ExpiryWarningsFromEnv() ([]time.Duration, error) {
+	value := os.Getenv("EXPIRY_WARNINGS")
+	switch value {
+	case "":
+		return DefaultExpiryWarnings, nil
+	case "off":
+		return nil, nil
+	}
+
+	var warnings []time.Duration
+	for _, field := range strings.Split(value, ",") {
+		warning, err := time.ParseDuration(strings.TrimSpace(field))
+		if err != nil || warning <= 0 {
+			return nil, fmt.Errorf("invalid EXPIRY_WARNINGS %q", value)
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings, nil
+}
+
+// SetExpiryWarningThresholds sets how long before expiry sessions are warned
+func (s *SessionStore) SetExpiryWarningThresholds(warnings []time.Duration) {
+	sorted := append([]time.Duration(nil), warnings...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+	s.expiryWarnings = sorted
+}
+
+// SetExpiryWarnings turns expiringSoon messages to the CLI on or off for a session
+func (s *SessionStore) SetExpiryWarnings(id string, enabled bool) error {
+	session := s.GetSession(id)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+
+	session.mu.Lock()
+	session.ExpiryWarnings = enabled
+	session.mu.Unlock()
+	return nil
+}
+
+// warnExpiringSessions publishes a warning for each session that has passed
+// a threshold it hasn't been warned about. A session that passes several
+// thresholds between checks is warned once, for the shortest.
+func (s *SessionStore) warnExpiringSessions(now time.Time) {
+	if len(s.expiryWarnings) == 0 {
+		return
+	}
+
+	s.mu.RLock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.RUnlock()
+
+	for _, session := range sessions {
+		expiresAt := session.expiry()
+		remaining := expiresAt.Sub(now)
+		if remaining <= 0 {
+			continue
+		}
+
+		var due time.Duration
+		for _, warning := range s.expiryWarnings {
+			if remaining <= warning {
+				due = warning
+			}
+		}
+
+		session.mu.Lock()
+		warn := due > 0 && (session.expiryWarned == 0 || due < session.expiryWarned)
+		if warn {
+			session.expiryWarned = due
+		}
+		session.mu.Unlock()
+
+		if warn {
+			s.events.Publish(SessionExpiringEvent{Session: session, ExpiresAt: expiresAt, Remaining: remaining})
+		}
+	}
+}
+
+// subscribeExpiryWarnings delivers expiry warnings to viewers and CLIs, and
+// rearms them when a session's expiry moves
+func (s *SessionStore) subscribeExpiryWarnings() {
+	Subscribe(s.events, func(e SessionExpiringEvent) {
+		msg := fmt.Sprintf(`{"type":"expiringSoon","expiresAt":%d,"remaining":%d}`,
+			e.ExpiresAt.Unix(), int64(e.Remaining.Round(time.Second).Seconds()))
+		e.Session.broadcastToViewers([]byte(msg))
+		e.Session.sendExpiryWarning(NewExpiringSoonMessage(e.ExpiresAt, e.Remaining))
+	})
+	Subscribe(s.events, func(e SessionExpiryChangedEvent) {
+		e.Session.mu.Lock()
+		e.Session.expiryWarned = 0
+		e.Session.mu.Unlock()
+	})
+}
+
+// sendExpiryWarning sends an expiringSoon message to the CLI if it asked for them
+func (s *Session) sendExpiryWarning(msg *ExpiringSoonMessage) {
+	msgBytes, err := SerializeMessage(msg)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ExpiryWarnings || s.WebSocket == nil {
+		return
+	}
+	if err := s.sendNotice(msgBytes); err != nil {
+		s.logger().Debug("Failed to send expiry warning", "error", err)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// setExpiry asks the relay to move the session's expiry and returns its answer
+func (c *testCLI) setExpiry(id string, expiresAt time.Time) *ExpiryUpdatedMessage {
+	c.t.Helper()
+	c.send(&SetExpiryMessage{Type: TypeSetExpiry, ID: id, ExpiresAt: expiresAt.Unix()})
+	reply, ok := c.read().(*ExpiryUpdatedMessage)
+	if !ok || reply.ID != id {
+		c.t.Fatalf("Expected expiryUpdated %s, got %+v", id, reply)
+	}
+	return reply
+}
+
+// TestSetExpiry_ExtendAndShorten checks the CLI can move its expiry and
+// viewers are told the new deadline
+func TestSetExpiry_ExtendAndShorten(t *testing.T) {
+	relay := newTestRelay(t)
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+
+	viewer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(relay.server.URL, "http")+"/viewer-ws/"+cli.sessionID, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect viewer: %v", err)
+	}
+	defer viewer.Close()
+	viewer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	viewer.ReadMessage() // init
+
+	for _, expiresAt := range []time.Time{time.Now().Add(3 * time.Hour), time.Now().Add(10 * time.Minute)} {
+		reply := cli.setExpiry("e1", expiresAt)
+		if reply.Error != "" || reply.ExpiresAt != expiresAt.Unix() {
+			t.Errorf("Expected expiry %d, got %+v", expiresAt.Unix(), reply)
+		}
+		if got := relay.store.GetSession(cli.sessionID).expiry().Unix(); got != expiresAt.Unix() {
+			t.Errorf("Expected session expiry %d, got %d", expiresAt.Unix(), got)
+		}
+
+		// Viewer count updates may arrive first
+		var update struct {
+			Type      string `json:"type"`
+			ExpiresAt int64  `json:"expiresAt"`
+		}
+		for update.Type != "expiry" {
+			_, data, err := viewer.ReadMessage()
+			if err != nil {
+				t.Fatalf("Failed to read viewer update: %v", err)
+			}
+			json.Unmarshal(data, &update)
+		}
+		if update.ExpiresAt != expiresAt.Unix() {
+			t.Errorf("Expected viewers told %d, got %d", expiresAt.Unix(), update.ExpiresAt)
+		}
+	}
+}
+
+// TestSetExpiry_Refused checks requests outside policy leave the expiry alone
+func TestSetExpiry_Refused(t *testing.T) {
+	relay := newTestRelay(t)
+	original := time.Now().Add(30 * time.Minute)
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", original.Unix()))
+	relay.store.SetAPIKey(cli.sessionID, &APIKey{Name: "ci", MaxDurationMinutes: 60})
+
+	if reply := cli.setExpiry("past", time.Now().Add(-time.Minute)); reply.Error == "" || reply.ExpiresAt != original.Unix() {
+		t.Errorf("Expected an expiry in the past to be refused, got %+v", reply)
+	}
+	if reply := cli.setExpiry("long", time.Now().Add(2*time.Hour)); reply.Error == "" || reply.ExpiresAt != original.Unix() {
+		t.Errorf("Expected an expiry beyond the key's limit to be refused, got %+v", reply)
+	}
+	if reply := cli.setExpiry("ok", time.Now().Add(50*time.Minute)); reply.Error != "" {
+		t.Errorf("Expected an expiry within the key's limit, got %+v", reply)
+	}
+}
+
+// TestMaxSessionDuration checks the relay-wide limit applies at
+// registration, to the CLI's setExpiry and to the admin API
+func TestMaxSessionDuration(t *testing.T) {
+	relay := newTestRelay(t)
+	relay.store.SetMaxSessionDuration(time.Hour)
+
+	conn, _, err := websocketDial(relay)
+	if err != nil {
+		t.Fatalf("Failed to connect CLI: %v", err)
+	}
+	defer conn.Close()
+	rejectedCLI := &testCLI{t: t, conn: conn}
+	rejectedCLI.send(NewRegisterMessage("/tmp/share", time.Now().Add(2*time.Hour).Unix()))
+	if rejected, ok := rejectedCLI.read().(*RejectedMessage); !ok || rejected.Code != RejectDurationExceeded {
+		t.Errorf("Expected a registration beyond the limit to be rejected, got %+v", rejected)
+	}
+
+	original := time.Now().Add(30 * time.Minute)
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", original.Unix()))
+	if reply := cli.setExpiry("long", time.Now().Add(90*time.Minute)); reply.Error == "" || reply.ExpiresAt != original.Unix() {
+		t.Errorf("Expected an extension beyond the limit to be refused, got %+v", reply)
+	}
+	if reply := cli.setExpiry("ok", time.Now().Add(50*time.Minute)); reply.Error != "" {
+		t.Errorf("Expected an extension within the limit, got %+v", reply)
+	}
+
+	w := adminRequest(t, relay.handlers, http.MethodPatch, "sessions/"+cli.sessionID, `{"extendBy": 3600}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the admin API to refuse an extension beyond the limit, got %d", w.Code)
+	}
+}
+
+// TestMaxSessionDurationFromEnv checks MAX_SESSION_DURATION parsing
+func TestMaxSessionDurationFromEnv(t *testing.T) {
+	t.Setenv("MAX_SESSION_DURATION", "")
+	if d, err := MaxSessionDurationFromEnv(); err != nil || d != 0 {
+		t.Errorf("Expected no limit, got %v, %v", d, err)
+	}
+	t.Setenv("MAX_SESSION_DURATION", "4h")
+	if d, err := MaxSessionDurationFromEnv(); err != nil || d != 4*time.Hour {
+		t.Errorf("Expected 4h, got %v, %v", d, err)
+	}
+	for _, invalid := range []string{"4", "-1h"} {
+		t.Setenv("MAX_SESSION_DURATION", invalid)
+		if _, err := MaxSessionDurationFromEnv(); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+// TestExpiryWarnings checks sessions are warned once per threshold, and
+// again after their expiry moves
+func TestExpiryWarnings(t *testing.T) {
+	relay := newTestRelay(t)
+	var warnings []time.Duration
+	Subscribe(relay.store.Events(), func(e SessionExpiringEvent) { warnings = append(warnings, e.Remaining) })
+
+	expiresAt := time.Now().Add(4 * time.Minute).Truncate(time.Second)
+	register := NewRegisterMessage("/tmp/share", expiresAt.Unix())
+	register.ExpiryWarnings = true
+	cli := relay.connectCLI(t, register)
+	quiet := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+
+	viewer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(relay.server.URL, "http")+"/viewer-ws/"+cli.sessionID, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect viewer: %v", err)
+	}
+	defer viewer.Close()
+	viewer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	viewer.ReadMessage() // init
+
+	// Past the 5 minute threshold
+	relay.store.warnExpiringSessions(expiresAt.Add(-4 * time.Minute))
+	relay.store.warnExpiringSessions(expiresAt.Add(-3 * time.Minute))
+	warning, ok := cli.read().(*ExpiringSoonMessage)
+	if !ok || warning.ExpiresAt != expiresAt.Unix() || warning.Remaining != 240 {
+		t.Fatalf("Expected expiringSoon with 240s remaining, got %+v", warning)
+	}
+	var update struct {
+		Type      string `json:"type"`
+		Remaining int64  `json:"remaining"`
+	}
+	for update.Type != "expiringSoon" {
+		_, data, err := viewer.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read viewer update: %v", err)
+		}
+		json.Unmarshal(data, &update)
+	}
+	if update.Remaining != 240 {
+		t.Errorf("Expected viewers told 240s remaining, got %d", update.Remaining)
+	}
+
+	// Past the 1 minute threshold, then moved and past it again
+	relay.store.warnExpiringSessions(expiresAt.Add(-30 * time.Second))
+	relay.store.SetExpiry(cli.sessionID, expiresAt.Add(time.Hour))
+	relay.store.warnExpiringSessions(expiresAt.Add(-30 * time.Second))
+	relay.store.warnExpiringSessions(expiresAt.Add(time.Hour - 30*time.Second))
+	want := []time.Duration{4 * time.Minute, 30 * time.Second, 30 * time.Second}
+	if len(warnings) != len(want) || warnings[0] != want[0] || warnings[1] != want[1] || warnings[2] != want[2] {
+		t.Errorf("Expected warnings %v, got %v", want, warnings)
+	}
+
+	quiet.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := quiet.conn.ReadMessage(); err == nil {
+		t.Errorf("Expected no warnings without opting in, got %s", data)
+	}
+}
+
+// TestExpiryWarningsFromEnv checks EXPIRY_WARNINGS parsing
+func TestExpiryWarningsFromEnv(t *testing.T) {
+	t.Setenv("EXPIRY_WARNINGS", "")
+	if warnings, err := ExpiryWarningsFromEnv(); err != nil || len(warnings) != 2 {
+		t.Errorf("Expected the default warnings, got %v, %v", warnings, err)
+	}
+
+	t.Setenv("EXPIRY_WARNINGS", "off")
+	if warnings, err := ExpiryWarningsFromEnv(); err != nil || warnings != nil {
+		t.Errorf("Expected no warnings, got %v, %v", warnings, err)
+	}
+
+	t.Setenv("EXPIRY_WARNINGS", "2m, 10m")
+	warnings, err := ExpiryWarningsFromEnv()
+	if err != nil || len(warnings) != 2 || warnings[1] != 10*time.Minute {
+		t.Errorf("Expected 2m and 10m, got %v, %v", warnings, err)
+	}
+
+	for _, invalid := range []string{"5", "-1m", "5m,,1m"} {
+		t.Setenv("EXPIRY_WARNINGS", invalid)
+		if _, err := ExpiryWarningsFromEnv(); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
@@ -2,6 +2,9 @@ module github.com/fwdcast/relay
 
 go 1.24.0
 
-require github.com/gorilla/websocket v1.5.3
+require (
+	github.com/gorilla/websocket v1.5.3
+	golang.org/x/crypto v0.47.0
+)
 
-require golang.org/x/crypto v0.47.0 // indirect
+require golang.org/x/sys v0.40.0 // indirect
@@ -4,15 +4,17 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // ============================================================================
@@ -24,6 +26,9 @@ const (
 	RequestTimeout = 30 * time.Second
 )
 
+// ErrRequestTimeout marks requests the CLI didn't answer within RequestTimeout
+var ErrRequestTimeout = errors.New("CLI response timed out")
+
 // ============================================================================
 // WebSocket Upgrader
 // ============================================================================
@@ -43,12 +48,20 @@ var upgrader = websocket.Upgrader{
 
 // Handlers contains all HTTP and WebSocket handlers for the relay server
 type Handlers struct {
-	store *SessionStore
+	store          *SessionStore
+	trustedProxies []netip.Prefix // Proxies whose X-Forwarded-For is believed
+	oidc           *OIDCProvider  // OIDC issuer for the OIDC access mode (nil if disabled)
+	apiKeys        *APIKeyStore   // Required CLI API keys (nil allows anonymous registration)
+	accessLog      *AccessLogger  // Viewer request access log (nil if disabled)
+	tracer         *Tracer        // Viewer request tracing (nil if disabled)
+	adminLogins    loginLimiter   // Failed dashboard logins by client address
+	draining       atomic.Bool    // Set when shutting down
+	statsInterval  time.Duration  // How often stats messages are sent to CLIs
 }
 
 // NewHandlers creates a new Handlers instance
 func NewHandlers(store *SessionStore) *Handlers {
-	return &Handlers{store: store}
+	return &Handlers{store: store, statsInterval: StatsInterval}
 }
 
 // ============================================================================
@@ -64,14 +77,20 @@ func (h *Handlers) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Upgrade HTTP connection to WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
+		slog.Warn("WebSocket upgrade failed", "error", err)
+		return
+	}
+
+	// Don't accept new sessions while shutting down
+	if h.Draining() {
+		h.rejectRegistration(conn, RejectUnavailable, "This relay is shutting down. Please try again.")
 		return
 	}
 
 	// Read the first message - should be a register message
 	_, msgBytes, err := conn.ReadMessage()
 	if err != nil {
-		log.Printf("Failed to read register message: %v", err)
+		slog.Warn("Failed to read register message", "error", err)
 		conn.Close()
 		return
 	}
@@ -79,32 +98,130 @@ func (h *Handlers) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Parse the message
 	msg, err := DeserializeMessage(msgBytes)
 	if err != nil {
-		log.Printf("Failed to parse register message: %v", err)
-		conn.Close()
+		slog.Warn("Failed to parse register message", "error", err)
+		h.rejectRegistration(conn, RejectInvalidRequest, "Invalid register message: "+err.Error())
 		return
 	}
 
 	// Verify it's a register message
 	registerMsg, ok := msg.(*RegisterMessage)
 	if !ok {
-		log.Printf("Expected register message, got: %T", msg)
-		conn.Close()
+		slog.Warn("Expected register message", "got", fmt.Sprintf("%T", msg))
+		h.rejectRegistration(conn, RejectInvalidRequest, "Expected a register message")
+		return
+	}
+
+	// OIDC access mode needs an issuer configured on the relay
+	if len(registerMsg.OIDCAllow) > 0 && h.oidc == nil {
+		slog.Warn("Rejected registration", "reason", ErrOIDCNotConfigured)
+		h.rejectRegistration(conn, RejectInvalidRequest, ErrOIDCNotConfigured.Error())
 		return
 	}
 
 	// Calculate expiry time from the provided timestamp
 	expiresAt := time.Unix(registerMsg.ExpiresAt, 0)
+	if err := h.store.checkMaxDuration(time.Now(), expiresAt); err != nil {
+		slog.Warn("Rejected registration", "reason", err)
+		h.rejectRegistration(conn, RejectDurationExceeded, err.Error())
+		return
+	}
+
+	// Authenticate the CLI if this relay requires API keys
+	var apiKey *APIKey
+	if h.apiKeys != nil {
+		presented := apiKeyFromRequest(r)
+		if presented == "" {
+			presented = registerMsg.APIKey
+		}
+		apiKey = h.apiKeys.Lookup(presented)
+		if apiKey == nil {
+			slog.Warn("Rejected registration", "reason", "missing or unknown API key")
+			h.rejectRegistration(conn, RejectUnauthorized, "This relay requires a valid API key")
+			return
+		}
+		if err := apiKey.CheckDuration(expiresAt); err != nil {
+			slog.Warn("Rejected registration", "api_key", apiKey.Name, "reason", err)
+			h.rejectRegistration(conn, RejectDurationExceeded, err.Error())
+			return
+		}
+		if !h.apiKeys.Acquire(apiKey) {
+			slog.Warn("Rejected registration", "api_key", apiKey.Name, "reason", "session limit reached")
+			h.rejectRegistration(conn, RejectTooManySessions,
+				fmt.Sprintf("This API key is limited to %d concurrent sessions", apiKey.MaxSessions))
+			return
+		}
+	}
 
-	log.Printf("Session registered: hasPassword=%v, expiresIn=%v", registerMsg.Password != "", time.Until(expiresAt).Round(time.Minute))
+	// Viewers derive the key the verifier checks before logging in
+	var passwordKDF *PasswordKDF
+	if registerMsg.PasswordKDF != "" {
+		if passwordKDF, err = ParsePasswordKDF(registerMsg.PasswordKDF); err != nil {
+			slog.Warn("Rejected registration", "reason", err)
+			h.releaseAPIKey(apiKey)
+			h.rejectRegistration(conn, RejectInvalidRequest, err.Error())
+			return
+		}
+	}
 
-	// Create a new session with password if provided
-	session, err := h.store.CreateSessionWithPassword(conn, expiresAt, registerMsg.Password)
+	// Create a new session, preferring a CLI-computed verifier over a plaintext password
+	var session *Session
+	if registerMsg.PasswordHash != "" {
+		session, err = h.store.CreateSessionWithVerifier(conn, expiresAt, []byte(registerMsg.PasswordHash))
+	} else {
+		session, err = h.store.CreateSessionWithPassword(conn, expiresAt, registerMsg.Password)
+	}
 	if err != nil {
-		log.Printf("Failed to create session: %v", err)
+		slog.Error("Failed to create session", "error", err)
+		h.releaseAPIKey(apiKey)
+		if errors.Is(err, ErrInvalidVerifier) {
+			h.rejectRegistration(conn, RejectInvalidRequest, err.Error())
+			return
+		}
 		conn.Close()
 		return
 	}
 
+	session.logger().Info("Session registered",
+		"has_password", registerMsg.Password != "",
+		"has_verifier", registerMsg.PasswordHash != "",
+		"client_kdf", passwordKDF != nil,
+		"expires_in", time.Until(expiresAt).Round(time.Minute))
+
+	if passwordKDF != nil {
+		h.store.SetPasswordKDF(session.ID, passwordKDF)
+	}
+
+	// Apply the API key's bandwidth limit
+	if apiKey != nil {
+		session.logger().Info("Session authenticated", "api_key", apiKey.Name)
+		h.store.SetAPIKey(session.ID, apiKey)
+	}
+
+	// Restrict viewers by IP if requested (lists were validated on parse)
+	ipFilter, _ := NewIPFilter(registerMsg.AllowCIDRs, registerMsg.DenyCIDRs)
+	h.store.SetIPFilter(session.ID, ipFilter)
+
+	// Require OIDC login if an allow list was given
+	if len(registerMsg.OIDCAllow) > 0 {
+		h.store.SetOIDCAllow(session.ID, registerMsg.OIDCAllow)
+	}
+
+	// Tell the CLI about its viewers if it asked
+	if registerMsg.ActivityFeed {
+		h.store.SetActivityFeed(session.ID, true)
+	}
+
+	// Warn the CLI before the session expires if it asked
+	if registerMsg.ExpiryWarnings {
+		h.store.SetExpiryWarnings(session.ID, true)
+	}
+
+	h.store.Events().Publish(SessionRegisteredEvent{
+		Session:   session,
+		RemoteIP:  h.clientIP(r).String(),
+		UserAgent: r.UserAgent(),
+	})
+
 	// Generate the public URL
 	url := h.store.GenerateURL(session.ID)
 
@@ -112,30 +229,53 @@ func (h *Handlers) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	registeredMsg := NewRegisteredMessage(session.ID, url)
 	respBytes, err := SerializeMessage(registeredMsg)
 	if err != nil {
-		log.Printf("Failed to serialize registered message: %v", err)
+		session.logger().Error("Failed to serialize registered message", "error", err)
 		h.store.RemoveSession(session.ID)
+		h.releaseAPIKey(apiKey)
 		conn.Close()
 		return
 	}
 
 	if err := conn.WriteMessage(websocket.TextMessage, respBytes); err != nil {
-		log.Printf("Failed to send registered message: %v", err)
+		session.logger().Warn("Failed to send registered message", "error", err)
 		h.store.RemoveSession(session.ID)
+		h.releaseAPIKey(apiKey)
 		conn.Close()
 		return
 	}
 
-	log.Printf("Session active, URL provided")
+	session.logger().Info("Session active")
 
 	// Start listening for messages from CLI (response, data, end messages)
 	go h.handleCLIMessages(session)
+
+	// Report transfer statistics if the CLI asked
+	if registerMsg.Stats {
+		go h.reportStats(session)
+	}
+}
+
+// rejectRegistration tells the CLI why its registration was refused and closes the connection
+func (h *Handlers) rejectRegistration(conn *websocket.Conn, code, message string) {
+	if msgBytes, err := SerializeMessage(NewRejectedMessage(code, message)); err == nil {
+		conn.WriteMessage(websocket.TextMessage, msgBytes)
+	}
+	conn.Close()
+}
+
+// releaseAPIKey frees a session slot held by an API key (no-op for anonymous sessions)
+func (h *Handlers) releaseAPIKey(key *APIKey) {
+	if h.apiKeys != nil && key != nil {
+		h.apiKeys.Release(key)
+	}
 }
 
 // handleCLIMessages listens for messages from the CLI and routes them appropriately
 func (h *Handlers) handleCLIMessages(session *Session) {
 	defer func() {
-		log.Printf("Session ended")
+		session.logger().Info("Session ended")
 		h.store.RemoveSession(session.ID)
+		h.releaseAPIKey(session.APIKey)
 	}()
 
 	for {
@@ -147,7 +287,7 @@ func (h *Handlers) handleCLIMessages(session *Session) {
 
 		msg, err := DeserializeMessage(msgBytes)
 		if err != nil {
-			log.Printf("Failed to parse CLI message: %v", err)
+			session.logger().Warn("Failed to parse CLI message", "error", err)
 			continue
 		}
 
@@ -158,8 +298,18 @@ func (h *Handlers) handleCLIMessages(session *Session) {
 			h.handleDataMessage(session, m)
 		case *EndMessage:
 			h.handleEndMessage(session, m)
+		case *CreateLinkMessage:
+			h.handleCreateLinkMessage(session, m)
+		case *SignURLMessage:
+			h.handleSignURLMessage(session, m)
+		case *SetExpiryMessage:
+			h.handleSetExpiryMessage(session, m)
+		case *PauseMessage:
+			h.store.SetPaused(session.ID, true)
+		case *ResumeMessage:
+			h.store.SetPaused(session.ID, false)
 		default:
-			log.Printf("Unexpected message type from CLI: %T", msg)
+			session.logger().Warn("Unexpected message type from CLI", "got", fmt.Sprintf("%T", msg))
 		}
 	}
 }
@@ -177,17 +327,75 @@ func (h *Handlers) handleCLIMessages(session *Session) {
 // - Checks viewer limit, returns 503 if exceeded
 // - Forwards request to CLI via tunnel
 func (h *Handlers) HandleViewerRequest(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	// Generate unique request ID, which also correlates this request's log records
+	reqID, err := generateRequestID()
+	if err != nil {
+		slog.Error("Failed to generate request ID", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Continue the viewer's trace if it sent one
+	parent, _ := ParseTraceParent(r.Header.Get("traceparent"))
+	span := h.tracer.StartSpan("HandleViewerRequest", SpanKindServer, parent)
+
+	var sessionID, resourcePath string
+	forwarded, socket := false, false
+	lw := &loggingResponseWriter{ResponseWriter: w}
+	w = lw
+	defer func() {
+		// A viewer socket lasts as long as the page stays open, so it isn't
+		// counted as a request
+		if socket {
+			return
+		}
+		duration := time.Since(start)
+		span.SetAttribute("session.id", sessionID)
+		span.SetAttribute("request.id", reqID)
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path_hash", pathHash(r.URL.Path))
+		span.SetAttribute("http.response.status_code", int(lw.status.Load()))
+		if lw.status.Load() >= 500 {
+			span.SetError(fmt.Errorf("%s", http.StatusText(int(lw.status.Load()))))
+		}
+		span.Finish()
+		h.store.Events().Publish(RequestFinishedEvent{
+			SessionID: sessionID,
+			RequestID: reqID,
+			Method:    r.Method,
+			URLPath:   r.URL.Path,
+			Path:      resourcePath,
+			Forwarded: forwarded,
+			RemoteIP:  h.clientIP(r).String(),
+			UserAgent: r.UserAgent(),
+			Status:    int(lw.status.Load()),
+			Bytes:     lw.bytes.Load(),
+			Start:     start,
+			Duration:  duration,
+		})
+		slog.Debug("Viewer request",
+			"session_id", sessionID,
+			"request_id", reqID,
+			"method", r.Method,
+			"path_hash", pathHash(r.URL.Path),
+			"status", lw.status.Load(),
+			"bytes", lw.bytes.Load(),
+			"duration", duration)
+	}()
+
 	// Parse session ID from URL path
 	// URL format: /{session-id}/path/to/file
 	path := strings.TrimPrefix(r.URL.Path, "/")
 	parts := strings.SplitN(path, "/", 2)
 	if len(parts) == 0 || parts[0] == "" {
-		h.send404(w, "Invalid URL")
+		h.send404(w, r, "", "Invalid URL")
 		return
 	}
 
-	sessionID := parts[0]
-	resourcePath := "/"
+	sessionID = parts[0]
+	resourcePath = "/"
 	if len(parts) > 1 {
 		resourcePath = "/" + parts[1]
 	}
@@ -195,28 +403,110 @@ func (h *Handlers) HandleViewerRequest(w http.ResponseWriter, r *http.Request) {
 	// Look up session
 	session := h.store.GetSession(sessionID)
 	if session == nil {
-		h.send404(w, "Session not found or expired")
+		h.send404(w, r, sessionID, "Session not found or expired")
 		return
 	}
 
 	// Check if session has expired
 	if session.IsExpired() {
 		h.store.RemoveSession(sessionID)
-		h.send404(w, "Session has expired")
+		h.send404(w, r, sessionID, "Session has expired")
+		return
+	}
+
+	// Enforce viewer IP restrictions before any other access check
+	if !h.checkClientIP(w, r, session) {
 		return
 	}
 
+	// Limited-use links bypass the password for their path scope:
+	// /{session-id}/t/{token}/path. A visit that has already used the link
+	// continues on its grant cookie, with or without the /t/{token} prefix.
+	linkToken, linkGranted := "", false
+	if token, rest, ok := parseAccessLinkPath(resourcePath); ok {
+		if h.linkGrantAllows(r, sessionID, token, rest) {
+			linkGranted = true
+			resourcePath = cleanResourcePath(rest)
+		} else {
+			switch err := h.store.CheckAccessLinkPath(sessionID, token, rest); err {
+			case nil:
+				linkToken = token
+				resourcePath = cleanResourcePath(rest)
+			case ErrAccessLinkNotFound:
+				// Not a link - a regular path that happens to start with /t/
+			case ErrAccessLinkScope:
+				h.send403(w, r, sessionID, ErrCodeLinkScope, "This link does not cover the requested path.",
+					"Links only give access to the file or folder they were created for.")
+				return
+			default:
+				h.send410(w, r, sessionID, err)
+				return
+			}
+		}
+	} else if h.linkGrantAllows(r, sessionID, "", resourcePath) {
+		linkGranted = true
+		resourcePath = cleanResourcePath(resourcePath)
+	}
+	viaLink := linkToken != "" || linkGranted
+
+	// Signed URLs bypass the password for their path scope only:
+	// /{session-id}/s/{signed-token}/path
+	signed := false
+	if token, rest, ok := parseSignedURLPath(resourcePath); ok {
+		scope, err := h.store.VerifySignedToken(sessionID, token)
+		switch {
+		case err == ErrSignatureMalformed || err == ErrSignatureInvalid:
+			// Not a signed URL, e.g. /s/jquery.min.js - fall through to normal handling
+		case err == ErrSignatureExpired:
+			h.send410(w, r, sessionID, ErrAccessLinkExpired)
+			return
+		case err != nil:
+			h.send403(w, r, sessionID, ErrCodeInvalidSignature, "This signed link is invalid.",
+				"The link may have been altered or copied incorrectly.")
+			return
+		case !scope.Allows(rest):
+			h.send403(w, r, sessionID, ErrCodeInvalidSignature, "This signed link does not cover the requested path.",
+				"Signed links only give access to the file or folder they were created for.")
+			return
+		default:
+			setSignedCookie(w, sessionID, scope)
+			resourcePath = cleanResourcePath(rest)
+			signed = true
+		}
+	}
+	if !signed && h.signedCookieAllows(r, sessionID, resourcePath) {
+		resourcePath = cleanResourcePath(resourcePath)
+		signed = true
+	}
+
+	// OIDC access mode: require a verified identity from the allow list
+	if allow := session.oidcAllowList(); len(allow) > 0 && !viaLink && !signed {
+		if !h.oidcIdentityAllows(w, r, session, allow) {
+			h.startOIDCLogin(w, r, session, resourcePath)
+			return
+		}
+	}
+
 	// Check password authentication if session is password protected
-	if len(session.PasswordHash) > 0 {
+	if len(session.PasswordHash) > 0 && !viaLink && !signed {
+		// Bearer token endpoint for scripted clients
+		if resourcePath == authTokenPath {
+			h.handleTokenRequest(w, r, session)
+			return
+		}
+
 		// Check for __auth__ path - serve login page or handle auth
 		if strings.HasPrefix(resourcePath, "/__auth__") {
 			h.handleAuth(w, r, session, resourcePath)
 			return
 		}
 
-		// Check for auth cookie
-		cookie, err := r.Cookie("fwdcast_auth_" + sessionID)
-		if err != nil || bcrypt.CompareHashAndPassword(session.PasswordHash, []byte(cookie.Value)) != nil {
+		// Scripted clients authenticate with Basic or Bearer credentials
+		if r.Header.Get("Authorization") != "" {
+			if !h.authorizeHeader(w, r, session) {
+				return
+			}
+		} else if cookie, err := r.Cookie("fwdcast_auth_" + sessionID); err != nil || !session.checkAuthToken(cookie.Value) {
 			// Redirect to auth page - use the current path as redirect target
 			currentPath := "/" + sessionID + "/"
 			if resourcePath != "/" {
@@ -228,25 +518,42 @@ func (h *Handlers) HandleViewerRequest(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// The live-update socket is served under the share so the browser sends
+	// the share's cookies and it passes the same access checks as the page
+	if strings.HasSuffix(resourcePath, "/"+viewerSocketName) {
+		socket = true
+		h.serveViewerSocket(w, r, session)
+		return
+	}
+
+	// Hold off viewers while the CLI has paused sharing
+	if session.isPaused() {
+		h.sendPausedPage(w, r, sessionID)
+		return
+	}
+
 	// Check viewer limit
 	if err := h.store.IncrementViewers(sessionID); err != nil {
 		if err == ErrMaxViewersReached {
-			h.send503(w, "Too many viewers. Please try again later.")
+			h.send503(w, r, sessionID, "Too many viewers. Please try again later.")
 			return
 		}
-		h.send404(w, "Session not found")
+		h.send404(w, r, sessionID, "Session not found")
 		return
 	}
 
 	// Decrement viewer count when done
 	defer h.store.DecrementViewers(sessionID)
 
-	// Generate unique request ID
-	reqID, err := generateRequestID()
-	if err != nil {
-		log.Printf("Failed to generate request ID: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	// Consume a link use only once the request is actually being served;
+	// HEAD requests don't count against the limit. The rest of the visit
+	// rides on the grant cookie.
+	if linkToken != "" && r.Method != http.MethodHead {
+		if err := h.store.ConsumeAccessLink(sessionID, linkToken); err != nil {
+			h.send410(w, r, sessionID, err)
+			return
+		}
+		h.setLinkGrantCookie(w, sessionID, linkToken)
 	}
 
 	// Create pending request
@@ -254,20 +561,36 @@ func (h *Handlers) HandleViewerRequest(w http.ResponseWriter, r *http.Request) {
 		ID:             reqID,
 		ResponseWriter: w,
 		Done:           make(chan struct{}),
+		StartedAt:      time.Now(),
+		trace:          &requestTrace{root: span},
 	}
 
 	// Add to session's pending requests
 	if err := h.store.AddPendingRequest(sessionID, pendingReq); err != nil {
-		h.send404(w, "Session not found")
+		h.send404(w, r, sessionID, "Session not found")
 		return
 	}
 	defer h.store.RemovePendingRequest(sessionID, reqID)
 
-	// Forward request to CLI
+	forwarded = true
+	h.store.Events().Publish(RequestStartedEvent{
+		Session:   session,
+		RequestID: reqID,
+		Method:    r.Method,
+		Path:      resourcePath,
+		RemoteIP:  h.clientIP(r).String(),
+	})
+
+	// Forward request to CLI, passing the trace context so its spans join ours
+	forwardSpan := h.tracer.StartSpan("forward request", SpanKindInternal, span.SpanContext())
 	requestMsg := NewRequestMessage(reqID, r.Method, resourcePath)
+	requestMsg.TraceParent = pendingReq.trace.awaitResponse()
 	msgBytes, err := SerializeMessage(requestMsg)
 	if err != nil {
-		log.Printf("Failed to serialize request message: %v", err)
+		session.logger().Error("Failed to serialize request message", "request_id", reqID, "error", err)
+		forwardSpan.SetError(err)
+		forwardSpan.Finish()
+		pendingReq.trace.finish(err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -276,21 +599,50 @@ func (h *Handlers) HandleViewerRequest(w http.ResponseWriter, r *http.Request) {
 	err = session.WebSocket.WriteMessage(websocket.TextMessage, msgBytes)
 	session.mu.Unlock()
 
+	forwardSpan.SetError(err)
+	forwardSpan.Finish()
 	if err != nil {
-		log.Printf("Failed to forward request to CLI: %v", err)
-		h.send504(w, "CLI not responding")
+		session.logger().Warn("Failed to forward request to CLI", "request_id", reqID, "error", err)
+		pendingReq.trace.finish(err)
+		h.send504(w, r, sessionID, "CLI not responding")
 		return
 	}
+	h.store.Metrics().BytesToCLI.Add(uint64(len(msgBytes)))
 
-	// Wait for response with timeout
-	select {
-	case <-pendingReq.Done:
-		// Response completed
-	case <-time.After(RequestTimeout):
-		h.send504(w, "Request timed out")
+	// Write the response body as the CLI streams it, until it ends or times out.
+	// Writing here rather than in the CLI reader keeps a slow or throttled
+	// viewer from stalling the session's other requests.
+	timeout := time.NewTimer(RequestTimeout)
+	defer timeout.Stop()
+	defer func() {
+		responseStates.mu.Lock()
+		delete(responseStates.states, reqID)
+		responseStates.mu.Unlock()
+	}()
+	for {
+		select {
+		case <-pendingReq.chunks.ready():
+			h.writeChunks(session, pendingReq)
+		case <-pendingReq.Done:
+			// Response completed
+			h.writeChunks(session, pendingReq)
+			pendingReq.trace.finish(nil)
+			return
+		case <-timeout.C:
+			pendingReq.trace.finish(ErrRequestTimeout)
+			h.send504(w, r, sessionID, "Request timed out")
+			return
+		}
 	}
 }
 
+// generateViewerID creates an ID for a viewer socket, used to kick it via the admin API
+func generateViewerID() string {
+	bytes := make([]byte, 4)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
 // generateRequestID creates a unique request ID
 func generateRequestID() (string, error) {
 	bytes := make([]byte, 8)
@@ -300,9 +652,21 @@ func generateRequestID() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-// send404 sends a 404 response with a friendly HTML message
+// send404 sends a 404 response with a friendly HTML message,
+// or a JSON/plain-text body if the client prefers one
 // Requirement: 7.3
-func (h *Handlers) send404(w http.ResponseWriter, message string) {
+func (h *Handlers) send404(w http.ResponseWriter, r *http.Request, sessionID, message string) {
+	h.store.Metrics().CountResponse(http.StatusNotFound)
+
+	if sendNegotiatedError(w, r, &ErrorResponse{
+		Code:      ErrCodeNotFound,
+		Status:    http.StatusNotFound,
+		Message:   message,
+		SessionID: sessionID,
+	}) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	w.WriteHeader(http.StatusNotFound)
@@ -332,7 +696,19 @@ func (h *Handlers) send404(w http.ResponseWriter, message string) {
 
 // send503 sends a 503 response for viewer limit exceeded
 // Requirement: 7.3
-func (h *Handlers) send503(w http.ResponseWriter, message string) {
+func (h *Handlers) send503(w http.ResponseWriter, r *http.Request, sessionID, message string) {
+	h.store.Metrics().CountResponse(http.StatusServiceUnavailable)
+
+	if sendNegotiatedError(w, r, &ErrorResponse{
+		Code:       ErrCodeTooManyViewers,
+		Status:     http.StatusServiceUnavailable,
+		Message:    message,
+		SessionID:  sessionID,
+		RetryAfter: 30,
+	}) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Retry-After", "30")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
@@ -363,7 +739,18 @@ func (h *Handlers) send503(w http.ResponseWriter, message string) {
 
 // send504 sends a 504 response for CLI timeout
 // Requirement: 7.3
-func (h *Handlers) send504(w http.ResponseWriter, message string) {
+func (h *Handlers) send504(w http.ResponseWriter, r *http.Request, sessionID, message string) {
+	h.store.Metrics().CountResponse(http.StatusGatewayTimeout)
+
+	if sendNegotiatedError(w, r, &ErrorResponse{
+		Code:      ErrCodeGatewayTimeout,
+		Status:    http.StatusGatewayTimeout,
+		Message:   message,
+		SessionID: sessionID,
+	}) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	w.WriteHeader(http.StatusGatewayTimeout)
@@ -391,6 +778,46 @@ func (h *Handlers) send504(w http.ResponseWriter, message string) {
 	w.Write([]byte(html))
 }
 
+// send403 sends a 403 response when access to a session or path is refused
+func (h *Handlers) send403(w http.ResponseWriter, r *http.Request, sessionID, code, message, hint string) {
+	h.accessDenied(r, sessionID, code)
+
+	if sendNegotiatedError(w, r, &ErrorResponse{
+		Code:      code,
+		Status:    http.StatusForbidden,
+		Message:   message,
+		SessionID: sessionID,
+	}) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.WriteHeader(http.StatusForbidden)
+	html := `<!DOCTYPE html>
+<html>
+<head>
+  <title>403 Forbidden - fwdcast</title>
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <style>
+    body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; text-align: center; padding: 50px 20px; background: #f5f5f5; margin: 0; }
+    .container { max-width: 500px; margin: 0 auto; background: white; padding: 40px; border-radius: 8px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
+    h1 { color: #c0392b; margin-bottom: 20px; }
+    p { color: #333; line-height: 1.6; }
+    .hint { color: #666; font-size: 14px; margin-top: 20px; }
+  </style>
+</head>
+<body>
+  <div class="container">
+    <h1>🚫 403 Forbidden</h1>
+    <p>` + message + `</p>
+    <p class="hint">` + hint + `</p>
+  </div>
+</body>
+</html>`
+	w.Write([]byte(html))
+}
+
 // handleAuth handles password authentication for protected sessions
 func (h *Handlers) handleAuth(w http.ResponseWriter, r *http.Request, session *Session, resourcePath string) {
 	redirect := r.URL.Query().Get("redirect")
@@ -404,32 +831,26 @@ func (h *Handlers) handleAuth(w http.ResponseWriter, r *http.Request, session *S
 		password := r.FormValue("password")
 
 		// Rate limiting: check if too many failed attempts
-		session.mu.Lock()
-		if session.FailedAttempts >= 5 {
-			timeSinceLastAttempt := time.Since(session.LastAttemptTime)
-			if timeSinceLastAttempt < 30*time.Second {
-				session.mu.Unlock()
-				h.sendRateLimitPage(w, session.ID, redirect, 30-int(timeSinceLastAttempt.Seconds()))
-				return
-			}
-			// Reset after cooldown
-			session.FailedAttempts = 0
+		if wait := session.beginAuthAttempt(); wait > 0 {
+			h.sendRateLimitPage(w, r, session.ID, redirect, wait)
+			return
 		}
-		session.LastAttemptTime = time.Now()
-		session.mu.Unlock()
 
-		if bcrypt.CompareHashAndPassword(session.PasswordHash, []byte(password)) == nil {
+		if session.checkPassword(password) {
 			// Reset failed attempts on success
-			session.mu.Lock()
-			session.FailedAttempts = 0
-			session.mu.Unlock()
+			h.authSucceeded(r, session, AuthMethodPassword)
 
-			// Set auth cookie with the password (will be verified against hash)
+			// Set auth cookie with a relay-issued token, never the password itself
+			token, expiresAt, err := session.issueAuthToken()
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
 			http.SetCookie(w, &http.Cookie{
 				Name:     "fwdcast_auth_" + session.ID,
-				Value:    password,
+				Value:    token,
 				Path:     "/" + session.ID,
-				MaxAge:   3600, // 1 hour
+				Expires:  expiresAt,
 				HttpOnly: true,
 				Secure:   true,
 				SameSite: http.SameSiteLaxMode,
@@ -439,20 +860,18 @@ func (h *Handlers) handleAuth(w http.ResponseWriter, r *http.Request, session *S
 		}
 
 		// Wrong password - increment failed attempts
-		session.mu.Lock()
-		session.FailedAttempts++
-		session.mu.Unlock()
+		h.authFailed(r, session, AuthMethodPassword)
 
-		h.sendAuthPage(w, session.ID, redirect, true)
+		h.sendAuthPage(w, session, redirect, true)
 		return
 	}
 
 	// GET - show login page
-	h.sendAuthPage(w, session.ID, redirect, false)
+	h.sendAuthPage(w, session, redirect, false)
 }
 
 // sendAuthPage renders the password authentication page
-func (h *Handlers) sendAuthPage(w http.ResponseWriter, sessionID, redirect string, showError bool) {
+func (h *Handlers) sendAuthPage(w http.ResponseWriter, session *Session, redirect string, showError bool) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 
@@ -461,6 +880,29 @@ func (h *Handlers) sendAuthPage(w http.ResponseWriter, sessionID, redirect strin
 		errorHTML = `<div class="error">Incorrect password. Please try again.</div>`
 	}
 
+	// With client-side derivation the password field is never submitted:
+	// the script derives the key into a hidden field and submits that
+	inputHTML := `<input type="password" id="password" name="password" placeholder="Enter password" autofocus required>`
+	if kdf := session.passwordKDF(); kdf != nil {
+		inputHTML = fmt.Sprintf(`<input type="password" id="password" placeholder="Enter password" autofocus required>
+      <input type="hidden" id="key" name="password">
+      <noscript><div class="error">Logging in to this share needs JavaScript.</div></noscript>
+      <script>
+        document.querySelector('form').addEventListener('submit', async (event) => {
+          event.preventDefault();
+          const form = event.target;
+          const material = await crypto.subtle.importKey('raw',
+            new TextEncoder().encode(document.getElementById('password').value), 'PBKDF2', false, ['deriveBits']);
+          const salt = Uint8Array.from(atob('%s'), (c) => c.charCodeAt(0));
+          const bits = await crypto.subtle.deriveBits(
+            { name: 'PBKDF2', hash: 'SHA-256', salt, iterations: %d }, material, 256);
+          document.getElementById('key').value =
+            Array.from(new Uint8Array(bits), (b) => b.toString(16).padStart(2, '0')).join('');
+          form.submit();
+        });
+      </script>`, base64.StdEncoding.EncodeToString(kdf.Salt), kdf.Iterations)
+	}
+
 	html := fmt.Sprintf(`<!DOCTYPE html>
 <html>
 <head>
@@ -559,19 +1001,30 @@ func (h *Handlers) sendAuthPage(w http.ResponseWriter, sessionID, redirect strin
     %s
     <form method="POST" action="/%s/__auth__?redirect=%s">
       <label for="password">Password</label>
-      <input type="password" id="password" name="password" placeholder="Enter password" autofocus required>
+      %s
       <button type="submit">Access Files</button>
     </form>
   </div>
 </body>
-</html>`, errorHTML, sessionID, redirect)
+</html>`, errorHTML, session.ID, redirect, inputHTML)
 
 	w.Write([]byte(html))
 }
 
 // sendRateLimitPage renders the rate limit page
-func (h *Handlers) sendRateLimitPage(w http.ResponseWriter, sessionID, redirect string, secondsRemaining int) {
+func (h *Handlers) sendRateLimitPage(w http.ResponseWriter, r *http.Request, sessionID, redirect string, secondsRemaining int) {
+	if sendNegotiatedError(w, r, &ErrorResponse{
+		Code:       ErrCodeTooManyAttempts,
+		Status:     http.StatusTooManyRequests,
+		Message:    "Too many failed password attempts. Please wait before trying again.",
+		SessionID:  sessionID,
+		RetryAfter: secondsRemaining,
+	}) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Retry-After", fmt.Sprint(secondsRemaining))
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	w.WriteHeader(http.StatusTooManyRequests)
 
@@ -657,10 +1110,14 @@ var responseStates = struct {
 func (h *Handlers) handleResponseMessage(session *Session, msg *ResponseMessage) {
 	pendingReq := h.store.GetPendingRequest(session.ID, msg.ID)
 	if pendingReq == nil {
-		log.Printf("No pending request for response ID: %s", msg.ID)
+		session.logger().Debug("No pending request for response", "request_id", msg.ID)
 		return
 	}
 
+	h.store.Metrics().TimeToFirstByte.Observe(time.Since(pendingReq.StartedAt))
+	pendingReq.trace.responseStarted(msg.Status)
+	pendingReq.streaming.Store(true)
+
 	w := pendingReq.ResponseWriter
 
 	// Set headers from CLI response
@@ -685,11 +1142,11 @@ func (h *Handlers) handleResponseMessage(session *Session, msg *ResponseMessage)
 }
 
 // handleDataMessage processes data chunks from CLI
-// Streams data directly to HTTP response writer without buffering
+// Queues each chunk for the request's handler to write to the viewer
 func (h *Handlers) handleDataMessage(session *Session, msg *DataMessage) {
 	pendingReq := h.store.GetPendingRequest(session.ID, msg.ID)
 	if pendingReq == nil {
-		log.Printf("No pending request for data ID: %s", msg.ID)
+		session.logger().Debug("No pending request for data", "request_id", msg.ID)
 		return
 	}
 
@@ -699,29 +1156,93 @@ func (h *Handlers) handleDataMessage(session *Session, msg *DataMessage) {
 	responseStates.mu.RUnlock()
 
 	if state == nil {
-		log.Printf("No response state for data ID: %s", msg.ID)
+		session.logger().Warn("No response state for data", "request_id", msg.ID)
 		return
 	}
 
 	// Decode base64 chunk
 	chunk, err := base64.StdEncoding.DecodeString(msg.Chunk)
 	if err != nil {
-		log.Printf("Failed to decode data chunk: %v", err)
+		session.logger().Warn("Failed to decode data chunk", "request_id", msg.ID, "error", err)
 		return
 	}
 
-	// Write chunk to response
-	w := pendingReq.ResponseWriter
-	state.mu.Lock()
-	_, err = w.Write(chunk)
-	if state.Flusher != nil {
-		state.Flusher.Flush()
+	// Hand the chunk to the request's handler, which writes it to the viewer
+	pendingReq.chunks.push(chunk)
+}
+
+// writeChunks writes queued body data to the viewer, throttled to the
+// session's bandwidth limit. Data for a viewer that went away is dropped.
+func (h *Handlers) writeChunks(session *Session, pendingReq *PendingRequest) {
+	responseStates.mu.RLock()
+	state := responseStates.states[pendingReq.ID]
+	responseStates.mu.RUnlock()
+
+	for _, chunk := range pendingReq.chunks.take() {
+		if state == nil || pendingReq.canceled.Load() {
+			return
+		}
+
+		// Throttle to the session's bandwidth limit, if any
+		session.Bandwidth.Wait(len(chunk))
+
+		w := pendingReq.ResponseWriter
+		state.mu.Lock()
+		_, err := w.Write(chunk)
+		if state.Flusher != nil {
+			state.Flusher.Flush()
+		}
+		state.mu.Unlock()
+
+		if err != nil {
+			session.logger().Debug("Failed to write data chunk", "request_id", pendingReq.ID, "error", err)
+			session.transferCanceled(pendingReq)
+			return
+		}
+		h.store.Metrics().BytesToViewer.Add(uint64(len(chunk)))
+		session.BytesSent.Add(int64(len(chunk)))
 	}
-	state.mu.Unlock()
+}
 
-	if err != nil {
-		log.Printf("Failed to write data chunk: %v", err)
+// chunkQueue holds decoded body data between the CLI reader and the
+// request's handler. It never blocks the reader.
+type chunkQueue struct {
+	mu     sync.Mutex
+	chunks [][]byte
+	signal chan struct{} // Holds a token while chunks are queued
+}
+
+// ready returns a channel that receives when chunks are queued
+func (q *chunkQueue) ready() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.signal == nil {
+		q.signal = make(chan struct{}, 1)
 	}
+	return q.signal
+}
+
+// push queues a chunk and wakes the handler
+func (q *chunkQueue) push(chunk []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.chunks = append(q.chunks, chunk)
+	if q.signal == nil {
+		q.signal = make(chan struct{}, 1)
+	}
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// take removes and returns all queued chunks
+func (q *chunkQueue) take() [][]byte {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	chunks := q.chunks
+	q.chunks = nil
+	return chunks
 }
 
 // handleEndMessage processes end-of-response from CLI
@@ -729,16 +1250,12 @@ func (h *Handlers) handleDataMessage(session *Session, msg *DataMessage) {
 func (h *Handlers) handleEndMessage(session *Session, msg *EndMessage) {
 	pendingReq := h.store.GetPendingRequest(session.ID, msg.ID)
 	if pendingReq == nil {
-		log.Printf("No pending request for end ID: %s", msg.ID)
+		session.logger().Debug("No pending request for end", "request_id", msg.ID)
 		return
 	}
 
-	// Clean up response state
-	responseStates.mu.Lock()
-	delete(responseStates.states, msg.ID)
-	responseStates.mu.Unlock()
-
-	// Signal that the request is complete
+	// Signal that the request is complete; its handler writes any queued
+	// data and cleans up the response state
 	close(pendingReq.Done)
 }
 
@@ -764,34 +1281,68 @@ func (h *Handlers) HandleViewerWebSocket(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Enforce viewer IP restrictions
+	if !h.checkClientIP(w, r, session) {
+		return
+	}
+
+	// Pages from older CLIs connect here, where the share's cookies are never
+	// sent, so protected shares only accept the Authorization header
+	if !h.viewerSocketAuthorized(w, r, session) {
+		return
+	}
+
+	h.serveViewerSocket(w, r, session)
+}
+
+// viewerSocketAuthorized checks the credentials of a viewer socket opened at
+// /viewer-ws/. Returns true if it may proceed; otherwise the response has
+// been written.
+func (h *Handlers) viewerSocketAuthorized(w http.ResponseWriter, r *http.Request, session *Session) bool {
+	if allow := session.oidcAllowList(); len(allow) > 0 && !h.oidcIdentityAllows(w, r, session, allow) {
+		h.send401(w, r, session.ID, "Login required")
+		return false
+	}
+	if len(session.PasswordHash) > 0 {
+		if r.Header.Get("Authorization") == "" {
+			h.send401(w, r, session.ID, "Password required")
+			return false
+		}
+		return h.authorizeHeader(w, r, session)
+	}
+	return true
+}
+
+// serveViewerSocket upgrades an authorized viewer to the live-update socket
+// and keeps it registered with the session until it disconnects
+func (h *Handlers) serveViewerSocket(w http.ResponseWriter, r *http.Request, session *Session) {
 	// Upgrade to WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("Viewer WebSocket upgrade failed: %v", err)
+		session.logger().Debug("Viewer WebSocket upgrade failed", "error", err)
 		return
 	}
 
-	// Add to session's viewer sockets
+	// Add to session's viewer sockets, queueing the initial state before any
+	// broadcast can reach the new socket
+	viewer := newViewerSocket(conn, h.clientIP(r).String(), r.UserAgent())
 	session.mu.Lock()
-	session.ViewerSockets[conn] = true
-	viewerCount := len(session.ViewerSockets)
-	expiresAt := session.ExpiresAt.Unix()
+	session.ViewerSockets[conn] = viewer
+	initialMsg := fmt.Sprintf(`{"type":"init","viewerCount":%d,"expiresAt":%d,"paused":%t}`,
+		len(session.ViewerSockets), session.ExpiresAt.Unix(), session.Paused)
+	viewer.send([]byte(initialMsg))
 	session.mu.Unlock()
 
-	// Send initial state
-	initialMsg := fmt.Sprintf(`{"type":"init","viewerCount":%d,"expiresAt":%d}`, viewerCount, expiresAt)
-	conn.WriteMessage(websocket.TextMessage, []byte(initialMsg))
-
-	// Broadcast updated viewer count to all viewers
-	h.store.BroadcastViewerCount(sessionID)
+	h.store.Events().Publish(ViewerJoinedEvent{Session: session, Viewer: viewer})
 
 	// Keep connection alive and handle cleanup
 	defer func() {
 		session.mu.Lock()
 		delete(session.ViewerSockets, conn)
 		session.mu.Unlock()
+		viewer.close()
 		conn.Close()
-		h.store.BroadcastViewerCount(sessionID)
+		h.store.Events().Publish(ViewerLeftEvent{Session: session, Viewer: viewer})
 	}()
 
 	// Read messages (mainly for ping/pong and detecting disconnect)
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testRelay is a relay served over HTTP for end-to-end tests
+type testRelay struct {
+	server   *httptest.Server
+	store    *SessionStore
+	handlers *Handlers
+}
+
+// newTestRelay starts a relay with the production routes
+func newTestRelay(t *testing.T) *testRelay {
+	t.Helper()
+	store := NewSessionStore("localhost:8080")
+	h := NewHandlers(store)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", h.HandleWebSocket)
+	mux.HandleFunc("/viewer-ws/", h.HandleViewerWebSocket)
+	mux.HandleFunc("/", h.HandleViewerRequest)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return &testRelay{server: server, store: store, handlers: h}
+}
+
+// websocketDial opens a CLI WebSocket to a test relay
+func websocketDial(tr *testRelay) (*websocket.Conn, *http.Response, error) {
+	return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(tr.server.URL, "http")+"/ws", nil)
+}
+
+// testCLI is a fake CLI connected to a test relay
+type testCLI struct {
+	t         *testing.T
+	conn      *websocket.Conn
+	sessionID string
+}
+
+// connectCLI registers a fake CLI session with the relay
+func (tr *testRelay) connectCLI(t *testing.T, register *RegisterMessage) *testCLI {
+	t.Helper()
+	conn, _, err := websocketDial(tr)
+	if err != nil {
+		t.Fatalf("Failed to connect CLI: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	cli := &testCLI{t: t, conn: conn}
+	cli.send(register)
+	registered, ok := cli.read().(*RegisteredMessage)
+	if !ok {
+		t.Fatal("Expected registered message")
+	}
+	cli.sessionID = registered.SessionID
+	return cli
+}
+
+// send writes a protocol message to the relay
+func (c *testCLI) send(msg interface{}) {
+	c.t.Helper()
+	data, err := SerializeMessage(msg)
+	if err != nil {
+		c.t.Fatalf("Failed to serialize %T: %v", msg, err)
+	}
+	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		c.t.Fatalf("Failed to send %T: %v", msg, err)
+	}
+}
+
+// read reads the next protocol message from the relay
+func (c *testCLI) read() interface{} {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		c.t.Fatalf("Failed to read from relay: %v", err)
+	}
+	msg, err := DeserializeMessage(data)
+	if err != nil {
+		c.t.Fatalf("Failed to parse %s: %v", data, err)
+	}
+	return msg
+}
+
+// serve answers the next request with a 200 and body
+func (c *testCLI) serve(body string) *RequestMessage {
+	c.t.Helper()
+	req, ok := c.read().(*RequestMessage)
+	if !ok {
+		c.t.Fatal("Expected request message")
+	}
+	c.send(NewResponseMessage(req.ID, http.StatusOK, map[string]string{"Content-Type": "text/plain"}))
+	c.send(NewDataMessage(req.ID, base64.StdEncoding.EncodeToString([]byte(body))))
+	c.send(NewEndMessage(req.ID))
+	return req
+}
+
+// TestHandlers_RoundTrip checks a viewer request is served by the CLI through the relay
+func TestHandlers_RoundTrip(t *testing.T) {
+	relay := newTestRelay(t)
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+
+	done := make(chan *RequestMessage)
+	go func() { done <- cli.serve("hello") }()
+
+	resp, err := http.Get(relay.server.URL + "/" + cli.sessionID + "/hello.txt")
+	if err != nil {
+		t.Fatalf("Viewer request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	req := <-done
+	if req.Path != "/hello.txt" || req.Method != http.MethodGet {
+		t.Errorf("Unexpected forwarded request: %+v", req)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Errorf("Expected 200 hello, got %d %q", resp.StatusCode, body)
+	}
+}
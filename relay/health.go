@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Health, Readiness and Build Info
+// Served from an operational namespace of reserved first path segments that
+// are never issued as session IDs, so they can't shadow a share.
+// ============================================================================
+
+// Operational endpoints
+const (
+	HealthPath  = "/healthz"
+	ReadyPath   = "/readyz"
+	VersionPath = "/version"
+)
+
+// DefaultDrainDelay is how long the relay reports not-ready before shutting
+// down, giving load balancers time to stop routing new viewers to it
+const DefaultDrainDelay = 5 * time.Second
+
+// expiryStallThreshold is how long without an expiry sweep before the
+// checker is considered stalled
+const expiryStallThreshold = 3 * ExpiryCheckInterval
+
+// reservedNames are first path segments the relay serves itself
+var reservedNames = map[string]bool{
+	"ws":          true,
+	"viewer-ws":   true,
+	"healthz":     true,
+	"readyz":      true,
+	"version":     true,
+	"metrics":     true,
+	"favicon.ico": true,
+	"robots.txt":  true,
+}
+
+// IsReservedName reports whether name is part of the operational namespace.
+// Names starting with "_" or "." (e.g. __oidc__) are reserved too.
+func IsReservedName(name string) bool {
+	name = strings.ToLower(name)
+	return reservedNames[name] || strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".")
+}
+
+// DrainDelayFromEnv reads DRAIN_DELAY (a duration such as "10s")
+func DrainDelayFromEnv() (time.Duration, error) {
+	value := os.Getenv("DRAIN_DELAY")
+	if value == "" {
+		return DefaultDrainDelay, nil
+	}
+	delay, err := time.ParseDuration(value)
+	if err != nil || delay < 0 {
+		return 0, fmt.Errorf("invalid DRAIN_DELAY %q", value)
+	}
+	return delay, nil
+}
+
+// StartDraining marks the relay as shutting down: readiness fails and new
+// CLI registrations are refused, while existing sessions keep working
+func (h *Handlers) StartDraining() {
+	h.draining.Store(true)
+}
+
+// Draining reports whether the relay is shutting down
+func (h *Handlers) Draining() bool {
+	return h.draining.Load()
+}
+
+// expiryCheckerStalled reports whether the expiry checker has started but
+// not swept recently
+func (s *SessionStore) expiryCheckerStalled() bool {
+	last := s.lastExpirySweep.Load()
+	return last != 0 && time.Since(time.Unix(0, last)) > expiryStallThreshold
+}
+
+// HealthStatus is the body of the health and readiness endpoints
+type HealthStatus struct {
+	Status   string `json:"status"` // ok, ready, draining or stalled
+	Sessions int    `json:"sessions"`
+}
+
+// HandleHealth reports liveness: the process is up and serving HTTP
+func (h *Handlers) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &HealthStatus{Status: "ok", Sessions: h.store.SessionCount()})
+}
+
+// HandleReady reports readiness, failing while draining or if the expiry
+// checker has stalled (sessions would never expire)
+func (h *Handlers) HandleReady(w http.ResponseWriter, r *http.Request) {
+	status := &HealthStatus{Status: "ready", Sessions: h.store.SessionCount()}
+	code := http.StatusOK
+	switch {
+	case h.Draining():
+		status.Status = "draining"
+		code = http.StatusServiceUnavailable
+	case h.store.expiryCheckerStalled():
+		status.Status = "stalled"
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
+// BuildInfo is the body of the version endpoint
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// readBuildInfo collects version control details embedded by the Go toolchain
+func readBuildInfo() *BuildInfo {
+	info := &BuildInfo{Version: "unknown"}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = build.GoVersion
+	if build.Main.Version != "" {
+		info.Version = build.Main.Version
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.BuildTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
+
+// HandleVersion reports the relay's build info
+func (h *Handlers) HandleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, readBuildInfo())
+}
+
+// writeJSON writes an uncacheable JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// runHealthcheck probes the local relay's readiness, for container
+// HEALTHCHECKs in images without curl. Returns the process exit code.
+func runHealthcheck(port string) int {
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get("http://127.0.0.1" + port + ReadyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "healthcheck failed: %v\n", err)
+		return 1
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "healthcheck failed: %s\n", resp.Status)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestReservedNames checks the operational namespace
+func TestReservedNames(t *testing.T) {
+	for _, name := range []string{"healthz", "readyz", "version", "metrics", "ws", "viewer-ws", "__oidc__", "_anything", ".well-known", "Healthz"} {
+		if !IsReservedName(name) {
+			t.Errorf("Expected %q to be reserved", name)
+		}
+	}
+	for _, name := range []string{"a1b2c3d4e5f6", "health"} {
+		if IsReservedName(name) {
+			t.Errorf("Expected %q not to be reserved", name)
+		}
+	}
+}
+
+// TestHandleReady checks readiness fails while draining or when expiry has stalled
+func TestHandleReady(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	h := NewHandlers(store)
+
+	ready := func() (int, string) {
+		w := httptest.NewRecorder()
+		h.HandleReady(w, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+		var status HealthStatus
+		json.Unmarshal(w.Body.Bytes(), &status)
+		return w.Code, status.Status
+	}
+
+	store.StartExpiryChecker()
+	defer store.StopExpiryChecker()
+	if code, status := ready(); code != http.StatusOK || status != "ready" {
+		t.Errorf("Expected ready, got %d %s", code, status)
+	}
+
+	store.lastExpirySweep.Store(time.Now().Add(-time.Hour).UnixNano())
+	if code, status := ready(); code != http.StatusServiceUnavailable || status != "stalled" {
+		t.Errorf("Expected stalled, got %d %s", code, status)
+	}
+
+	h.StartDraining()
+	if code, status := ready(); code != http.StatusServiceUnavailable || status != "draining" {
+		t.Errorf("Expected draining, got %d %s", code, status)
+	}
+
+	// Liveness is unaffected
+	w := httptest.NewRecorder()
+	h.HandleHealth(w, httptest.NewRequest(http.MethodGet, HealthPath, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected liveness 200, got %d", w.Code)
+	}
+}
+
+// TestDraining_RejectsRegistration checks new CLIs are refused while shutting down
+func TestDraining_RejectsRegistration(t *testing.T) {
+	relay := newTestRelay(t)
+	relay.handlers.StartDraining()
+
+	conn, _, err := websocketDial(relay)
+	if err != nil {
+		t.Fatalf("Failed to connect CLI: %v", err)
+	}
+	defer conn.Close()
+
+	cli := &testCLI{t: t, conn: conn}
+	cli.send(NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+	rejected, ok := cli.read().(*RejectedMessage)
+	if !ok || rejected.Code != RejectUnavailable {
+		t.Errorf("Expected unavailable rejection, got %+v", rejected)
+	}
+}
+
+// TestHandleVersion checks build info is reported
+func TestHandleVersion(t *testing.T) {
+	h := NewHandlers(NewSessionStore("localhost:8080"))
+	w := httptest.NewRecorder()
+	h.HandleVersion(w, httptest.NewRequest(http.MethodGet, VersionPath, nil))
+
+	var info BuildInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if info.Version == "" || info.GoVersion == "" {
+		t.Errorf("Expected version and Go version, got %+v", info)
+	}
+}
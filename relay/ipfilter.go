@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// ============================================================================
+// Viewer IP Filtering
+// ============================================================================
+
+// IPFilter restricts which client addresses may view a session.
+// Deny rules win over allow rules; an empty allow list allows everyone.
+type IPFilter struct {
+	Allow []netip.Prefix
+	Deny  []netip.Prefix
+}
+
+// ParseCIDRList parses CIDR ranges, also accepting bare IP addresses
+// as single-host ranges
+func ParseCIDRList(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP or CIDR %q", entry)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// NewIPFilter builds a filter from allow and deny CIDR lists.
+// Returns nil (no filtering) if both lists are empty.
+func NewIPFilter(allow, deny []string) (*IPFilter, error) {
+	allowPrefixes, err := ParseCIDRList(allow)
+	if err != nil {
+		return nil, err
+	}
+	denyPrefixes, err := ParseCIDRList(deny)
+	if err != nil {
+		return nil, err
+	}
+	if len(allowPrefixes) == 0 && len(denyPrefixes) == 0 {
+		return nil, nil
+	}
+	return &IPFilter{Allow: allowPrefixes, Deny: denyPrefixes}, nil
+}
+
+// Allows reports whether addr may access the session
+func (f *IPFilter) Allows(addr netip.Addr) bool {
+	if f == nil {
+		return true
+	}
+	if !addr.IsValid() {
+		return false
+	}
+	addr = addr.Unmap()
+	if prefixesContain(f.Deny, addr) {
+		return false
+	}
+	return len(f.Allow) == 0 || prefixesContain(f.Allow, addr)
+}
+
+// prefixesContain reports whether any prefix contains addr
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustedProxiesFromEnv reads the TRUSTED_PROXIES env var, a comma-separated
+// list of proxy addresses or CIDRs whose X-Forwarded-For headers are believed
+func TrustedProxiesFromEnv() ([]netip.Prefix, error) {
+	value := os.Getenv("TRUSTED_PROXIES")
+	if value == "" {
+		return nil, nil
+	}
+	return ParseCIDRList(strings.Split(value, ","))
+}
+
+// SetTrustedProxies sets the reverse proxies allowed to report client addresses
+func (h *Handlers) SetTrustedProxies(proxies []netip.Prefix) {
+	h.trustedProxies = proxies
+}
+
+// clientIP determines the viewer's address. X-Forwarded-For is only used when
+// the connection comes from a trusted proxy, and is walked right to left so
+// a client cannot spoof its address by sending its own header.
+func (h *Handlers) clientIP(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr = addr.Unmap()
+
+	if !prefixesContain(h.trustedProxies, addr) {
+		return addr
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !prefixesContain(h.trustedProxies, addr) {
+			return addr
+		}
+	}
+	return addr
+}
+
+// SetIPFilter sets the viewer IP filter for a session
+func (s *SessionStore) SetIPFilter(id string, filter *IPFilter) error {
+	session := s.GetSession(id)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+
+	session.mu.Lock()
+	session.IPFilter = filter
+	session.mu.Unlock()
+	return nil
+}
+
+// checkClientIP enforces the session's IP filter.
+// Returns true if the request may proceed; otherwise the response has been written.
+func (h *Handlers) checkClientIP(w http.ResponseWriter, r *http.Request, session *Session) bool {
+	session.mu.Lock()
+	filter := session.IPFilter
+	session.mu.Unlock()
+
+	if filter.Allows(h.clientIP(r)) {
+		return true
+	}
+	h.send403(w, r, session.ID, ErrCodeIPNotAllowed, "Your network is not allowed to access this share.",
+		"The sharer has restricted this session to specific IP ranges.<br>Connect from an allowed network (e.g. your office VPN) and try again.")
+	return false
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// TestIPFilter_Allows checks allow/deny evaluation, with deny taking precedence
+func TestIPFilter_Allows(t *testing.T) {
+	filter, err := NewIPFilter([]string{"10.0.0.0/8", "2001:db8::/32"}, []string{"10.0.5.0/24", "10.1.2.3"})
+	if err != nil {
+		t.Fatalf("Failed to build filter: %v", err)
+	}
+
+	cases := map[string]bool{
+		"10.2.3.4":        true,
+		"10.0.5.7":        false, // Denied range inside allowed range
+		"10.1.2.3":        false, // Bare IP deny
+		"192.168.1.1":     false, // Not in allow list
+		"2001:db8::1":     true,
+		"::ffff:10.2.3.4": true, // IPv4-mapped IPv6
+	}
+	for ip, want := range cases {
+		if got := filter.Allows(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("Allows(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	if _, err := NewIPFilter([]string{"10.0.0.0/33"}, nil); err == nil {
+		t.Error("Expected invalid CIDR to be rejected")
+	}
+	if f, _ := NewIPFilter(nil, nil); f != nil || !f.Allows(netip.MustParseAddr("1.2.3.4")) {
+		t.Error("Expected empty lists to mean no filtering")
+	}
+}
+
+// TestClientIP_TrustedProxies checks X-Forwarded-For is only honored from trusted proxies
+func TestClientIP_TrustedProxies(t *testing.T) {
+	h := NewHandlers(NewSessionStore("localhost:8080"))
+	proxies, _ := ParseCIDRList([]string{"127.0.0.1", "172.16.0.0/12"})
+	h.SetTrustedProxies(proxies)
+
+	cases := []struct {
+		remote, xff, want string
+	}{
+		{"203.0.113.9:5000", "10.0.0.1", "203.0.113.9"},              // Untrusted peer, header ignored
+		{"127.0.0.1:5000", "198.51.100.7", "198.51.100.7"},           // Trusted proxy
+		{"127.0.0.1:5000", "10.0.0.1, 198.51.100.7", "198.51.100.7"}, // Spoofed leftmost entry ignored
+		{"127.0.0.1:5000", "198.51.100.7, 172.16.0.2", "198.51.100.7"},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/abc/", nil)
+		r.RemoteAddr = tc.remote
+		r.Header.Set("X-Forwarded-For", tc.xff)
+		if got := h.clientIP(r); got.String() != tc.want {
+			t.Errorf("clientIP(%s, %q) = %s, want %s", tc.remote, tc.xff, got, tc.want)
+		}
+	}
+}
+
+// TestHandleViewerRequest_IPDenied checks the 403 response for disallowed viewers
+func TestHandleViewerRequest_IPDenied(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	h := NewHandlers(store)
+	session, _ := store.CreateSession(nil, time.Now().Add(30*time.Minute))
+	filter, _ := NewIPFilter([]string{"10.0.0.0/8"}, nil)
+	store.SetIPFilter(session.ID, filter)
+
+	cases := []struct {
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"/" + session.ID + "/", h.HandleViewerRequest},
+		{"/viewer-ws/" + session.ID, h.HandleViewerWebSocket},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		tc.handler(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status 403, got %d", tc.path, w.Code)
+		}
+	}
+}
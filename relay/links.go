@@ -0,0 +1,307 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ============================================================================
+// One-Time and Limited-Use Links
+// URL format: /{session-id}/t/{token}/path/to/file
+//
+// A link bypasses the session password for its path scope. Each use is one
+// visit, not one request: the first request through the link uses it up and
+// leaves a short-lived grant cookie, so the files in a shared directory
+// listing can still be opened.
+// ============================================================================
+
+// AccessLinkGrantTTL is how long a visit through a link may continue after
+// it used up one of the link's uses
+const AccessLinkGrantTTL = 15 * time.Minute
+
+// AccessLink is a capability link that bypasses the session password
+// for a limited number of visits
+type AccessLink struct {
+	Token     string
+	Path      string // Path scope, as for signed URLs ("/" = whole share)
+	MaxUses   int
+	Uses      int
+	ExpiresAt time.Time
+}
+
+// Allows reports whether resourcePath falls within the link's scope
+func (l *AccessLink) Allows(resourcePath string) bool {
+	return scopeAllows(l.Path, resourcePath)
+}
+
+// Error types for access links
+var (
+	ErrAccessLinkNotFound = errors.New("access link not found")
+	ErrAccessLinkUsed     = errors.New("access link already used")
+	ErrAccessLinkExpired  = errors.New("access link expired")
+	ErrAccessLinkScope    = errors.New("path outside access link scope")
+)
+
+// accessLinkPrefix marks a limited-use link within a session path
+const accessLinkPrefix = "/t/"
+
+// linkGrantCookiePrefix names the cookie that continues a visit through a link
+const linkGrantCookiePrefix = "fwdcast_link_"
+
+// generateLinkToken creates a random, unguessable link token
+// Returns a 32-character hex string (16 bytes = 128 bits of entropy)
+func generateLinkToken() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// CreateAccessLink issues a new limited-use link for a path within a session
+// ("" or "/" for the whole share). A zero expiresAt, or one past the session
+// expiry, is capped to the session expiry.
+func (s *SessionStore) CreateAccessLink(sessionID, scope string, maxUses int, expiresAt time.Time) (*AccessLink, error) {
+	session := s.GetSession(sessionID)
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	token, err := generateLinkToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate link token: %w", err)
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if expiresAt.IsZero() || expiresAt.After(session.ExpiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+	link := &AccessLink{
+		Token:     token,
+		Path:      cleanResourcePath(scope),
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt,
+	}
+	session.AccessLinks[token] = link
+	return link, nil
+}
+
+// CheckAccessLink reports whether a link exists and still has uses left,
+// without consuming one
+func (s *SessionStore) CheckAccessLink(sessionID, token string) error {
+	return s.useAccessLink(sessionID, token, "", false)
+}
+
+// CheckAccessLinkPath is CheckAccessLink for a request for resourcePath,
+// which must also fall within the link's scope
+func (s *SessionStore) CheckAccessLinkPath(sessionID, token, resourcePath string) error {
+	return s.useAccessLink(sessionID, token, resourcePath, false)
+}
+
+// ConsumeAccessLink atomically uses up one use of a link
+func (s *SessionStore) ConsumeAccessLink(sessionID, token string) error {
+	return s.useAccessLink(sessionID, token, "", true)
+}
+
+// useAccessLink validates a link (and, unless resourcePath is empty, its
+// scope) and optionally consumes one use, holding the session lock so
+// concurrent viewers cannot overspend it
+func (s *SessionStore) useAccessLink(sessionID, token, resourcePath string, consume bool) error {
+	session := s.GetSession(sessionID)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	link := session.AccessLinks[token]
+	if link == nil {
+		return ErrAccessLinkNotFound
+	}
+	if time.Now().After(link.ExpiresAt) {
+		return ErrAccessLinkExpired
+	}
+	if resourcePath != "" && !link.Allows(resourcePath) {
+		return ErrAccessLinkScope
+	}
+	if link.Uses >= link.MaxUses {
+		return ErrAccessLinkUsed
+	}
+	if consume {
+		link.Uses++
+	}
+	return nil
+}
+
+// GenerateLinkURL creates the public URL for a limited-use link
+func (s *SessionStore) GenerateLinkURL(sessionID string, link *AccessLink) string {
+	return s.GenerateURL(sessionID) + "t/" + link.Token + link.Path
+}
+
+// linkGrantSignature computes the HMAC for a link grant cookie
+func (s *SessionStore) linkGrantSignature(sessionID, token string, expiresAt int64) []byte {
+	mac := hmac.New(sha256.New, s.signingKey)
+	fmt.Fprintf(mac, "link\n%s\n%s\n%d", sessionID, token, expiresAt)
+	return mac.Sum(nil)
+}
+
+// setLinkGrantCookie lets the rest of a visit through a link proceed without
+// using it again. The grant ends after AccessLinkGrantTTL, or with the link.
+func (h *Handlers) setLinkGrantCookie(w http.ResponseWriter, sessionID, token string) {
+	session := h.store.GetSession(sessionID)
+	if session == nil {
+		return
+	}
+	expiresAt := time.Now().Add(AccessLinkGrantTTL)
+	session.mu.Lock()
+	if link := session.AccessLinks[token]; link != nil && link.ExpiresAt.Before(expiresAt) {
+		expiresAt = link.ExpiresAt
+	}
+	session.mu.Unlock()
+
+	exp := expiresAt.Unix()
+	http.SetCookie(w, &http.Cookie{
+		Name:     linkGrantCookiePrefix + sessionID,
+		Value:    token + "." + strconv.FormatInt(exp, 10) + "." + hex.EncodeToString(h.store.linkGrantSignature(sessionID, token, exp)),
+		Path:     "/" + sessionID,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// linkGrantAllows reports whether the request carries a link grant cookie
+// covering resourcePath. If token is not empty, the grant must be for that link.
+func (h *Handlers) linkGrantAllows(r *http.Request, sessionID, token, resourcePath string) bool {
+	cookie, err := r.Cookie(linkGrantCookiePrefix + sessionID)
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 || (token != "" && parts[0] != token) {
+		return false
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	sig, err := hex.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, h.store.linkGrantSignature(sessionID, parts[0], exp)) {
+		return false
+	}
+
+	session := h.store.GetSession(sessionID)
+	if session == nil {
+		return false
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	link := session.AccessLinks[parts[0]]
+	return link != nil && time.Now().Before(link.ExpiresAt) && link.Allows(resourcePath)
+}
+
+// parseAccessLinkPath splits "/t/{token}/rest" into the token and "/rest"
+func parseAccessLinkPath(resourcePath string) (token, rest string, ok bool) {
+	if !strings.HasPrefix(resourcePath, accessLinkPrefix) {
+		return "", "", false
+	}
+	token, rest, _ = strings.Cut(strings.TrimPrefix(resourcePath, accessLinkPrefix), "/")
+	if token == "" {
+		return "", "", false
+	}
+	return token, "/" + rest, true
+}
+
+// handleCreateLinkMessage issues a limited-use link requested by the CLI
+func (h *Handlers) handleCreateLinkMessage(session *Session, msg *CreateLinkMessage) {
+	var expiresAt time.Time
+	if msg.ExpiresAt != 0 {
+		expiresAt = time.Unix(msg.ExpiresAt, 0)
+	}
+
+	// Answer either way, so the CLI isn't left waiting
+	var reply *LinkCreatedMessage
+	var link *AccessLink
+	err := ErrExpiryInPast
+	if expiresAt.IsZero() || expiresAt.After(time.Now()) {
+		link, err = h.store.CreateAccessLink(session.ID, msg.Path, msg.MaxUses, expiresAt)
+	}
+	if err != nil {
+		session.logger().Warn("Failed to create access link", "error", err)
+		reply = &LinkCreatedMessage{Type: TypeLinkCreated, ID: msg.ID, Error: err.Error()}
+	} else {
+		url := h.store.GenerateLinkURL(session.ID, link)
+		reply = NewLinkCreatedMessage(msg.ID, link.Token, url, link.Path, link.MaxUses, link.ExpiresAt.Unix())
+	}
+
+	respBytes, err := SerializeMessage(reply)
+	if err != nil {
+		session.logger().Error("Failed to serialize linkCreated message", "error", err)
+		return
+	}
+
+	session.mu.Lock()
+	err = session.WebSocket.WriteMessage(websocket.TextMessage, respBytes)
+	session.mu.Unlock()
+	if err != nil {
+		session.logger().Warn("Failed to send linkCreated message", "error", err)
+	}
+}
+
+// send410 sends a 410 response for a used-up or expired access link
+func (h *Handlers) send410(w http.ResponseWriter, r *http.Request, sessionID string, linkErr error) {
+	code, title, message := ErrCodeLinkUsed, "Link Already Used", "This link has already been used."
+	if errors.Is(linkErr, ErrAccessLinkExpired) {
+		code, title, message = ErrCodeLinkExpired, "Link Expired", "This link has expired."
+	}
+	h.accessDenied(r, sessionID, code)
+
+	if sendNegotiatedError(w, r, &ErrorResponse{
+		Code:      code,
+		Status:    http.StatusGone,
+		Message:   message,
+		SessionID: sessionID,
+	}) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.WriteHeader(http.StatusGone)
+	html := `<!DOCTYPE html>
+<html>
+<head>
+  <title>410 ` + title + ` - fwdcast</title>
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <style>
+    body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; text-align: center; padding: 50px 20px; background: #f5f5f5; margin: 0; }
+    .container { max-width: 500px; margin: 0 auto; background: white; padding: 40px; border-radius: 8px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
+    h1 { color: #7f8c8d; margin-bottom: 20px; }
+    p { color: #333; line-height: 1.6; }
+    .hint { color: #666; font-size: 14px; margin-top: 20px; }
+  </style>
+</head>
+<body>
+  <div class="container">
+    <h1>🔗 410 ` + title + `</h1>
+    <p>` + message + `</p>
+    <p class="hint">Limited-use links stop working once they have been used or expire.<br>Ask the sender for a new link.</p>
+  </div>
+</body>
+</html>`
+	w.Write([]byte(html))
+}
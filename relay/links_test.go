@@ -0,0 +1,250 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// Feature: fwdcast, Property: Limited-Use Links Are Never Overspent
+// For any use limit and number of concurrent viewers, exactly
+// min(maxUses, viewers) consumptions succeed.
+func TestProperty_AccessLinkUsesConsumedAtomically(t *testing.T) {
+	config := &quick.Config{
+		MaxCount: 50,
+	}
+
+	f := func(maxUsesSeed, viewersSeed uint8) bool {
+		maxUses := int(maxUsesSeed%5) + 1
+		viewers := int(viewersSeed%20) + 1
+
+		store := NewSessionStore("localhost:8080")
+		session, err := store.CreateSession(nil, time.Now().Add(30*time.Minute))
+		if err != nil {
+			return false
+		}
+		link, err := store.CreateAccessLink(session.ID, "", maxUses, time.Time{})
+		if err != nil {
+			return false
+		}
+
+		var succeeded int32
+		var wg sync.WaitGroup
+		for i := 0; i < viewers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if store.ConsumeAccessLink(session.ID, link.Token) == nil {
+					atomic.AddInt32(&succeeded, 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		want := maxUses
+		if viewers < want {
+			want = viewers
+		}
+		return int(succeeded) == want
+	}
+
+	if err := quick.Check(f, config); err != nil {
+		t.Errorf("Access link property failed: %v", err)
+	}
+}
+
+// TestAccessLink_ExpiryCappedToSession checks links never outlive their session
+func TestAccessLink_ExpiryCappedToSession(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	sessionExpiry := time.Now().Add(10 * time.Minute)
+	session, _ := store.CreateSession(nil, sessionExpiry)
+
+	link, err := store.CreateAccessLink(session.ID, "", 1, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	if link.ExpiresAt.After(sessionExpiry) {
+		t.Errorf("Link expiry %v is after session expiry %v", link.ExpiresAt, sessionExpiry)
+	}
+
+	expired, _ := store.CreateAccessLink(session.ID, "", 1, time.Now().Add(-time.Second))
+	if err := store.CheckAccessLink(session.ID, expired.Token); err != ErrAccessLinkExpired {
+		t.Errorf("Expected ErrAccessLinkExpired, got %v", err)
+	}
+}
+
+// TestParseAccessLinkPath checks splitting of /t/{token}/path
+func TestParseAccessLinkPath(t *testing.T) {
+	cases := []struct {
+		path, token, rest string
+		ok                bool
+	}{
+		{"/t/abc/file.txt", "abc", "/file.txt", true},
+		{"/t/abc/", "abc", "/", true},
+		{"/t/abc", "abc", "/", true},
+		{"/t/", "", "", false},
+		{"/docs/t/abc", "", "", false},
+	}
+
+	for _, tc := range cases {
+		token, rest, ok := parseAccessLinkPath(tc.path)
+		if token != tc.token || rest != tc.rest || ok != tc.ok {
+			t.Errorf("parseAccessLinkPath(%q) = %q, %q, %v", tc.path, token, rest, ok)
+		}
+	}
+}
+
+// TestHandleViewerRequest_UsedLink checks the "link already used" response
+func TestHandleViewerRequest_UsedLink(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	h := NewHandlers(store)
+	session, _ := store.CreateSessionWithPassword(nil, time.Now().Add(30*time.Minute), "secret")
+	link, _ := store.CreateAccessLink(session.ID, "", 1, time.Time{})
+
+	if err := store.ConsumeAccessLink(session.ID, link.Token); err != nil {
+		t.Fatalf("Expected first use to succeed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.HandleViewerRequest(w, httptest.NewRequest(http.MethodGet, "/"+session.ID+"/t/"+link.Token+"/file.txt", nil))
+	if w.Code != http.StatusGone {
+		t.Errorf("Expected status 410, got %d", w.Code)
+	}
+
+	// Unknown tokens fall through to the normal password check
+	w = httptest.NewRecorder()
+	h.HandleViewerRequest(w, httptest.NewRequest(http.MethodGet, "/"+session.ID+"/t/unknown/file.txt", nil))
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected redirect to login, got %d", w.Code)
+	}
+}
+
+// TestHandleViewerRequest_ExpiredLink checks the 410 page names an expired
+// link as expired rather than used
+func TestHandleViewerRequest_ExpiredLink(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	h := NewHandlers(store)
+	session, _ := store.CreateSessionWithPassword(nil, time.Now().Add(30*time.Minute), "secret")
+	link, _ := store.CreateAccessLink(session.ID, "", 1, time.Now().Add(-time.Minute))
+
+	w := httptest.NewRecorder()
+	h.HandleViewerRequest(w, httptest.NewRequest(http.MethodGet, "/"+session.ID+"/t/"+link.Token+"/file.txt", nil))
+	if w.Code != http.StatusGone {
+		t.Fatalf("Expected status 410, got %d", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "<title>410 Link Expired") || strings.Contains(body, "Already Used") {
+		t.Errorf("Expected an expired-link page, got %q", body)
+	}
+}
+
+// TestAccessLink_VisitUsesOnce checks a one-time link to a directory is used
+// up by the visit, not by each file opened from the listing
+func TestAccessLink_VisitUsesOnce(t *testing.T) {
+	relay := newTestRelay(t)
+	register := NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix())
+	register.Password = "secret"
+	cli := relay.connectCLI(t, register)
+	link, _ := relay.store.CreateAccessLink(cli.sessionID, "/docs/", 1, time.Time{})
+	if url := relay.store.GenerateLinkURL(cli.sessionID, link); url != relay.store.GenerateURL(cli.sessionID)+"t/"+link.Token+"/docs/" {
+		t.Errorf("Unexpected link URL %s", url)
+	}
+
+	get := func(path string, cookies []*http.Cookie) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, relay.server.URL+"/"+cli.sessionID+path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("Viewer request failed: %v", err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	listed := make(chan struct{})
+	go func() {
+		cli.serve("listing")
+		close(listed)
+	}()
+	first := get("/t/"+link.Token+"/docs/", nil)
+	<-listed
+	if first.StatusCode != http.StatusOK || len(first.Cookies()) != 1 {
+		t.Fatalf("Expected the listing and a grant cookie, got %d %v", first.StatusCode, first.Cookies())
+	}
+	grant := first.Cookies()
+
+	// Files in the listing, with or without the link prefix
+	for _, path := range []string{"/docs/a.txt", "/t/" + link.Token + "/docs/b.txt"} {
+		served := make(chan struct{})
+		go func() {
+			if req := cli.serve("file"); req.Path != strings.TrimPrefix(path, "/t/"+link.Token) {
+				t.Errorf("Expected %s forwarded, got %s", path, req.Path)
+			}
+			close(served)
+		}()
+		if resp := get(path, grant); resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected %s served on the grant, got %d", path, resp.StatusCode)
+		}
+		<-served
+	}
+
+	// Outside the link's scope, the password is still required
+	if resp := get("/private.txt", grant); resp.StatusCode != http.StatusFound {
+		t.Errorf("Expected redirect to login outside the scope, got %d", resp.StatusCode)
+	}
+	if resp := get("/t/"+link.Token+"/private.txt", grant); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 for a path outside the link, got %d", resp.StatusCode)
+	}
+
+	// Without the grant, the link is used up
+	if resp := get("/t/"+link.Token+"/docs/a.txt", nil); resp.StatusCode != http.StatusGone {
+		t.Errorf("Expected 410 for a second visit, got %d", resp.StatusCode)
+	}
+}
+
+// TestAccessLink_ForgedGrant checks grant cookies can't be made up
+func TestAccessLink_ForgedGrant(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	h := NewHandlers(store)
+	session, _ := store.CreateSessionWithPassword(nil, time.Now().Add(30*time.Minute), "secret")
+	link, _ := store.CreateAccessLink(session.ID, "", 1, time.Time{})
+
+	exp := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	for _, value := range []string{link.Token, link.Token + "." + exp + ".00", "other." + exp + ".00"} {
+		req := httptest.NewRequest(http.MethodGet, "/"+session.ID+"/file.txt", nil)
+		req.AddCookie(&http.Cookie{Name: linkGrantCookiePrefix + session.ID, Value: value})
+		if h.linkGrantAllows(req, session.ID, "", "/file.txt") {
+			t.Errorf("Expected grant %q to be refused", value)
+		}
+	}
+}
+
+// TestCreateLinkMessage_Replies checks the CLI gets a linkCreated answer
+// whether or not the link could be issued
+func TestCreateLinkMessage_Replies(t *testing.T) {
+	relay := newTestRelay(t)
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+
+	cli.send(&CreateLinkMessage{Type: TypeCreateLink, ID: "ok", MaxUses: 1, Path: "/docs/"})
+	created, ok := cli.read().(*LinkCreatedMessage)
+	if !ok || created.ID != "ok" || created.Error != "" || created.URL == "" || created.Path != "/docs/" {
+		t.Errorf("Expected a link for /docs/, got %+v", created)
+	}
+
+	cli.send(&CreateLinkMessage{Type: TypeCreateLink, ID: "past", MaxUses: 1, ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	refused, ok := cli.read().(*LinkCreatedMessage)
+	if !ok || refused.ID != "past" || refused.Error == "" || refused.URL != "" {
+		t.Errorf("Expected an error for an expiry in the past, got %+v", refused)
+	}
+}
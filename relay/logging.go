@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// ============================================================================
+// Structured Logging
+// Records carry the session ID, request ID and other context as attributes.
+// Paths are logged as a short hash, since file names in a share may be private.
+// ============================================================================
+
+// LoggerFromEnv builds the relay logger from LOG_LEVEL (debug, info, warn,
+// error; default info) and LOG_FORMAT (text or json; default text)
+func LoggerFromEnv(w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL %q", value)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q (want text or json)", format)
+	}
+}
+
+// pathHash returns a short, stable hash of a request path so requests for
+// the same file can be correlated without logging the file name
+func pathHash(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:6])
+}
+
+// logger returns a logger that tags records with the session ID
+func (s *Session) logger() *slog.Logger {
+	return slog.With("session_id", s.ID)
+}
+
+// loggingResponseWriter records the status and body size of a viewer response
+// (counters are atomic since the CLI's goroutine writes the response)
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status atomic.Int32
+	bytes  atomic.Int64
+}
+
+func (lw *loggingResponseWriter) WriteHeader(status int) {
+	lw.status.CompareAndSwap(0, int32(status))
+	lw.ResponseWriter.WriteHeader(status)
+}
+
+func (lw *loggingResponseWriter) Write(b []byte) (int, error) {
+	lw.status.CompareAndSwap(0, http.StatusOK)
+	n, err := lw.ResponseWriter.Write(b)
+	lw.bytes.Add(int64(n))
+	return n, err
+}
+
+// Flush passes through so streamed responses still reach the viewer promptly
+func (lw *loggingResponseWriter) Flush() {
+	if flusher, ok := lw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack passes through so viewer sockets can be upgraded behind the logger
+func (lw *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	lw.status.CompareAndSwap(0, http.StatusSwitchingProtocols)
+	return http.NewResponseController(lw.ResponseWriter).Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (lw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
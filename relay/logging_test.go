@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestLoggerFromEnv checks the log level and JSON format settings
+func TestLoggerFromEnv(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("LOG_FORMAT", "json")
+
+	var buf bytes.Buffer
+	logger, err := LoggerFromEnv(&buf)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	logger.Info("dropped")
+	logger.Warn("kept", "session_id", "abc123def456")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a single JSON record, got %q", buf.String())
+	}
+	if record["msg"] != "kept" || record["session_id"] != "abc123def456" {
+		t.Errorf("Unexpected record: %v", record)
+	}
+}
+
+// TestLoggerFromEnv_Invalid checks bad settings are refused at startup
+func TestLoggerFromEnv_Invalid(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "loud")
+	if _, err := LoggerFromEnv(&bytes.Buffer{}); err == nil {
+		t.Error("Expected error for invalid LOG_LEVEL")
+	}
+
+	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("LOG_FORMAT", "xml")
+	if _, err := LoggerFromEnv(&bytes.Buffer{}); err == nil {
+		t.Error("Expected error for invalid LOG_FORMAT")
+	}
+}
+
+// TestPathHash checks paths hash stably without revealing the path
+func TestPathHash(t *testing.T) {
+	a := pathHash("/abc123def456/secret-plans.pdf")
+	if a != pathHash("/abc123def456/secret-plans.pdf") {
+		t.Error("Expected hash to be stable")
+	}
+	if a == pathHash("/abc123def456/other.pdf") {
+		t.Error("Expected different paths to hash differently")
+	}
+	if len(a) != 12 {
+		t.Errorf("Expected 12-character hash, got %q", a)
+	}
+}
+
+// TestLoggingResponseWriter checks status and byte counts are recorded
+func TestLoggingResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	lw := &loggingResponseWriter{ResponseWriter: rec}
+	lw.Write([]byte("hello"))
+	lw.Write([]byte(" world"))
+	lw.Flush()
+
+	if lw.status.Load() != http.StatusOK || lw.bytes.Load() != 11 {
+		t.Errorf("Expected 200 and 11 bytes, got %d and %d", lw.status.Load(), lw.bytes.Load())
+	}
+	if !rec.Flushed {
+		t.Error("Expected flush to pass through")
+	}
+}
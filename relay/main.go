@@ -1,33 +1,258 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// ShutdownTimeout bounds how long in-flight viewer requests get to finish
+const ShutdownTimeout = 30 * time.Second
+
 func main() {
 	port := ":8080"
+
+	// "fwdcast-relay healthcheck" probes a running relay (for Docker HEALTHCHECK)
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(runHealthcheck(port))
+	}
+
+	// Configure logging first so startup errors are structured too
+	logger, err := LoggerFromEnv(os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging config: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
 	host := os.Getenv("RELAY_HOST")
 	if host == "" {
 		host = "localhost:8080"
 	}
 
+	// Configure password hashing
+	hasher, err := PasswordHasherFromEnv()
+	if err != nil {
+		fatal("Invalid password hashing config", err)
+	}
+
+	// Configure warnings ahead of session expiry
+	expiryWarnings, err := ExpiryWarningsFromEnv()
+	if err != nil {
+		fatal("Invalid expiry warning config", err)
+	}
+
+	// Cap how long sessions may last
+	maxDuration, err := MaxSessionDurationFromEnv()
+	if err != nil {
+		fatal("Invalid session duration limit", err)
+	}
+
 	// Create session store
 	store := NewSessionStore(host)
+	store.SetPasswordHasher(hasher)
+	store.SetExpiryWarningThresholds(expiryWarnings)
+	store.SetMaxSessionDuration(maxDuration)
 	store.StartExpiryChecker()
 	defer store.StopExpiryChecker()
 
 	// Create handlers
 	handlers := NewHandlers(store)
+	trustedProxies, err := TrustedProxiesFromEnv()
+	if err != nil {
+		fatal("Invalid TRUSTED_PROXIES", err)
+	}
+	handlers.SetTrustedProxies(trustedProxies)
+
+	// Require API keys for CLI registration if a key store is configured
+	apiKeys, err := APIKeyStoreFromEnv()
+	if err != nil {
+		fatal("Failed to load API keys", err)
+	}
+	if apiKeys != nil {
+		handlers.SetAPIKeyStore(apiKeys)
+	}
+
+	// Write an access log of viewer requests if configured
+	accessLog, err := AccessLoggerFromEnv()
+	if err != nil {
+		fatal("Invalid access log config", err)
+	}
+	if accessLog != nil {
+		handlers.SetAccessLogger(accessLog)
+	}
+
+	// Keep an audit log of share activity if configured
+	auditLog, err := AuditLoggerFromEnv()
+	if err != nil {
+		fatal("Invalid audit log config", err)
+	}
+	if auditLog != nil {
+		handlers.SetAuditLogger(auditLog)
+	}
+
+	// Save a summary report for each session that ends if configured
+	reports, err := ReportWriterFromEnv()
+	if err != nil {
+		fatal("Invalid reports config", err)
+	}
+	if reports != nil {
+		handlers.SetReportWriter(reports)
+	}
+
+	// Trace viewer requests if an exporter is configured
+	tracer, err := TracerFromEnv()
+	if err != nil {
+		fatal("Invalid tracing config", err)
+	}
+	if tracer != nil {
+		handlers.SetTracer(tracer)
+	}
+
+	// Enable the OIDC access mode if an issuer is configured
+	oidcConfig, err := OIDCConfigFromEnv()
+	if err != nil {
+		fatal("Invalid OIDC config", err)
+	}
+	if oidcConfig != nil {
+		provider, err := NewOIDCProvider(context.Background(), *oidcConfig)
+		if err != nil {
+			fatal("Failed to set up OIDC", err)
+		}
+		handlers.SetOIDCProvider(provider)
+	}
+
+	// Send session lifecycle webhooks if configured
+	webhookConfig, err := WebhookConfigFromEnv()
+	if err != nil {
+		fatal("Invalid webhook config", err)
+	}
+	var webhooks *WebhookDispatcher
+	if webhookConfig != nil {
+		webhooks = NewWebhookDispatcher(*webhookConfig)
+		store.SetWebhooks(webhooks)
+	}
+
+	adminConfig, err := AdminConfigFromEnv()
+	if err != nil {
+		fatal("Invalid admin config", err)
+	}
+
+	metricsToken, err := MetricsTokenFromEnv()
+	if err != nil {
+		fatal("Invalid metrics config", err)
+	}
+
+	drainDelay, err := DrainDelayFromEnv()
+	if err != nil {
+		fatal("Invalid drain config", err)
+	}
 
 	// Register routes
+	http.HandleFunc(HealthPath, handlers.HandleHealth)
+	http.HandleFunc(ReadyPath, handlers.HandleReady)
+	http.HandleFunc(VersionPath, handlers.HandleVersion)
 	http.HandleFunc("/ws", handlers.HandleWebSocket)
 	http.HandleFunc("/viewer-ws/", handlers.HandleViewerWebSocket)
-	http.HandleFunc("/", handlers.HandleViewerRequest)
+	http.HandleFunc(OIDCCallbackPath, handlers.HandleOIDCCallback)
+	http.HandleFunc("/", handlers.WithAccessLog(handlers.HandleViewerRequest))
+
+	// Serve the admin API and metrics on the main listener, or on their own
+	// if ADMIN_ADDR is set. Metrics on the main listener need a token if
+	// there is one to ask for.
+	if adminConfig == nil {
+		if metricsToken == "" {
+			slog.Warn("Metrics are public; set METRICS_TOKEN or ADMIN_ADDR to restrict them")
+		}
+		http.Handle(MetricsPath, handlers.MetricsHandler(metricsToken))
+	} else {
+		adminHandler := handlers.AdminHandler(adminConfig.Token)
+		if adminConfig.Addr == "" {
+			http.Handle(AdminPrefix, adminHandler)
+			http.Handle(MetricsPath, handlers.MetricsHandler(metricsToken, adminConfig.Token))
+		} else {
+			adminMux := http.NewServeMux()
+			adminMux.Handle(AdminPrefix, adminHandler)
+			adminMux.Handle(MetricsPath, handlers.MetricsHandler(metricsToken))
+			go func() {
+				slog.Info("Admin API starting", "addr", adminConfig.Addr)
+				fatal("Admin API stopped", http.ListenAndServe(adminConfig.Addr, adminMux))
+			}()
+		}
+	}
+
+	server := &http.Server{Addr: port}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		shutdownOnSignal(server, handlers, drainDelay)
+	}()
+
+	slog.Info("fwdcast Relay Server starting", "addr", port, "host", host)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		fatal("Server stopped", err)
+	}
+	<-stopped
+
+	// Give queued webhooks a last chance to go out
+	if webhooks != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), WebhookFlushTimeout)
+		if err := webhooks.Close(ctx); err != nil {
+			slog.Warn("Webhooks not flushed", "error", err)
+		}
+		cancel()
+	}
+
+	// Export the last spans and close the log files
+	ctx, cancel := context.WithTimeout(context.Background(), traceCloseTimeout)
+	if err := tracer.Close(ctx); err != nil {
+		slog.Warn("Trace spans not flushed", "error", err)
+	}
+	cancel()
+	if accessLog != nil {
+		if err := accessLog.Close(); err != nil {
+			slog.Warn("Failed to close access log", "error", err)
+		}
+	}
+	if auditLog != nil {
+		if err := auditLog.Close(); err != nil {
+			slog.Warn("Failed to close audit log", "error", err)
+		}
+	}
+	slog.Info("Server stopped")
+}
+
+// shutdownOnSignal waits for SIGTERM or SIGINT, reports not-ready for
+// drainDelay so load balancers stop routing to this relay, then shuts down.
+// A second signal exits immediately.
+func shutdownOnSignal(server *http.Server, handlers *Handlers, drainDelay time.Duration) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	<-signals
+
+	slog.Info("Draining before shutdown", "delay", drainDelay)
+	handlers.StartDraining()
+	go func() {
+		<-signals
+		slog.Warn("Forced shutdown")
+		os.Exit(1)
+	}()
+	time.Sleep(drainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Warn("Shutdown did not complete", "error", err)
+	}
+}
 
-	fmt.Printf("fwdcast Relay Server starting on %s\n", port)
-	fmt.Printf("Public URL host: %s\n", host)
-	log.Fatal(http.ListenAndServe(port, nil))
+// fatal logs a startup error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================================
+// Prometheus Metrics
+// Served in the Prometheus text exposition format at /metrics. The format is
+// simple enough that a client library isn't worth the dependency. With
+// ADMIN_ADDR set, metrics move to the admin listener; on the public listener
+// they need METRICS_TOKEN (or ADMIN_TOKEN) as a bearer token.
+// ============================================================================
+
+// MetricsPath is where the relay serves its metrics
+const MetricsPath = "/metrics"
+
+// MetricsTokenFromEnv reads METRICS_TOKEN, the bearer token scrapers present.
+// Returns "" if unset.
+func MetricsTokenFromEnv() (string, error) {
+	token := os.Getenv("METRICS_TOKEN")
+	if token != "" && len(token) < 16 {
+		return "", errors.New("METRICS_TOKEN must be at least 16 characters")
+	}
+	return token, nil
+}
+
+// MetricsHandler serves the metrics, requiring one of tokens as a bearer
+// token. Empty tokens are ignored; with none left, metrics are open to all.
+func (h *Handlers) MetricsHandler(tokens ...string) http.Handler {
+	var required []string
+	for _, token := range tokens {
+		if token != "" {
+			required = append(required, token)
+		}
+	}
+	if len(required) == 0 {
+		return http.HandlerFunc(h.HandleMetrics)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, _ := bearerToken(r)
+		for _, token := range required {
+			if subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1 {
+				h.HandleMetrics(w, r)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="fwdcast metrics"`)
+		http.Error(w, "Metrics token required", http.StatusUnauthorized)
+	})
+}
+
+// latencyBuckets are histogram upper bounds in seconds, up to RequestTimeout
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metrics holds the relay's counters and histograms. Gauges are computed
+// from the session store when scraped.
+type Metrics struct {
+	Registrations atomic.Uint64 // CLI sessions registered
+	AuthFailures  atomic.Uint64 // Failed viewer password/token attempts
+	BytesToCLI    atomic.Uint64 // Request bytes sent to CLIs
+	BytesToViewer atomic.Uint64 // Response body bytes sent to viewers
+
+	responses    *labeledCounter // Error responses by status code
+	recentErrors *errorLog       // Last failed viewer requests, for the dashboard
+
+	TimeToFirstByte *histogram // Request forwarded → response headers from the CLI
+	RequestDuration *histogram // Full viewer request duration
+}
+
+// NewMetrics creates an empty set of relay metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		responses:       newLabeledCounter(),
+		recentErrors:    &errorLog{},
+		TimeToFirstByte: newHistogram(latencyBuckets),
+		RequestDuration: newHistogram(latencyBuckets),
+	}
+}
+
+// subscribe updates the metrics from events published on the bus
+func (m *Metrics) subscribe(bus *EventBus) {
+	bus.SubscribeAll(func(e Event) {
+		switch e := e.(type) {
+		case SessionCreatedEvent:
+			m.Registrations.Add(1)
+		case AuthFailedEvent:
+			m.AuthFailures.Add(1)
+		case RequestFinishedEvent:
+			m.RequestDuration.Observe(e.Duration)
+			if e.Status >= 400 {
+				m.RecordError(RecentError{
+					Time:      e.Start,
+					SessionID: e.SessionID,
+					RequestID: e.RequestID,
+					Method:    e.Method,
+					PathHash:  pathHash(e.URLPath),
+					Status:    e.Status,
+				})
+			}
+		}
+	})
+}
+
+// CountResponse counts an error response sent to a viewer
+func (m *Metrics) CountResponse(status int) {
+	m.responses.Inc(fmt.Sprint(status))
+}
+
+// labeledCounter is a counter family with a single label
+type labeledCounter struct {
+	values map[string]uint64
+	mu     sync.Mutex
+}
+
+func newLabeledCounter() *labeledCounter {
+	return &labeledCounter{values: make(map[string]uint64)}
+}
+
+// Inc increments the counter for a label value
+func (c *labeledCounter) Inc(label string) {
+	c.mu.Lock()
+	c.values[label]++
+	c.mu.Unlock()
+}
+
+// Get returns the count for a label value
+func (c *labeledCounter) Get(label string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[label]
+}
+
+// snapshot returns the label values in sorted order with their counts
+func (c *labeledCounter) snapshot() ([]string, map[string]uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	labels := make([]string, 0, len(c.values))
+	values := make(map[string]uint64, len(c.values))
+	for label, v := range c.values {
+		labels = append(labels, label)
+		values[label] = v
+	}
+	sort.Strings(labels)
+	return labels, values
+}
+
+// histogram is a cumulative Prometheus histogram of durations in seconds
+type histogram struct {
+	buckets []float64
+	counts  []uint64 // Per bucket, non-cumulative
+	count   uint64
+	sum     float64
+	mu      sync.Mutex
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// Observe records a duration
+func (h *histogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.count++
+	h.sum += seconds
+	for i, bound := range h.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+			return
+		}
+	}
+}
+
+// Count returns the number of observations
+func (h *histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// write renders the histogram in the text exposition format
+func (h *histogram) write(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, bound, cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n%s_count %d\n", name, h.sum, name, h.count)
+}
+
+// writeMetric renders a single unlabeled gauge or counter
+func writeMetric(w io.Writer, name, kind, help string, value uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
+
+// Stats returns the number of active sessions, connected viewer sockets
+// and requests waiting on a CLI
+func (s *SessionStore) Stats() (sessions, viewerSockets, pendingRequests int) {
+	s.mu.RLock()
+	all := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		all = append(all, session)
+	}
+	s.mu.RUnlock()
+
+	for _, session := range all {
+		session.mu.Lock()
+		viewerSockets += len(session.ViewerSockets)
+		pendingRequests += len(session.PendingReqs)
+		session.mu.Unlock()
+	}
+	return len(all), viewerSockets, pendingRequests
+}
+
+// Metrics returns the store's metrics
+func (s *SessionStore) Metrics() *Metrics {
+	return s.metrics
+}
+
+// HandleMetrics serves the relay's metrics in the Prometheus text format
+func (h *Handlers) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	m := h.store.Metrics()
+	sessions, viewerSockets, pending := h.store.Stats()
+
+	var b strings.Builder
+	writeMetric(&b, "fwdcast_active_sessions", "gauge", "Active CLI sessions.", uint64(sessions))
+	writeMetric(&b, "fwdcast_viewer_sockets", "gauge", "Connected viewer live-update WebSockets.", uint64(viewerSockets))
+	writeMetric(&b, "fwdcast_pending_requests", "gauge", "Viewer requests waiting on a CLI.", uint64(pending))
+	writeMetric(&b, "fwdcast_registrations_total", "counter", "CLI sessions registered.", m.Registrations.Load())
+	writeMetric(&b, "fwdcast_auth_failures_total", "counter", "Failed viewer password or token attempts.", m.AuthFailures.Load())
+
+	b.WriteString("# HELP fwdcast_error_responses_total Error responses sent to viewers, by status code.\n")
+	b.WriteString("# TYPE fwdcast_error_responses_total counter\n")
+	labels, values := m.responses.snapshot()
+	for _, code := range labels {
+		fmt.Fprintf(&b, "fwdcast_error_responses_total{code=%q} %d\n", code, values[code])
+	}
+
+	b.WriteString("# HELP fwdcast_relayed_bytes_total Bytes relayed through CLI tunnels, by direction.\n")
+	b.WriteString("# TYPE fwdcast_relayed_bytes_total counter\n")
+	fmt.Fprintf(&b, "fwdcast_relayed_bytes_total{direction=\"to_cli\"} %d\n", m.BytesToCLI.Load())
+	fmt.Fprintf(&b, "fwdcast_relayed_bytes_total{direction=\"to_viewer\"} %d\n", m.BytesToViewer.Load())
+
+	m.TimeToFirstByte.write(&b, "fwdcast_time_to_first_byte_seconds", "Time from forwarding a request to receiving response headers from the CLI.")
+	m.RequestDuration.write(&b, "fwdcast_request_duration_seconds", "Viewer request duration.")
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
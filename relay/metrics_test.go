@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrapeMetrics fetches the metrics page
+func scrapeMetrics(t *testing.T, h *Handlers) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.HandleMetrics(w, httptest.NewRequest(http.MethodGet, MetricsPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	return w.Body.String()
+}
+
+// TestMetrics_Exposition checks gauges and counters reflect relay activity
+func TestMetrics_Exposition(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	h := NewHandlers(store)
+	session, _ := store.CreateSession(nil, time.Now().Add(30*time.Minute))
+	store.CreateSession(nil, time.Now().Add(30*time.Minute))
+	store.AddPendingRequest(session.ID, &PendingRequest{ID: "req1", Done: make(chan struct{})})
+
+	// A missing session is a counted 404
+	w := httptest.NewRecorder()
+	h.HandleViewerRequest(w, httptest.NewRequest(http.MethodGet, "/000000000000/", nil))
+
+	body := scrapeMetrics(t, h)
+	for _, want := range []string{
+		"fwdcast_active_sessions 2\n",
+		"fwdcast_pending_requests 1\n",
+		"fwdcast_viewer_sockets 0\n",
+		"fwdcast_registrations_total 2\n",
+		`fwdcast_error_responses_total{code="404"} 1` + "\n",
+		`fwdcast_relayed_bytes_total{direction="to_viewer"} 0` + "\n",
+		"fwdcast_request_duration_seconds_count 1\n",
+		"# TYPE fwdcast_time_to_first_byte_seconds histogram\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+// TestMetricsHandler_Token checks scrapers must present one of the tokens
+func TestMetricsHandler_Token(t *testing.T) {
+	h := NewHandlers(NewSessionStore("localhost:8080"))
+	scrape := func(handler http.Handler, token string) int {
+		r := httptest.NewRequest(http.MethodGet, MetricsPath, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	protected := h.MetricsHandler("metrics-token-0123456789", "", testAdminToken)
+	for _, tc := range []struct {
+		token string
+		want  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"wrong", http.StatusUnauthorized},
+		{"metrics-token-0123456789", http.StatusOK},
+		{testAdminToken, http.StatusOK},
+	} {
+		if got := scrape(protected, tc.token); got != tc.want {
+			t.Errorf("Token %q: expected %d, got %d", tc.token, tc.want, got)
+		}
+	}
+
+	if got := scrape(h.MetricsHandler(""), ""); got != http.StatusOK {
+		t.Errorf("Expected open metrics without a token, got %d", got)
+	}
+}
+
+// TestHistogram_Buckets checks observations land in cumulative buckets
+func TestHistogram_Buckets(t *testing.T) {
+	hist := newHistogram([]float64{0.1, 1})
+	hist.Observe(50 * time.Millisecond)
+	hist.Observe(500 * time.Millisecond)
+	hist.Observe(5 * time.Second)
+
+	var b strings.Builder
+	hist.write(&b, "test_seconds", "Test.")
+	out := b.String()
+	for _, want := range []string{
+		`test_seconds_bucket{le="0.1"} 1`,
+		`test_seconds_bucket{le="1"} 2`,
+		`test_seconds_bucket{le="+Inf"} 3`,
+		"test_seconds_sum 5.55",
+		"test_seconds_count 3",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected histogram to contain %q, got:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,683 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// OpenID Connect Access Mode
+// Sessions registered with an e-mail/domain allow list require viewers to log
+// in with the relay's configured OIDC issuer (authorization code flow + PKCE).
+// ============================================================================
+
+const (
+	// OIDCCallbackPath is the relay-wide redirect URI registered with the issuer
+	OIDCCallbackPath = "/__oidc__/callback"
+
+	// oidcLoginTimeout is how long a viewer has to complete the issuer login
+	oidcLoginTimeout = 10 * time.Minute
+
+	// maxPendingOIDCLogins bounds memory used by unfinished logins
+	maxPendingOIDCLogins = 10000
+
+	// oidcCookiePrefix names the cookie carrying a viewer's verified identity
+	oidcCookiePrefix = "fwdcast_oidc_"
+
+	// oidcStateCookiePrefix names the cookie binding a login's state to the
+	// browser that started it, so a login completed elsewhere cannot be
+	// injected (login CSRF). Each login gets its own cookie, so logins to
+	// several shares at once don't overwrite each other's state.
+	oidcStateCookiePrefix = "fwdcast_oidc_state_"
+)
+
+// Error types for OIDC
+var (
+	ErrOIDCNotConfigured = errors.New("OIDC is not configured on this relay")
+	ErrOIDCInvalidToken  = errors.New("invalid ID token")
+	ErrOIDCUnknownState  = errors.New("unknown or expired login state")
+)
+
+// OIDCConfig holds the relay's OIDC client registration
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // Must point at OIDCCallbackPath on this relay
+}
+
+// IDTokenClaims are the ID token claims the relay uses
+type IDTokenClaims struct {
+	Issuer        string       `json:"iss"`
+	Subject       string       `json:"sub"`
+	Audience      oidcAudience `json:"aud"`
+	Expiry        int64        `json:"exp"`
+	Nonce         string       `json:"nonce"`
+	Email         string       `json:"email"`
+	EmailVerified bool         `json:"email_verified"`
+}
+
+// oidcAudience accepts the "aud" claim as either a string or an array
+type oidcAudience []string
+
+func (a *oidcAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = oidcAudience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+// oidcLogin is an in-progress login awaiting the issuer callback
+type oidcLogin struct {
+	sessionID string
+	redirect  string // Path within the session to return to
+	nonce     string
+	verifier  string // PKCE code verifier
+	started   time.Time
+}
+
+// OIDCProvider talks to a single OIDC issuer
+type OIDCProvider struct {
+	config        OIDCConfig
+	authEndpoint  string
+	tokenEndpoint string
+	jwksURI       string
+	client        *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey // JWKS keys by key ID
+	pending map[string]*oidcLogin       // In-progress logins by state
+}
+
+// NewOIDCProvider discovers the issuer's endpoints from its
+// /.well-known/openid-configuration document
+func NewOIDCProvider(ctx context.Context, config OIDCConfig) (*OIDCProvider, error) {
+	p := &OIDCProvider{
+		config:  config,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		keys:    make(map[string]crypto.PublicKey),
+		pending: make(map[string]*oidcLogin),
+	}
+
+	var discovery struct {
+		Issuer        string `json:"issuer"`
+		AuthEndpoint  string `json:"authorization_endpoint"`
+		TokenEndpoint string `json:"token_endpoint"`
+		JWKSURI       string `json:"jwks_uri"`
+	}
+	wellKnown := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if discovery.Issuer != config.Issuer {
+		return nil, fmt.Errorf("OIDC discovery issuer %q does not match %q", discovery.Issuer, config.Issuer)
+	}
+	if discovery.AuthEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery document is missing endpoints")
+	}
+
+	p.authEndpoint = discovery.AuthEndpoint
+	p.tokenEndpoint = discovery.TokenEndpoint
+	p.jwksURI = discovery.JWKSURI
+	return p, nil
+}
+
+// OIDCConfigFromEnv reads the OIDC client registration from environment variables.
+// Returns nil if OIDC_ISSUER is unset (OIDC access mode disabled).
+func OIDCConfigFromEnv() (*OIDCConfig, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	config := &OIDCConfig{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+	}
+	if config.ClientID == "" {
+		return nil, fmt.Errorf("OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+	}
+	if config.RedirectURL == "" {
+		publicBase := os.Getenv("PUBLIC_BASE_URL")
+		if publicBase == "" {
+			return nil, fmt.Errorf("OIDC_REDIRECT_URL or PUBLIC_BASE_URL is required when OIDC_ISSUER is set")
+		}
+		config.RedirectURL = strings.TrimSuffix(publicBase, "/") + OIDCCallbackPath
+	}
+	return config, nil
+}
+
+// getJSON fetches and decodes a JSON document
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// randomString returns a URL-safe random string with n bytes of entropy
+func randomString(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// StartLogin records a pending login and returns the issuer URL to redirect
+// the viewer to, along with the login's state
+func (p *OIDCProvider) StartLogin(sessionID, redirect string) (loginURL, state string, err error) {
+	state, err = randomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	p.mu.Lock()
+	if len(p.pending) >= maxPendingOIDCLogins {
+		p.prunePendingLocked()
+	}
+	if len(p.pending) >= maxPendingOIDCLogins {
+		p.mu.Unlock()
+		return "", "", fmt.Errorf("too many pending OIDC logins")
+	}
+	p.pending[state] = &oidcLogin{
+		sessionID: sessionID,
+		redirect:  redirect,
+		nonce:     nonce,
+		verifier:  verifier,
+		started:   time.Now(),
+	}
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {"openid email"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.authEndpoint, "?") {
+		sep = "&"
+	}
+	return p.authEndpoint + sep + params.Encode(), state, nil
+}
+
+// prunePendingLocked drops logins older than oidcLoginTimeout. Caller holds p.mu.
+func (p *OIDCProvider) prunePendingLocked() {
+	for state, login := range p.pending {
+		if time.Since(login.started) > oidcLoginTimeout {
+			delete(p.pending, state)
+		}
+	}
+}
+
+// takeLogin removes and returns the pending login for state
+func (p *OIDCProvider) takeLogin(state string) (*oidcLogin, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	login := p.pending[state]
+	if login == nil {
+		return nil, ErrOIDCUnknownState
+	}
+	delete(p.pending, state)
+	if time.Since(login.started) > oidcLoginTimeout {
+		return nil, ErrOIDCUnknownState
+	}
+	return login, nil
+}
+
+// Exchange trades an authorization code for a verified ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, login *oidcLogin) (*IDTokenClaims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {login.verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed: status %d", resp.StatusCode)
+	}
+
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if tokenResp.IDToken == "" {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+	return p.VerifyIDToken(ctx, tokenResp.IDToken, login.nonce)
+}
+
+// VerifyIDToken checks an ID token's signature (RS256 or ES256 via the
+// issuer's JWKS), issuer, audience, expiry and nonce
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDTokenClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrOIDCInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, ErrOIDCInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrOIDCInvalidToken
+	}
+
+	key, err := p.publicKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !verifyJWTSignature(header.Alg, key, digest[:], sig) {
+		return nil, fmt.Errorf("%w: bad signature", ErrOIDCInvalidToken)
+	}
+
+	var claims IDTokenClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, ErrOIDCInvalidToken
+	}
+	if claims.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrOIDCInvalidToken, claims.Issuer)
+	}
+	if !claims.Audience.contains(p.config.ClientID) {
+		return nil, fmt.Errorf("%w: wrong audience", ErrOIDCInvalidToken)
+	}
+	if time.Now().After(time.Unix(claims.Expiry, 0)) {
+		return nil, fmt.Errorf("%w: expired", ErrOIDCInvalidToken)
+	}
+	if !hmac.Equal([]byte(claims.Nonce), []byte(nonce)) {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCInvalidToken)
+	}
+	return &claims, nil
+}
+
+func (a oidcAudience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeJWTPart decodes a base64url JSON segment of a JWT
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifyJWTSignature checks an RS256 or ES256 signature over digest
+func verifyJWTSignature(alg string, key crypto.PublicKey, digest, sig []byte) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return alg == "RS256" && rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig) == nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" || len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k, digest, r, s)
+	}
+	return false
+}
+
+// publicKey returns the issuer key for kid, refreshing the JWKS on a miss
+// so key rotation is picked up
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key := p.keys[kid]
+	p.mu.Unlock()
+	if key != nil {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.jwksURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	if key = keys[kid]; key == nil {
+		return nil, fmt.Errorf("%w: unknown key ID %q", ErrOIDCInvalidToken, kid)
+	}
+	return key, nil
+}
+
+// ============================================================================
+// Session Integration
+// ============================================================================
+
+// SetOIDCProvider enables the OIDC access mode
+func (h *Handlers) SetOIDCProvider(provider *OIDCProvider) {
+	h.oidc = provider
+}
+
+// SetOIDCAllow restricts a session to viewers whose verified e-mail matches
+// one of the entries: a full address, or a domain ("example.com" or "@example.com")
+func (s *SessionStore) SetOIDCAllow(id string, allow []string) error {
+	session := s.GetSession(id)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+
+	session.mu.Lock()
+	session.OIDCAllow = allow
+	session.mu.Unlock()
+	return nil
+}
+
+// oidcAllowList returns the session's OIDC allow list (empty if OIDC is not required)
+func (s *Session) oidcAllowList() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OIDCAllow
+}
+
+// emailAllowed reports whether email matches an allow list entry
+func emailAllowed(allow []string, email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	_, domain, ok := strings.Cut(email, "@")
+	if !ok || domain == "" {
+		return false
+	}
+
+	for _, entry := range allow {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case strings.HasPrefix(entry, "@"):
+			if domain == entry[1:] {
+				return true
+			}
+		case strings.Contains(entry, "@"):
+			if email == entry {
+				return true
+			}
+		default:
+			if domain == entry {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// identitySignature computes the HMAC binding a verified e-mail to a session
+func (s *SessionStore) identitySignature(sessionID, email string, expiresAt int64) []byte {
+	return s.signature(sessionID, "oidc:"+email, expiresAt)
+}
+
+// signIdentity produces a cookie value asserting a verified e-mail for a session
+func (s *SessionStore) signIdentity(sessionID, email string, expiresAt time.Time) string {
+	exp := expiresAt.Unix()
+	return strconv.FormatInt(exp, 10) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(email)) + "." +
+		base64.RawURLEncoding.EncodeToString(s.identitySignature(sessionID, email, exp))
+}
+
+// verifyIdentity checks an identity cookie value and returns the e-mail it
+// asserts and when the assertion expires
+func (s *SessionStore) verifyIdentity(sessionID, value string) (string, time.Time, bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return "", time.Time{}, false
+	}
+	exp, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().After(time.Unix(exp, 0)) {
+		return "", time.Time{}, false
+	}
+	email, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, s.identitySignature(sessionID, string(email), exp)) {
+		return "", time.Time{}, false
+	}
+	return string(email), time.Unix(exp, 0), true
+}
+
+// oidcIdentityAllows reports whether the request carries a verified identity
+// that the session's allow list accepts. The identity cookie lasts until the
+// session expires; if the CLI has since extended the session, the cookie is
+// re-issued to match.
+func (h *Handlers) oidcIdentityAllows(w http.ResponseWriter, r *http.Request, session *Session, allow []string) bool {
+	cookie, err := r.Cookie(oidcCookiePrefix + session.ID)
+	if err != nil {
+		return false
+	}
+	email, expiresAt, ok := h.store.verifyIdentity(session.ID, cookie.Value)
+	if !ok || !emailAllowed(allow, email) {
+		return false
+	}
+	if sessionExpiry := session.expiry(); sessionExpiry.Unix() > expiresAt.Unix() {
+		h.setIdentityCookie(w, session, email, sessionExpiry)
+	}
+	return true
+}
+
+// setIdentityCookie sets the cookie asserting a viewer's verified e-mail
+func (h *Handlers) setIdentityCookie(w http.ResponseWriter, session *Session, email string, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookiePrefix + session.ID,
+		Value:    h.store.signIdentity(session.ID, email, expiresAt),
+		Path:     "/" + session.ID,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// startOIDCLogin redirects the viewer to the issuer to log in
+func (h *Handlers) startOIDCLogin(w http.ResponseWriter, r *http.Request, session *Session, resourcePath string) {
+	if h.oidc == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	loginURL, state, err := h.oidc.StartLogin(session.ID, resourcePath)
+	if err != nil {
+		session.logger().Warn("Failed to start OIDC login", "error", err)
+		h.send503(w, r, session.ID, "Login is temporarily unavailable. Please try again later.")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookiePrefix + state,
+		Value:    state,
+		Path:     OIDCCallbackPath,
+		MaxAge:   int(oidcLoginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, loginURL, http.StatusFound)
+}
+
+// HandleOIDCCallback completes the authorization code flow, stores the
+// verified identity in a signed cookie and returns the viewer to the share
+func (h *Handlers) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		h.send404(w, r, "", "OIDC login is not enabled on this relay")
+		return
+	}
+
+	query := r.URL.Query()
+	state := query.Get("state")
+	stateCookie, err := r.Cookie(oidcStateCookiePrefix + state)
+	if err != nil || !hmac.Equal([]byte(stateCookie.Value), []byte(state)) {
+		h.send403(w, r, "", ErrCodeLoginFailed, "This login was started in a different browser.",
+			"Open the share URL again in this browser to start a new login.")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookie.Name, Path: OIDCCallbackPath, MaxAge: -1})
+
+	login, err := h.oidc.takeLogin(state)
+	if err != nil {
+		h.send403(w, r, "", ErrCodeLoginFailed, "This login link has expired.",
+			"Open the share URL again to start a new login.")
+		return
+	}
+
+	session := h.store.GetSession(login.sessionID)
+	if session == nil {
+		h.send404(w, r, login.sessionID, "Session not found or expired")
+		return
+	}
+
+	if errParam := query.Get("error"); errParam != "" {
+		h.send403(w, r, session.ID, ErrCodeLoginFailed, "Login was cancelled or refused by the identity provider.",
+			"Open the share URL again to retry.")
+		return
+	}
+
+	claims, err := h.oidc.Exchange(r.Context(), query.Get("code"), login)
+	if err != nil {
+		session.logger().Info("OIDC login failed", "error", err)
+		h.send403(w, r, session.ID, ErrCodeLoginFailed, "Login could not be verified.",
+			"Open the share URL again to retry.")
+		return
+	}
+
+	if !claims.EmailVerified || !emailAllowed(session.oidcAllowList(), claims.Email) {
+		h.send403(w, r, session.ID, ErrCodeLoginFailed, "Your account is not allowed to access this share.",
+			"The sharer has restricted this session to specific people or organisations.")
+		return
+	}
+
+	h.store.Events().Publish(AuthSucceededEvent{
+		Session:   session,
+		Method:    AuthMethodOIDC,
+		Identity:  claims.Email,
+		RemoteIP:  h.clientIP(r).String(),
+		UserAgent: r.UserAgent(),
+	})
+
+	h.setIdentityCookie(w, session, claims.Email, session.expiry())
+	http.Redirect(w, r, "/"+session.ID+login.redirect, http.StatusFound)
+}
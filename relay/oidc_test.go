@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockIssuer is a minimal OIDC issuer for tests. Tests "log in" by calling
+// authorize, which records the ID token claims returned for the code.
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]map[string]interface{} // ID token claims by code
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	m := &mockIssuer{key: key, grants: make(map[string]map[string]interface{})}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		m.mu.Lock()
+		claims := m.grants[r.FormValue("code")]
+		delete(m.grants, r.FormValue("code"))
+		m.mu.Unlock()
+		if claims == nil || r.FormValue("code_verifier") == "" {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(t, claims)})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// sign creates an RS256 JWT
+func (m *mockIssuer) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// authorize simulates the viewer logging in as email, returning the callback query
+func (m *mockIssuer) authorize(t *testing.T, loginURL, email string) url.Values {
+	t.Helper()
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		t.Fatalf("Invalid login URL: %v", err)
+	}
+	params := u.Query()
+
+	m.mu.Lock()
+	m.grants["code-"+email] = map[string]interface{}{
+		"iss":            m.server.URL,
+		"sub":            email,
+		"aud":            params.Get("client_id"),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          params.Get("nonce"),
+		"email":          email,
+		"email_verified": true,
+	}
+	m.mu.Unlock()
+
+	return url.Values{"code": {"code-" + email}, "state": {params.Get("state")}}
+}
+
+// newOIDCHandlers sets up a relay with an OIDC-protected session
+func newOIDCHandlers(t *testing.T, issuer *mockIssuer, allow []string) (*Handlers, *Session) {
+	t.Helper()
+	provider, err := NewOIDCProvider(context.Background(), OIDCConfig{
+		Issuer:      issuer.server.URL,
+		ClientID:    "fwdcast-relay",
+		RedirectURL: "https://relay.example.com" + OIDCCallbackPath,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	store := NewSessionStore("localhost:8080")
+	h := NewHandlers(store)
+	h.SetOIDCProvider(provider)
+	session, _ := store.CreateSession(nil, time.Now().Add(30*time.Minute))
+	store.SetOIDCAllow(session.ID, allow)
+	return h, session
+}
+
+// runOIDCLogin runs the viewer side of the login flow and returns the callback response
+func runOIDCLogin(t *testing.T, h *Handlers, issuer *mockIssuer, session *Session, email string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	h.HandleViewerRequest(w, httptest.NewRequest(http.MethodGet, "/"+session.ID+"/docs/", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected redirect to issuer, got %d", w.Code)
+	}
+	var stateCookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if strings.HasPrefix(c.Name, oidcStateCookiePrefix) {
+			stateCookie = c
+		}
+	}
+	if stateCookie == nil {
+		t.Fatal("Expected login state cookie")
+	}
+
+	query := issuer.authorize(t, w.Header().Get("Location"), email)
+	r := httptest.NewRequest(http.MethodGet, OIDCCallbackPath+"?"+query.Encode(), nil)
+	r.AddCookie(stateCookie)
+	w = httptest.NewRecorder()
+	h.HandleOIDCCallback(w, r)
+	return w
+}
+
+// TestOIDC_LoginFlow checks the authorization code flow against a mock issuer
+func TestOIDC_LoginFlow(t *testing.T) {
+	issuer := newMockIssuer(t)
+	h, session := newOIDCHandlers(t, issuer, []string{"example.com"})
+
+	w := runOIDCLogin(t, h, issuer, session, "alice@example.com")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/"+session.ID+"/docs/" {
+		t.Fatalf("Expected redirect back to share, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	var identity *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcCookiePrefix+session.ID {
+			identity = c
+		}
+	}
+	if identity == nil {
+		t.Fatal("Expected identity cookie")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/"+session.ID+"/docs/", nil)
+	r.AddCookie(identity)
+	if !h.oidcIdentityAllows(httptest.NewRecorder(), r, session, session.oidcAllowList()) {
+		t.Error("Expected identity cookie to grant access")
+	}
+
+	// A forged identity is refused
+	identity.Value = h.store.signIdentity("other-session", "alice@example.com", time.Now().Add(time.Hour))
+	r = httptest.NewRequest(http.MethodGet, "/"+session.ID+"/docs/", nil)
+	r.AddCookie(identity)
+	if h.oidcIdentityAllows(httptest.NewRecorder(), r, session, session.oidcAllowList()) {
+		t.Error("Expected identity signed for another session to be refused")
+	}
+}
+
+// TestOIDC_IdentityFollowsExtension checks the identity cookie is re-issued
+// when the session has been extended past its expiry
+func TestOIDC_IdentityFollowsExtension(t *testing.T) {
+	issuer := newMockIssuer(t)
+	h, session := newOIDCHandlers(t, issuer, []string{"example.com"})
+
+	r := httptest.NewRequest(http.MethodGet, "/"+session.ID+"/", nil)
+	r.AddCookie(&http.Cookie{
+		Name:  oidcCookiePrefix + session.ID,
+		Value: h.store.signIdentity(session.ID, "alice@example.com", session.expiry()),
+	})
+	w := httptest.NewRecorder()
+	if !h.oidcIdentityAllows(w, r, session, session.oidcAllowList()) {
+		t.Fatal("Expected identity cookie to grant access")
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("Expected no new cookie while the session expiry is unchanged")
+	}
+
+	extended := time.Now().Add(90 * time.Minute)
+	if err := h.store.SetExpiry(session.ID, extended); err != nil {
+		t.Fatalf("Failed to extend session: %v", err)
+	}
+	w = httptest.NewRecorder()
+	if !h.oidcIdentityAllows(w, r, session, session.oidcAllowList()) {
+		t.Fatal("Expected identity cookie to grant access after the extension")
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Expires.Unix() != extended.Unix() {
+		t.Fatalf("Expected the identity cookie re-issued to the new expiry, got %+v", cookies)
+	}
+	if _, expiresAt, ok := h.store.verifyIdentity(session.ID, cookies[0].Value); !ok || expiresAt.Unix() != extended.Unix() {
+		t.Errorf("Expected the new cookie to assert the identity until %v, got %v", extended, expiresAt)
+	}
+}
+
+// TestOIDC_DisallowedEmail checks viewers outside the allow list are refused
+func TestOIDC_DisallowedEmail(t *testing.T) {
+	issuer := newMockIssuer(t)
+	h, session := newOIDCHandlers(t, issuer, []string{"alice@example.com"})
+
+	w := runOIDCLogin(t, h, issuer, session, "bob@example.com")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+}
+
+// TestOIDC_CallbackWithoutStateCookie checks login CSRF protection
+func TestOIDC_CallbackWithoutStateCookie(t *testing.T) {
+	issuer := newMockIssuer(t)
+	h, session := newOIDCHandlers(t, issuer, []string{"example.com"})
+
+	loginURL, _, err := h.oidc.StartLogin(session.ID, "/")
+	if err != nil {
+		t.Fatalf("Failed to start login: %v", err)
+	}
+	query := issuer.authorize(t, loginURL, "alice@example.com")
+
+	w := httptest.NewRecorder()
+	h.HandleOIDCCallback(w, httptest.NewRequest(http.MethodGet, OIDCCallbackPath+"?"+query.Encode(), nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+}
+
+// TestOIDC_ConcurrentLogins checks two logins started in one browser can
+// both complete, each matched to its own state cookie
+func TestOIDC_ConcurrentLogins(t *testing.T) {
+	issuer := newMockIssuer(t)
+	h, session := newOIDCHandlers(t, issuer, []string{"example.com"})
+
+	var cookies []*http.Cookie
+	var locations []string
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.HandleViewerRequest(w, httptest.NewRequest(http.MethodGet, "/"+session.ID+"/docs/", nil))
+		for _, c := range w.Result().Cookies() {
+			if strings.HasPrefix(c.Name, oidcStateCookiePrefix) {
+				cookies = append(cookies, c)
+			}
+		}
+		locations = append(locations, w.Header().Get("Location"))
+	}
+	if len(cookies) != 2 || cookies[0].Name == cookies[1].Name {
+		t.Fatalf("Expected a state cookie per login, got %v", cookies)
+	}
+
+	// The browser sends both cookies to the callback
+	for _, location := range locations {
+		query := issuer.authorize(t, location, "alice@example.com")
+		r := httptest.NewRequest(http.MethodGet, OIDCCallbackPath+"?"+query.Encode(), nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		h.HandleOIDCCallback(w, r)
+		if w.Code != http.StatusFound {
+			t.Errorf("Expected each login to complete, got %d", w.Code)
+		}
+	}
+}
+
+// TestEmailAllowed checks allow list matching of addresses and domains
+func TestEmailAllowed(t *testing.T) {
+	allow := []string{"alice@example.com", "@corp.example", "partner.org"}
+	cases := map[string]bool{
+		"alice@example.com":   true,
+		"Alice@Example.com":   true,
+		"bob@example.com":     false,
+		"carol@corp.example":  true,
+		"dave@partner.org":    true,
+		"eve@evilpartner.org": false,
+		"not-an-email":        false,
+	}
+	for email, want := range cases {
+		if got := emailAllowed(allow, email); got != want {
+			t.Errorf("emailAllowed(%q) = %v, want %v", email, got, want)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ============================================================================
+// Password Hashing
+// ============================================================================
+
+// PasswordHasher hashes share passwords into a self-describing format
+// that VerifyPassword can check without knowing which hasher produced it
+type PasswordHasher interface {
+	Hash(password []byte) ([]byte, error)
+}
+
+// BcryptHasher hashes passwords with bcrypt ($2a$...).
+// Note that bcrypt only considers the first 72 bytes of a password.
+type BcryptHasher struct {
+	Cost int
+}
+
+// Hash returns a bcrypt hash of password
+func (b *BcryptHasher) Hash(password []byte) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(password, b.Cost)
+}
+
+// Argon2idHasher hashes passwords with argon2id in PHC string format:
+// $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<threads>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory  uint32 // KiB
+	Time    uint32 // Iterations
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// Default argon2id parameters (RFC 9106 second recommended option, scaled
+// down to fit the 1 GB VMs the relay is designed for)
+const (
+	DefaultArgon2Memory  = 64 * 1024
+	DefaultArgon2Time    = 3
+	DefaultArgon2Threads = 2
+	argon2SaltLen        = 16
+	argon2KeyLen         = 32
+	argon2Prefix         = "$argon2id$"
+)
+
+// Parameter bounds accepted for CLI-computed verifiers. The upper bounds stop a
+// client from registering a verifier that makes every viewer login expensive.
+const (
+	MinVerifierCost         = bcrypt.DefaultCost
+	MaxVerifierCost         = 14
+	MinVerifierArgon2Memory = 19 * 1024
+	MinVerifierArgon2Time   = 2
+	MaxVerifierArgon2Memory = 256 * 1024
+	MaxVerifierArgon2Time   = 10
+	MinVerifierScryptLogN   = 15
+	MaxVerifierScryptLogN   = 17
+	MaxVerifierScryptR      = 16
+	MaxVerifierScryptP      = 4
+)
+
+// NewArgon2idHasher creates an argon2id hasher with the given cost parameters
+func NewArgon2idHasher(memory, time uint32, threads uint8) *Argon2idHasher {
+	return &Argon2idHasher{
+		Memory:  memory,
+		Time:    time,
+		Threads: threads,
+		SaltLen: argon2SaltLen,
+		KeyLen:  argon2KeyLen,
+	}
+}
+
+// Hash returns an argon2id PHC string for password using a random salt
+func (a *Argon2idHasher) Hash(password []byte) ([]byte, error) {
+	salt := make([]byte, a.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey(password, salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+
+	encoded := fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix, argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+	return []byte(encoded), nil
+}
+
+// argon2idHash is a decoded argon2id PHC string
+type argon2idHash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+var errMalformedArgon2 = errors.New("malformed argon2id hash")
+
+// parseArgon2id decodes an argon2id PHC string
+func parseArgon2id(encoded []byte) (*argon2idHash, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(string(encoded), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errMalformedArgon2
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errMalformedArgon2
+	}
+
+	h := &argon2idHash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return nil, errMalformedArgon2
+	}
+	if h.time == 0 || h.threads == 0 {
+		return nil, errMalformedArgon2
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil || len(h.salt) == 0 {
+		return nil, errMalformedArgon2
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, errMalformedArgon2
+	}
+	return h, nil
+}
+
+// scryptPrefix marks scrypt verifiers, which CLIs can compute with Node's
+// built-in crypto: $scrypt$ln=<log2 N>,r=<block size>,p=<parallelism>$<salt>$<key>
+const scryptPrefix = "$scrypt$"
+
+// scryptHash is a decoded scrypt verifier
+type scryptHash struct {
+	logN uint8
+	r, p int
+	salt []byte
+	key  []byte
+}
+
+var errMalformedScrypt = errors.New("malformed scrypt hash")
+
+// parseScrypt decodes a scrypt verifier
+func parseScrypt(encoded []byte) (*scryptHash, error) {
+	// "", "scrypt", "ln=...,r=...,p=...", salt, key
+	parts := strings.Split(string(encoded), "$")
+	if len(parts) != 5 || parts[1] != "scrypt" {
+		return nil, errMalformedScrypt
+	}
+
+	h := &scryptHash{}
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &h.logN, &h.r, &h.p); err != nil {
+		return nil, errMalformedScrypt
+	}
+	if h.logN == 0 || h.logN > 62 || h.r <= 0 || h.p <= 0 {
+		return nil, errMalformedScrypt
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[3]); err != nil || len(h.salt) == 0 {
+		return nil, errMalformedScrypt
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil || len(h.key) == 0 {
+		return nil, errMalformedScrypt
+	}
+	return h, nil
+}
+
+// VerifyPassword checks password against a bcrypt, argon2id or scrypt hash,
+// choosing the algorithm from the hash's own prefix
+func VerifyPassword(hash, password []byte) bool {
+	if bytes.HasPrefix(hash, []byte(argon2Prefix)) {
+		h, err := parseArgon2id(hash)
+		if err != nil {
+			return false
+		}
+		key := argon2.IDKey(password, h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+		return subtle.ConstantTimeCompare(key, h.key) == 1
+	}
+	if bytes.HasPrefix(hash, []byte(scryptPrefix)) {
+		h, err := parseScrypt(hash)
+		if err != nil {
+			return false
+		}
+		key, err := scrypt.Key(password, h.salt, 1<<h.logN, h.r, h.p, len(h.key))
+		return err == nil && subtle.ConstantTimeCompare(key, h.key) == 1
+	}
+	return bcrypt.CompareHashAndPassword(hash, password) == nil
+}
+
+// ValidatePasswordVerifier checks that a CLI-supplied verifier is a bcrypt,
+// argon2id or scrypt hash within the accepted cost bounds, so a weak verifier cannot be
+// registered and an expensive one cannot slow down every login
+func ValidatePasswordVerifier(hash []byte) error {
+	if bytes.HasPrefix(hash, []byte(argon2Prefix)) {
+		h, err := parseArgon2id(hash)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidVerifier, err)
+		}
+		if h.memory < MinVerifierArgon2Memory || h.time < MinVerifierArgon2Time {
+			return fmt.Errorf("%w: argon2id parameters m=%d,t=%d below minimum m=%d,t=%d",
+				ErrInvalidVerifier, h.memory, h.time, MinVerifierArgon2Memory, MinVerifierArgon2Time)
+		}
+		if h.memory > MaxVerifierArgon2Memory || h.time > MaxVerifierArgon2Time {
+			return fmt.Errorf("%w: argon2id parameters m=%d,t=%d above maximum m=%d,t=%d",
+				ErrInvalidVerifier, h.memory, h.time, MaxVerifierArgon2Memory, MaxVerifierArgon2Time)
+		}
+		return nil
+	}
+
+	if bytes.HasPrefix(hash, []byte(scryptPrefix)) {
+		h, err := parseScrypt(hash)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidVerifier, err)
+		}
+		if h.logN < MinVerifierScryptLogN || h.logN > MaxVerifierScryptLogN ||
+			h.r < 8 || h.r > MaxVerifierScryptR || h.p > MaxVerifierScryptP {
+			return fmt.Errorf("%w: scrypt parameters ln=%d,r=%d,p=%d outside ln=%d-%d,r=8-%d,p=1-%d",
+				ErrInvalidVerifier, h.logN, h.r, h.p, MinVerifierScryptLogN, MaxVerifierScryptLogN,
+				MaxVerifierScryptR, MaxVerifierScryptP)
+		}
+		return nil
+	}
+
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidVerifier, err)
+	}
+	if cost < MinVerifierCost {
+		return fmt.Errorf("%w: cost %d below minimum %d", ErrInvalidVerifier, cost, MinVerifierCost)
+	}
+	if cost > MaxVerifierCost {
+		return fmt.Errorf("%w: cost %d above maximum %d", ErrInvalidVerifier, cost, MaxVerifierCost)
+	}
+	return nil
+}
+
+// ============================================================================
+// Client-Side Key Derivation
+// A CLI can keep the share password from the relay entirely: it derives a
+// key from the password with PBKDF2-SHA256 and registers a verifier of that
+// key along with the derivation parameters. Viewers' browsers derive the same
+// key on the login page and send it instead of the password, so the relay
+// only ever sees the derived key.
+// ============================================================================
+
+// Bounds for client-side PBKDF2 iterations: enough to slow down guessing,
+// few enough for a phone browser to log in within a second or two
+const (
+	passwordKDFPrefix        = "pbkdf2-sha256$"
+	MinPasswordKDFIterations = 100_000
+	MaxPasswordKDFIterations = 2_000_000
+	minPasswordKDFSaltLen    = 16
+)
+
+// ErrInvalidPasswordKDF is returned when registered derivation parameters cannot be used
+var ErrInvalidPasswordKDF = errors.New("invalid password key derivation")
+
+// PasswordKDF is the client-side derivation a share's password goes through:
+// "pbkdf2-sha256$<iterations>$<base64 salt>". The derived key is 32 bytes,
+// sent hex-encoded in place of the password.
+type PasswordKDF struct {
+	Iterations int
+	Salt       []byte
+}
+
+// ParsePasswordKDF decodes and bounds-checks registered derivation parameters
+func ParsePasswordKDF(encoded string) (*PasswordKDF, error) {
+	rest, ok := strings.CutPrefix(encoded, passwordKDFPrefix)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown algorithm", ErrInvalidPasswordKDF)
+	}
+	iterations, salt, ok := strings.Cut(rest, "$")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing salt", ErrInvalidPasswordKDF)
+	}
+
+	kdf := &PasswordKDF{}
+	var err error
+	if kdf.Iterations, err = strconv.Atoi(iterations); err != nil {
+		return nil, fmt.Errorf("%w: bad iteration count", ErrInvalidPasswordKDF)
+	}
+	if kdf.Iterations < MinPasswordKDFIterations || kdf.Iterations > MaxPasswordKDFIterations {
+		return nil, fmt.Errorf("%w: %d iterations outside %d-%d", ErrInvalidPasswordKDF,
+			kdf.Iterations, MinPasswordKDFIterations, MaxPasswordKDFIterations)
+	}
+	if kdf.Salt, err = base64.StdEncoding.DecodeString(salt); err != nil || len(kdf.Salt) < minPasswordKDFSaltLen {
+		return nil, fmt.Errorf("%w: salt must be at least %d bytes of base64", ErrInvalidPasswordKDF, minPasswordKDFSaltLen)
+	}
+	return kdf, nil
+}
+
+// SetPasswordKDF makes viewers' browsers derive a key from the password before logging in
+func (s *SessionStore) SetPasswordKDF(id string, kdf *PasswordKDF) error {
+	session := s.GetSession(id)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+	session.mu.Lock()
+	session.PasswordKDF = kdf
+	session.mu.Unlock()
+	return nil
+}
+
+// passwordKDF returns the session's client-side derivation, if any
+func (s *Session) passwordKDF() *PasswordKDF {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.PasswordKDF
+}
+
+// PasswordHasherFromEnv builds the relay's password hasher from environment variables:
+//
+//	PASSWORD_HASH    "bcrypt" (default) or "argon2id"
+//	BCRYPT_COST      bcrypt cost factor (default 10)
+//	ARGON2_MEMORY    argon2id memory in KiB (default 65536)
+//	ARGON2_TIME      argon2id iterations (default 3)
+//	ARGON2_THREADS   argon2id parallelism (default 2)
+func PasswordHasherFromEnv() (PasswordHasher, error) {
+	switch algorithm := os.Getenv("PASSWORD_HASH"); algorithm {
+	case "", "bcrypt":
+		cost, err := envUint("BCRYPT_COST", uint64(bcrypt.DefaultCost), 8)
+		if err != nil {
+			return nil, err
+		}
+		if int(cost) < bcrypt.MinCost || int(cost) > bcrypt.MaxCost {
+			return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return &BcryptHasher{Cost: int(cost)}, nil
+
+	case "argon2id":
+		memory, err := envUint("ARGON2_MEMORY", DefaultArgon2Memory, 32)
+		if err != nil {
+			return nil, err
+		}
+		time, err := envUint("ARGON2_TIME", DefaultArgon2Time, 32)
+		if err != nil {
+			return nil, err
+		}
+		threads, err := envUint("ARGON2_THREADS", DefaultArgon2Threads, 8)
+		if err != nil {
+			return nil, err
+		}
+		if time == 0 || threads == 0 {
+			return nil, fmt.Errorf("ARGON2_TIME and ARGON2_THREADS must be at least 1")
+		}
+		return NewArgon2idHasher(uint32(memory), uint32(time), uint8(threads)), nil
+
+	default:
+		return nil, fmt.Errorf("unknown PASSWORD_HASH %q (want bcrypt or argon2id)", algorithm)
+	}
+}
+
+// envUint reads an unsigned integer environment variable with a default
+func envUint(name string, def uint64, bits int) (uint64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(value, 10, bits)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// TestPasswordHashers_RoundTrip checks that every hasher's output verifies
+// through the self-describing VerifyPassword
+func TestPasswordHashers_RoundTrip(t *testing.T) {
+	hashers := map[string]PasswordHasher{
+		"bcrypt":   &BcryptHasher{Cost: bcrypt.MinCost},
+		"argon2id": NewArgon2idHasher(8*1024, 1, 1),
+	}
+
+	// Longer than bcrypt's 72-byte limit: argon2id must see the whole password
+	long := strings.Repeat("a", 80)
+
+	for name, hasher := range hashers {
+		hash, err := hasher.Hash([]byte("secret"))
+		if err != nil {
+			t.Fatalf("%s: failed to hash: %v", name, err)
+		}
+		if !VerifyPassword(hash, []byte("secret")) {
+			t.Errorf("%s: expected correct password to verify", name)
+		}
+		if VerifyPassword(hash, []byte("wrong")) {
+			t.Errorf("%s: expected wrong password to fail", name)
+		}
+	}
+
+	hash, err := hashers["argon2id"].Hash([]byte(long))
+	if err != nil {
+		t.Fatalf("argon2id: failed to hash: %v", err)
+	}
+	if VerifyPassword(hash, []byte(long[:72]+"bbbbbbbb")) {
+		t.Error("argon2id: expected passwords differing after 72 bytes to fail")
+	}
+}
+
+// TestArgon2idHash_Format checks the PHC string encoding of argon2id hashes
+func TestArgon2idHash_Format(t *testing.T) {
+	hash, err := NewArgon2idHasher(19*1024, 2, 1).Hash([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Failed to hash: %v", err)
+	}
+	if !strings.HasPrefix(string(hash), "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Errorf("Unexpected hash format: %s", hash)
+	}
+	if err := ValidatePasswordVerifier(hash); err != nil {
+		t.Errorf("Expected argon2id hash to be a valid verifier: %v", err)
+	}
+
+	for _, bad := range []string{
+		"$argon2id$v=19$m=19456,t=2,p=1$c2FsdA",
+		"$argon2id$v=16$m=19456,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=0,p=1$c2FsdA$a2V5",
+		"$argon2i$v=19$m=19456,t=2,p=1$c2FsdA$a2V5",
+	} {
+		if VerifyPassword([]byte(bad), []byte("secret")) {
+			t.Errorf("Expected malformed hash %q not to verify", bad)
+		}
+		if ValidatePasswordVerifier([]byte(bad)) == nil {
+			t.Errorf("Expected malformed hash %q to be rejected as a verifier", bad)
+		}
+	}
+}
+
+// scryptVerifier builds a scrypt verifier the way the CLI does
+func scryptVerifier(t testing.TB, password []byte, logN uint8, r, p int) []byte {
+	t.Helper()
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	key, err := scrypt.Key(password, salt, 1<<logN, r, p, 32)
+	if err != nil {
+		t.Fatalf("Failed to derive scrypt key: %v", err)
+	}
+	return []byte(fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", logN, r, p,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)))
+}
+
+// TestScryptVerifier checks scrypt verifiers verify and are bounds-checked
+func TestScryptVerifier(t *testing.T) {
+	hash := scryptVerifier(t, []byte("secret"), MinVerifierScryptLogN, 8, 1)
+	if err := ValidatePasswordVerifier(hash); err != nil {
+		t.Fatalf("Expected scrypt verifier to be accepted: %v", err)
+	}
+	if !VerifyPassword(hash, []byte("secret")) || VerifyPassword(hash, []byte("wrong")) {
+		t.Error("Expected only the right password to verify")
+	}
+
+	weak := scryptVerifier(t, []byte("secret"), 10, 8, 1)
+	if ValidatePasswordVerifier(weak) == nil {
+		t.Error("Expected low-cost scrypt verifier to be rejected")
+	}
+	for _, bad := range []string{
+		"$scrypt$ln=15,r=8,p=1$c2FsdA",
+		"$scrypt$ln=18,r=8,p=1$c2FsdA$a2V5",
+		"$scrypt$ln=15,r=8,p=9$c2FsdA$a2V5",
+		"$scrypt$ln=15,r=0,p=1$c2FsdA$a2V5",
+	} {
+		if ValidatePasswordVerifier([]byte(bad)) == nil {
+			t.Errorf("Expected scrypt verifier %q to be rejected", bad)
+		}
+	}
+}
+
+// TestParsePasswordKDF checks client-side derivation parameters are bounds-checked
+func TestParsePasswordKDF(t *testing.T) {
+	salt := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	kdf, err := ParsePasswordKDF("pbkdf2-sha256$600000$" + salt)
+	if err != nil || kdf.Iterations != 600000 || string(kdf.Salt) != "0123456789abcdef" {
+		t.Fatalf("Unexpected result %+v, %v", kdf, err)
+	}
+
+	for _, bad := range []string{
+		"pbkdf2-sha1$600000$" + salt,
+		"pbkdf2-sha256$600000",
+		"pbkdf2-sha256$1000$" + salt,
+		"pbkdf2-sha256$9000000$" + salt,
+		"pbkdf2-sha256$600000$" + base64.StdEncoding.EncodeToString([]byte("short")),
+		"pbkdf2-sha256$600000$not base64!",
+	} {
+		if _, err := ParsePasswordKDF(bad); !errors.Is(err, ErrInvalidPasswordKDF) {
+			t.Errorf("Expected %q to be rejected, got %v", bad, err)
+		}
+	}
+}
+
+// TestPasswordHasherFromEnv checks relay configuration of the hasher
+func TestPasswordHasherFromEnv(t *testing.T) {
+	t.Setenv("PASSWORD_HASH", "argon2id")
+	t.Setenv("ARGON2_MEMORY", "32768")
+	t.Setenv("ARGON2_TIME", "4")
+	t.Setenv("ARGON2_THREADS", "1")
+
+	hasher, err := PasswordHasherFromEnv()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	a, ok := hasher.(*Argon2idHasher)
+	if !ok || a.Memory != 32768 || a.Time != 4 || a.Threads != 1 {
+		t.Errorf("Unexpected hasher: %#v", hasher)
+	}
+
+	t.Setenv("PASSWORD_HASH", "md5")
+	if _, err := PasswordHasherFromEnv(); err == nil {
+		t.Error("Expected unknown algorithm to be rejected")
+	}
+}
+
+// BenchmarkPasswordHashers measures login latency at various costs so
+// operators can pick parameters for their hardware:
+//
+//	go test -run=^$ -bench=PasswordHashers
+func BenchmarkPasswordHashers(b *testing.B) {
+	hashers := []struct {
+		name   string
+		hasher PasswordHasher
+	}{
+		{"bcrypt/cost=10", &BcryptHasher{Cost: 10}},
+		{"bcrypt/cost=12", &BcryptHasher{Cost: 12}},
+		{"argon2id/m=19MiB,t=2,p=1", NewArgon2idHasher(19*1024, 2, 1)},
+		{"argon2id/m=64MiB,t=3,p=2", NewArgon2idHasher(64*1024, 3, 2)},
+	}
+
+	for _, h := range hashers {
+		hash, err := h.hasher.Hash([]byte("secret"))
+		if err != nil {
+			b.Fatalf("%s: failed to hash: %v", h.name, err)
+		}
+		b.Run(fmt.Sprintf("verify/%s", h.name), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				VerifyPassword(hash, []byte("secret"))
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// ============================================================================
+// Pausing a Share
+// A CLI may pause sharing, e.g. while reorganizing files, and resume later
+// on the same URL. While paused, viewer requests get a "share paused" page
+// instead of reaching the CLI. Viewers' live-update sockets are told when
+// sharing pauses and resumes, and the paused page reloads itself on resume.
+// ============================================================================
+
+// pausedRetryAfter is the Retry-After (in seconds) sent with the paused page
+const pausedRetryAfter = 30
+
+// SetPaused pauses or resumes sharing for a session
+func (s *SessionStore) SetPaused(id string, paused bool) error {
+	session := s.GetSession(id)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+
+	session.mu.Lock()
+	changed := session.Paused != paused
+	session.Paused = paused
+	session.mu.Unlock()
+
+	if changed {
+		session.logger().Info("Session sharing changed", "paused", paused)
+		s.events.Publish(SessionPausedEvent{Session: session, Paused: paused})
+	}
+	return nil
+}
+
+// isPaused reports whether the CLI has paused sharing
+func (s *Session) isPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Paused
+}
+
+// subscribeViewerPause tells viewers' live-update sockets when sharing
+// pauses or resumes
+func (s *SessionStore) subscribeViewerPause() {
+	Subscribe(s.events, func(e SessionPausedEvent) {
+		msg := `{"type":"resumed"}`
+		if e.Paused {
+			msg = `{"type":"paused"}`
+		}
+		e.Session.broadcastToViewers([]byte(msg))
+	})
+}
+
+// sendPausedPage tells a viewer the share is paused. The HTML page waits on
+// the viewer WebSocket and reloads when sharing resumes.
+func (h *Handlers) sendPausedPage(w http.ResponseWriter, r *http.Request, sessionID string) {
+	h.store.Metrics().CountResponse(http.StatusServiceUnavailable)
+
+	if sendNegotiatedError(w, r, &ErrorResponse{
+		Code:       ErrCodeSharePaused,
+		Status:     http.StatusServiceUnavailable,
+		Message:    "Sharing is paused",
+		SessionID:  sessionID,
+		RetryAfter: pausedRetryAfter,
+	}) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Retry-After", strconv.Itoa(pausedRetryAfter))
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	html := `<!DOCTYPE html>
+<html>
+<head>
+  <title>Sharing Paused - fwdcast</title>
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <meta http-equiv="refresh" content="` + strconv.Itoa(pausedRetryAfter) + `">
+  <style>
+    body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; text-align: center; padding: 50px 20px; background: #f5f5f5; margin: 0; }
+    .container { max-width: 500px; margin: 0 auto; background: white; padding: 40px; border-radius: 8px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
+    h1 { color: #3498db; margin-bottom: 20px; }
+    p { color: #333; line-height: 1.6; }
+    .hint { color: #666; font-size: 14px; margin-top: 20px; }
+  </style>
+</head>
+<body>
+  <div class="container">
+    <h1>⏸️ Sharing Paused</h1>
+    <p>The sender has paused this share for a moment.</p>
+    <p class="hint">This page will reload when sharing resumes.</p>
+  </div>
+  <script>
+    const ws = new WebSocket((location.protocol === 'https:' ? 'wss://' : 'ws://') + location.host + location.pathname.replace(/[^/]*$/, '') + '` + viewerSocketName + `');
+    ws.onmessage = (event) => {
+      const data = JSON.parse(event.data);
+      if (data.type === 'resumed' || (data.type === 'init' && !data.paused)) {
+        location.reload();
+      }
+    };
+  </script>
+</body>
+</html>`
+	w.Write([]byte(html))
+}
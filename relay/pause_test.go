@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readViewerUpdate reads live-update messages until one of the given type
+func readViewerUpdate(t *testing.T, viewer *websocket.Conn, msgType string) map[string]interface{} {
+	t.Helper()
+	viewer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := viewer.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read viewer update: %v", err)
+		}
+		var update map[string]interface{}
+		json.Unmarshal(data, &update)
+		if update["type"] == msgType {
+			return update
+		}
+	}
+}
+
+// TestPause_ViewersHeldOff checks a paused share refuses viewers without
+// involving the CLI, and serves them again once resumed
+func TestPause_ViewersHeldOff(t *testing.T) {
+	relay := newTestRelay(t)
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+	viewerURL := "ws" + strings.TrimPrefix(relay.server.URL, "http") + "/viewer-ws/" + cli.sessionID
+
+	viewer, _, err := websocket.DefaultDialer.Dial(viewerURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect viewer: %v", err)
+	}
+	defer viewer.Close()
+	if init := readViewerUpdate(t, viewer, "init"); init["paused"] != false {
+		t.Errorf("Expected init to report not paused, got %v", init)
+	}
+
+	cli.send(NewPauseMessage())
+	readViewerUpdate(t, viewer, "paused")
+
+	req, _ := http.NewRequest(http.MethodGet, relay.server.URL+"/"+cli.sessionID+"/file.txt", nil)
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Viewer request failed: %v", err)
+	}
+	var errResp ErrorResponse
+	json.NewDecoder(resp.Body).Decode(&errResp)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || errResp.Code != ErrCodeSharePaused || resp.Header.Get("Retry-After") != "30" {
+		t.Errorf("Expected 503 share_paused, got %d %+v", resp.StatusCode, errResp)
+	}
+
+	late, _, err := websocket.DefaultDialer.Dial(viewerURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect viewer: %v", err)
+	}
+	defer late.Close()
+	if init := readViewerUpdate(t, late, "init"); init["paused"] != true {
+		t.Errorf("Expected init to report paused, got %v", init)
+	}
+
+	cli.send(NewResumeMessage())
+	readViewerUpdate(t, viewer, "resumed")
+
+	go cli.serve("hello")
+	resp, err = http.Get(relay.server.URL + "/" + cli.sessionID + "/file.txt")
+	if err != nil {
+		t.Fatalf("Viewer request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello" {
+		t.Errorf("Expected the file after resuming, got %d %q", resp.StatusCode, body)
+	}
+}
+
+// TestPause_Page checks browsers get a page that reloads on resume
+func TestPause_Page(t *testing.T) {
+	relay := newTestRelay(t)
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+	relay.store.SetPaused(cli.sessionID, true)
+
+	req, _ := http.NewRequest(http.MethodGet, relay.server.URL+"/"+cli.sessionID+"/", nil)
+	req.Header.Set("Accept", "text/html")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Viewer request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(body), viewerSocketName) {
+		t.Errorf("Expected a paused page watching the viewer socket, got %d %s", resp.StatusCode, body)
+	}
+	if info := relay.store.SessionInfo(relay.store.GetSession(cli.sessionID)); !info.Paused {
+		t.Error("Expected the admin API to report the session paused")
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"strings"
+	"time"
 )
 
 // ============================================================================
@@ -20,6 +22,25 @@ const (
 	TypeData       MessageType = "data"
 	TypeEnd        MessageType = "end"
 	TypeExpired    MessageType = "expired"
+
+	TypeCreateLink  MessageType = "createLink"
+	TypeLinkCreated MessageType = "linkCreated"
+	TypeSignURL     MessageType = "signUrl"
+	TypeSignedURL   MessageType = "signedUrl"
+	TypeRejected    MessageType = "rejected"
+
+	TypeViewerJoined MessageType = "viewerJoined"
+	TypeViewerLeft   MessageType = "viewerLeft"
+	TypeAuthFailed   MessageType = "authFailed"
+	TypeAccessDenied MessageType = "accessDenied"
+	TypeStats        MessageType = "stats"
+
+	TypeSetExpiry     MessageType = "setExpiry"
+	TypeExpiryUpdated MessageType = "expiryUpdated"
+	TypeExpiringSoon  MessageType = "expiringSoon"
+
+	TypePause  MessageType = "pause"
+	TypeResume MessageType = "resume"
 )
 
 // BaseMessage contains the common type field
@@ -35,6 +56,27 @@ type RegisterMessage struct {
 	Path      string      `json:"path"`
 	ExpiresAt int64       `json:"expiresAt"` // Unix timestamp
 	Password  string      `json:"password,omitempty"` // Optional password protection
+	// Optional pre-computed password verifier (e.g. a bcrypt hash) used instead
+	// of Password so the relay doesn't store the plaintext
+	PasswordHash string `json:"passwordHash,omitempty"`
+	// Optional client-side key derivation ("pbkdf2-sha256$<iterations>$<salt>")
+	// that PasswordHash verifies the output of. Viewers derive the key in the
+	// browser, so the password itself never reaches the relay.
+	PasswordKDF string `json:"passwordKdf,omitempty"`
+	// Optional viewer IP restrictions (CIDRs or bare IPs); deny wins over allow
+	AllowCIDRs []string `json:"allowCidrs,omitempty"`
+	DenyCIDRs  []string `json:"denyCidrs,omitempty"`
+	// Optional OIDC access mode: e-mail addresses or domains allowed to view.
+	// Mutually exclusive with password protection.
+	OIDCAllow []string `json:"oidcAllow,omitempty"`
+	// Optional API key, for relays that require one (may also be sent as a header)
+	APIKey string `json:"apiKey,omitempty"`
+	// Request viewerJoined, viewerLeft, authFailed and accessDenied messages
+	ActivityFeed bool `json:"activityFeed,omitempty"`
+	// Request periodic stats messages
+	Stats bool `json:"stats,omitempty"`
+	// Request expiringSoon messages ahead of expiry
+	ExpiryWarnings bool `json:"expiryWarnings,omitempty"`
 }
 
 // RegisteredMessage - Relay → CLI: Registration response
@@ -54,6 +96,8 @@ type RequestMessage struct {
 	ID     string      `json:"id"`     // Unique request ID
 	Method string      `json:"method"` // GET, HEAD
 	Path   string      `json:"path"`   // Requested path within share
+	// Optional W3C trace context, so the CLI's spans join the relay's trace
+	TraceParent string `json:"traceparent,omitempty"`
 }
 
 // ResponseMessage - CLI → Relay: Response headers
@@ -86,6 +130,124 @@ type EndMessage struct {
 // ExpiredMessage - Relay → CLI: Session expired
 // Sent when the session has expired
 type ExpiredMessage struct {
+	Type    MessageType    `json:"type"`
+	Summary *SessionReport `json:"summary,omitempty"` // What the session served
+}
+
+// CreateLinkMessage - CLI → Relay: Request a limited-use access link
+// The link bypasses the session password and allows MaxUses requests
+type CreateLinkMessage struct {
+	Type      MessageType `json:"type"`
+	ID        string      `json:"id"`                  // Correlation ID echoed in linkCreated
+	MaxUses   int         `json:"maxUses"`             // 1 for a one-time link
+	ExpiresAt int64       `json:"expiresAt,omitempty"` // Unix timestamp, 0 = session expiry
+	Path      string      `json:"path,omitempty"`      // File or directory the link is limited to, "" = whole share
+}
+
+// LinkCreatedMessage - Relay → CLI: Limited-use access link issued
+type LinkCreatedMessage struct {
+	Type      MessageType `json:"type"`
+	ID        string      `json:"id"`
+	Token     string      `json:"token"`
+	URL       string      `json:"url"`
+	MaxUses   int         `json:"maxUses"`
+	ExpiresAt int64       `json:"expiresAt"` // Unix timestamp
+	Path      string      `json:"path"`      // Normalized path scope
+	Error     string      `json:"error,omitempty"` // Set if no link was issued; only ID is set alongside it
+}
+
+// SignURLMessage - CLI → Relay: Request a signed URL for a path
+// The signed URL bypasses the session password for that path (or directory) only
+type SignURLMessage struct {
+	Type      MessageType `json:"type"`
+	ID        string      `json:"id"`                  // Correlation ID echoed in signedUrl
+	Path      string      `json:"path"`                // Path prefix within the share, e.g. /docs/
+	ExpiresAt int64       `json:"expiresAt,omitempty"` // Unix timestamp, 0 = session expiry
+}
+
+// SignedURLMessage - Relay → CLI: Signed URL issued
+type SignedURLMessage struct {
+	Type      MessageType `json:"type"`
+	ID        string      `json:"id"`
+	Path      string      `json:"path"` // Normalized path scope
+	URL       string      `json:"url"`
+	ExpiresAt int64       `json:"expiresAt"`       // Unix timestamp
+	Error     string      `json:"error,omitempty"` // Set if no URL was signed; only ID is set alongside it
+}
+
+// RejectedMessage - Relay → CLI: Registration refused
+// Sent instead of registered, just before the relay closes the connection
+type RejectedMessage struct {
+	Type    MessageType `json:"type"`
+	Code    string      `json:"code"` // e.g. unauthorized, too_many_sessions
+	Message string      `json:"message"`
+}
+
+// ViewerActivityMessage - Relay → CLI: Viewer activity for the sharer's audience feed
+// Type is viewerJoined, viewerLeft, authFailed or accessDenied. Sent only to
+// CLIs that registered with activityFeed.
+type ViewerActivityMessage struct {
+	Type        MessageType `json:"type"`
+	Viewer      string      `json:"viewer"` // Anonymized ID, stable for an IP and user agent within the session
+	IP          string      `json:"ip"`
+	UserAgent   string      `json:"userAgent,omitempty"`
+	Time        int64       `json:"time"`                  // Unix timestamp in milliseconds
+	ViewerCount int         `json:"viewerCount,omitempty"` // viewerJoined/viewerLeft: live viewers now connected
+	Method      string      `json:"method,omitempty"`      // authFailed: password, basic, bearer or token
+	Attempts    int         `json:"attempts,omitempty"`    // authFailed: consecutive failures
+	Reason      string      `json:"reason,omitempty"`      // accessDenied: error code, e.g. ip_not_allowed
+}
+
+// StatsMessage - Relay → CLI: Transfer statistics as the relay sees them
+// Sent periodically (when they change) to CLIs that registered with stats
+type StatsMessage struct {
+	Type            MessageType `json:"type"`
+	Time            int64       `json:"time"`            // Unix timestamp in milliseconds
+	BytesDelivered  int64       `json:"bytesDelivered"`  // Response bytes written to viewers
+	ActiveDownloads int         `json:"activeDownloads"` // Responses being streamed
+	Queued          int         `json:"queued"`          // Requests waiting for the CLI to respond
+	Viewers         int         `json:"viewers"`         // Viewer requests in flight
+	LiveViewers     int         `json:"liveViewers"`     // Open live-update sockets
+	Canceled        int64       `json:"canceled"`        // Transfers the viewer abandoned
+	Timeouts        int64       `json:"timeouts"`        // 504 responses
+	Errors          int64       `json:"errors"`          // Other 5xx responses
+}
+
+// SetExpiryMessage - CLI → Relay: Move the session's expiry
+// May extend or shorten the session, subject to the relay's duration limits
+type SetExpiryMessage struct {
+	Type      MessageType `json:"type"`
+	ID        string      `json:"id"`        // Correlation ID echoed in expiryUpdated
+	ExpiresAt int64       `json:"expiresAt"` // Unix timestamp
+}
+
+// ExpiryUpdatedMessage - Relay → CLI: Answer to setExpiry
+// ExpiresAt is the session's expiry after the request; Error is set if the
+// request was refused and the expiry left unchanged
+type ExpiryUpdatedMessage struct {
+	Type      MessageType `json:"type"`
+	ID        string      `json:"id"`
+	ExpiresAt int64       `json:"expiresAt"` // Unix timestamp
+	Error     string      `json:"error,omitempty"`
+}
+
+// ExpiringSoonMessage - Relay → CLI: The session will expire shortly
+// Sent at each of the relay's warning thresholds (e.g. 5 and 1 minutes) to
+// CLIs that registered with expiryWarnings
+type ExpiringSoonMessage struct {
+	Type      MessageType `json:"type"`
+	ExpiresAt int64       `json:"expiresAt"` // Unix timestamp
+	Remaining int64       `json:"remaining"` // Seconds left
+}
+
+// PauseMessage - CLI → Relay: Stop serving viewers but keep the session
+// Viewers get a "share paused" page until the CLI sends resume
+type PauseMessage struct {
+	Type MessageType `json:"type"`
+}
+
+// ResumeMessage - CLI → Relay: Serve viewers again after a pause
+type ResumeMessage struct {
 	Type MessageType `json:"type"`
 }
 
@@ -185,6 +347,109 @@ func DeserializeMessage(data []byte) (interface{}, error) {
 		}
 		return &msg, nil
 
+	case TypeCreateLink:
+		var msg CreateLinkMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, ErrInvalidMessage
+		}
+		if err := ValidateCreateLinkMessage(&msg); err != nil {
+			return nil, err
+		}
+		return &msg, nil
+
+	case TypeLinkCreated:
+		var msg LinkCreatedMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, ErrInvalidMessage
+		}
+		if err := ValidateLinkCreatedMessage(&msg); err != nil {
+			return nil, err
+		}
+		return &msg, nil
+
+	case TypeSignURL:
+		var msg SignURLMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, ErrInvalidMessage
+		}
+		if err := ValidateSignURLMessage(&msg); err != nil {
+			return nil, err
+		}
+		return &msg, nil
+
+	case TypeSignedURL:
+		var msg SignedURLMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, ErrInvalidMessage
+		}
+		if err := ValidateSignedURLMessage(&msg); err != nil {
+			return nil, err
+		}
+		return &msg, nil
+
+	case TypeRejected:
+		var msg RejectedMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, ErrInvalidMessage
+		}
+		if msg.Code == "" {
+			return nil, ErrMissingField
+		}
+		return &msg, nil
+
+	case TypeViewerJoined, TypeViewerLeft, TypeAuthFailed, TypeAccessDenied:
+		var msg ViewerActivityMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, ErrInvalidMessage
+		}
+		if msg.Viewer == "" {
+			return nil, ErrMissingField
+		}
+		return &msg, nil
+
+	case TypeSetExpiry:
+		var msg SetExpiryMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, ErrInvalidMessage
+		}
+		if err := ValidateSetExpiryMessage(&msg); err != nil {
+			return nil, err
+		}
+		return &msg, nil
+
+	case TypeExpiryUpdated:
+		var msg ExpiryUpdatedMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, ErrInvalidMessage
+		}
+		if msg.ID == "" {
+			return nil, ErrMissingField
+		}
+		return &msg, nil
+
+	case TypeExpiringSoon:
+		var msg ExpiringSoonMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, ErrInvalidMessage
+		}
+		if msg.ExpiresAt == 0 {
+			return nil, ErrMissingField
+		}
+		return &msg, nil
+
+	case TypePause:
+		return &PauseMessage{Type: TypePause}, nil
+
+	case TypeResume:
+		return &ResumeMessage{Type: TypeResume}, nil
+
+	case TypeStats:
+		var msg StatsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, ErrInvalidMessage
+		}
+		return &msg, nil
+
 	default:
 		return nil, ErrUnknownMessageType
 	}
@@ -205,6 +470,27 @@ func ValidateRegisterMessage(msg *RegisterMessage) error {
 	if msg.ExpiresAt == 0 {
 		return ErrMissingField
 	}
+	// A password and a verifier are mutually exclusive
+	if msg.Password != "" && msg.PasswordHash != "" {
+		return ErrInvalidMessage
+	}
+	// Derivation parameters describe a verifier, so they need one
+	if msg.PasswordKDF != "" && msg.PasswordHash == "" {
+		return ErrInvalidMessage
+	}
+	if _, err := NewIPFilter(msg.AllowCIDRs, msg.DenyCIDRs); err != nil {
+		return ErrInvalidMessage
+	}
+	if len(msg.OIDCAllow) > 0 {
+		if msg.Password != "" || msg.PasswordHash != "" {
+			return ErrInvalidMessage
+		}
+		for _, entry := range msg.OIDCAllow {
+			if strings.TrimSpace(entry) == "" {
+				return ErrInvalidMessage
+			}
+		}
+	}
 	return nil
 }
 
@@ -277,6 +563,64 @@ func ValidateEndMessage(msg *EndMessage) error {
 	return nil
 }
 
+// ValidateCreateLinkMessage checks that all required fields are present
+func ValidateCreateLinkMessage(msg *CreateLinkMessage) error {
+	if msg.Type != TypeCreateLink {
+		return ErrInvalidMessage
+	}
+	if msg.ID == "" {
+		return ErrMissingField
+	}
+	if msg.MaxUses < 1 {
+		return ErrInvalidMessage
+	}
+	return nil
+}
+
+// ValidateLinkCreatedMessage checks that all required fields are present
+func ValidateLinkCreatedMessage(msg *LinkCreatedMessage) error {
+	if msg.Type != TypeLinkCreated {
+		return ErrInvalidMessage
+	}
+	if msg.ID == "" || (msg.Error == "" && (msg.Token == "" || msg.URL == "")) {
+		return ErrMissingField
+	}
+	return nil
+}
+
+// ValidateSignURLMessage checks that all required fields are present
+func ValidateSignURLMessage(msg *SignURLMessage) error {
+	if msg.Type != TypeSignURL {
+		return ErrInvalidMessage
+	}
+	if msg.ID == "" || msg.Path == "" {
+		return ErrMissingField
+	}
+	return nil
+}
+
+// ValidateSignedURLMessage checks that all required fields are present
+func ValidateSignedURLMessage(msg *SignedURLMessage) error {
+	if msg.Type != TypeSignedURL {
+		return ErrInvalidMessage
+	}
+	if msg.ID == "" || (msg.Error == "" && (msg.Path == "" || msg.URL == "")) {
+		return ErrMissingField
+	}
+	return nil
+}
+
+// ValidateSetExpiryMessage checks that all required fields are present
+func ValidateSetExpiryMessage(msg *SetExpiryMessage) error {
+	if msg.Type != TypeSetExpiry {
+		return ErrInvalidMessage
+	}
+	if msg.ID == "" || msg.ExpiresAt == 0 {
+		return ErrMissingField
+	}
+	return nil
+}
+
 // ============================================================================
 // Message Factories
 // ============================================================================
@@ -342,3 +686,93 @@ func NewExpiredMessage() *ExpiredMessage {
 		Type: TypeExpired,
 	}
 }
+
+// NewLinkCreatedMessage creates a new linkCreated message
+func NewLinkCreatedMessage(id, token, url, path string, maxUses int, expiresAt int64) *LinkCreatedMessage {
+	return &LinkCreatedMessage{
+		Type:      TypeLinkCreated,
+		ID:        id,
+		Token:     token,
+		URL:       url,
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt,
+		Path:      path,
+	}
+}
+
+// NewSignedURLMessage creates a new signedUrl message
+func NewSignedURLMessage(id, path, url string, expiresAt int64) *SignedURLMessage {
+	return &SignedURLMessage{
+		Type:      TypeSignedURL,
+		ID:        id,
+		Path:      path,
+		URL:       url,
+		ExpiresAt: expiresAt,
+	}
+}
+
+// NewRejectedMessage creates a new rejected message
+func NewRejectedMessage(code, message string) *RejectedMessage {
+	return &RejectedMessage{
+		Type:    TypeRejected,
+		Code:    code,
+		Message: message,
+	}
+}
+
+// NewViewerActivityMessage creates a viewerJoined, viewerLeft, authFailed
+// or accessDenied message
+func NewViewerActivityMessage(msgType MessageType, viewer, ip, userAgent string, at time.Time) *ViewerActivityMessage {
+	return &ViewerActivityMessage{
+		Type:      msgType,
+		Viewer:    viewer,
+		IP:        ip,
+		UserAgent: userAgent,
+		Time:      at.UnixMilli(),
+	}
+}
+
+// NewStatsMessage creates a new stats message from a session's statistics
+func NewStatsMessage(stats SessionStats, at time.Time) *StatsMessage {
+	return &StatsMessage{
+		Type:            TypeStats,
+		Time:            at.UnixMilli(),
+		BytesDelivered:  stats.BytesDelivered,
+		ActiveDownloads: stats.ActiveDownloads,
+		Queued:          stats.Queued,
+		Viewers:         stats.Viewers,
+		LiveViewers:     stats.LiveViewers,
+		Canceled:        stats.Canceled,
+		Timeouts:        stats.Timeouts,
+		Errors:          stats.Errors,
+	}
+}
+
+// NewExpiryUpdatedMessage creates a new expiryUpdated message
+func NewExpiryUpdatedMessage(id string, expiresAt int64, errMsg string) *ExpiryUpdatedMessage {
+	return &ExpiryUpdatedMessage{
+		Type:      TypeExpiryUpdated,
+		ID:        id,
+		ExpiresAt: expiresAt,
+		Error:     errMsg,
+	}
+}
+
+// NewExpiringSoonMessage creates a new expiringSoon message
+func NewExpiringSoonMessage(expiresAt time.Time, remaining time.Duration) *ExpiringSoonMessage {
+	return &ExpiringSoonMessage{
+		Type:      TypeExpiringSoon,
+		ExpiresAt: expiresAt.Unix(),
+		Remaining: int64(remaining.Round(time.Second).Seconds()),
+	}
+}
+
+// NewPauseMessage creates a new pause message
+func NewPauseMessage() *PauseMessage {
+	return &PauseMessage{Type: TypePause}
+}
+
+// NewResumeMessage creates a new resume message
+func NewResumeMessage() *ResumeMessage {
+	return &ResumeMessage{Type: TypeResume}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ============================================================================
+// Session Reports
+// A summary of what a session served, built when it ends: how long it ran,
+// how many distinct viewers it had, hits and bytes per path and failed
+// transfers. Sent to the CLI in the expired message and optionally kept on
+// disk as one JSON file per session.
+// ============================================================================
+
+// Why a session ended
+const (
+	SessionEndExpired      = "expired"      // Expiry time reached, or ended by an admin
+	SessionEndDisconnected = "disconnected" // The CLI went away
+)
+
+// maxReportPaths bounds the per-path counts kept for a session; requests for
+// further paths are counted under OtherPaths
+const maxReportPaths = 500
+
+// PathReport counts the requests served for one path
+type PathReport struct {
+	Path  string `json:"path"`
+	Hits  int64  `json:"hits"`
+	Bytes int64  `json:"bytes"`
+}
+
+// SessionReport summarizes a session when it ends
+type SessionReport struct {
+	SessionID      string       `json:"sessionId"`
+	Reason         string       `json:"reason"`    // expired or disconnected
+	CreatedAt      int64        `json:"createdAt"` // Unix timestamp in milliseconds
+	EndedAt        int64        `json:"endedAt"`   // Unix timestamp in milliseconds
+	DurationMS     int64        `json:"durationMs"`
+	UniqueViewers  int          `json:"uniqueViewers"` // Distinct IP and user agent pairs served
+	Requests       int64        `json:"requests"`
+	BytesDelivered int64        `json:"bytesDelivered"`
+	Paths          []PathReport `json:"paths"`                // Sorted by path
+	OtherPaths     *PathReport  `json:"otherPaths,omitempty"` // Paths beyond the first maxReportPaths
+	Canceled       int64        `json:"canceled"`
+	Timeouts       int64        `json:"timeouts"`
+	Errors         int64        `json:"errors"`
+}
+
+// sessionUsage accumulates a session's served requests for its report.
+// Guarded by the session's mutex.
+type sessionUsage struct {
+	viewers  map[string]struct{} // Anonymized viewer IDs
+	paths    map[string]*PathReport
+	other    PathReport
+	requests int64
+	report   *SessionReport // Set once the session has ended
+}
+
+// subscribeSessionUsage counts forwarded requests towards session reports
+func (s *SessionStore) subscribeSessionUsage() {
+	Subscribe(s.events, func(e RequestFinishedEvent) {
+		if !e.Forwarded {
+			return
+		}
+		session := s.GetSession(e.SessionID)
+		if session == nil {
+			return
+		}
+		viewer := s.anonymousViewerID(e.SessionID, e.RemoteIP, e.UserAgent)
+		session.recordUsage(viewer, e.Path, e.Bytes)
+	})
+}
+
+// recordUsage counts a served request
+func (s *Session) recordUsage(viewer, path string, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := &s.usage
+	if u.viewers == nil {
+		u.viewers = make(map[string]struct{})
+		u.paths = make(map[string]*PathReport)
+	}
+	u.viewers[viewer] = struct{}{}
+	u.requests++
+
+	counts := u.paths[path]
+	if counts == nil {
+		if len(u.paths) >= maxReportPaths {
+			counts = &u.other
+		} else {
+			counts = &PathReport{Path: path}
+			u.paths[path] = counts
+		}
+	}
+	counts.Hits++
+	counts.Bytes += bytes
+}
+
+// finish builds the session's report. The first call decides the reason;
+// later calls return the same report.
+func (s *Session) finish(reason string) *SessionReport {
+	stats := s.Stats()
+	endedAt := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.usage.report != nil {
+		return s.usage.report
+	}
+
+	report := &SessionReport{
+		SessionID:      s.ID,
+		Reason:         reason,
+		CreatedAt:      s.CreatedAt.UnixMilli(),
+		EndedAt:        endedAt.UnixMilli(),
+		DurationMS:     endedAt.Sub(s.CreatedAt).Milliseconds(),
+		UniqueViewers:  len(s.usage.viewers),
+		Requests:       s.usage.requests,
+		BytesDelivered: stats.BytesDelivered,
+		Paths:          make([]PathReport, 0, len(s.usage.paths)),
+		Canceled:       stats.Canceled,
+		Timeouts:       stats.Timeouts,
+		Errors:         stats.Errors,
+	}
+	for _, counts := range s.usage.paths {
+		report.Paths = append(report.Paths, *counts)
+	}
+	sort.Slice(report.Paths, func(i, j int) bool { return report.Paths[i].Path < report.Paths[j].Path })
+	if s.usage.other.Hits > 0 {
+		other := s.usage.other
+		report.OtherPaths = &other
+	}
+
+	s.usage.report = report
+	return report
+}
+
+// ReportWriter saves session reports as JSON files in a directory
+type ReportWriter struct {
+	dir string
+}
+
+// NewReportWriter creates a report writer, creating dir if needed
+func NewReportWriter(dir string) (*ReportWriter, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create reports directory: %w", err)
+	}
+	return &ReportWriter{dir: dir}, nil
+}
+
+// ReportWriterFromEnv creates the report writer configured by REPORTS_DIR.
+// Returns nil if REPORTS_DIR is unset.
+func ReportWriterFromEnv() (*ReportWriter, error) {
+	dir := os.Getenv("REPORTS_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+	return NewReportWriter(dir)
+}
+
+// SetReportWriter saves a report for each session that ends
+func (h *Handlers) SetReportWriter(writer *ReportWriter) {
+	Subscribe(h.store.Events(), func(e SessionEndedEvent) {
+		if err := writer.Write(e.Report); err != nil {
+			slog.Warn("Failed to write session report", "session_id", e.Report.SessionID, "error", err)
+		}
+	})
+}
+
+// Write saves a report as {ended-at}-{session-id}.json
+func (w *ReportWriter) Write(report *SessionReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	ended := time.UnixMilli(report.EndedAt).UTC().Format("20060102T150405Z")
+	name := filepath.Join(w.dir, ended+"-"+report.SessionID+".json")
+	return os.WriteFile(name, append(data, '\n'), 0o600)
+}
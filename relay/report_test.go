@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestSessionReport_Expired checks the expired message summarizes what the
+// session served
+func TestSessionReport_Expired(t *testing.T) {
+	relay := newTestRelay(t)
+	finished := make(chan struct{}, 10)
+	Subscribe(relay.store.Events(), func(RequestFinishedEvent) { finished <- struct{}{} })
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+
+	for _, r := range []struct{ path, userAgent, body string }{
+		{"/a.txt", "viewer-1", "hello"},
+		{"/a.txt", "viewer-2", "hello"},
+		{"/b.txt", "viewer-1", "hi"},
+	} {
+		served := make(chan struct{})
+		go func() {
+			cli.serve(r.body)
+			close(served)
+		}()
+		req, _ := http.NewRequest(http.MethodGet, relay.server.URL+"/"+cli.sessionID+r.path, nil)
+		req.Header.Set("User-Agent", r.userAgent)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Viewer request failed: %v", err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+		<-served
+		<-finished
+	}
+
+	relay.store.ExpireSession(cli.sessionID)
+	expired, ok := cli.read().(*ExpiredMessage)
+	if !ok || expired.Summary == nil {
+		t.Fatalf("Expected expired message with a summary, got %+v", expired)
+	}
+
+	report := expired.Summary
+	if report.SessionID != cli.sessionID || report.Reason != SessionEndExpired {
+		t.Errorf("Unexpected report header %+v", report)
+	}
+	if report.UniqueViewers != 2 || report.Requests != 3 || report.BytesDelivered != 12 {
+		t.Errorf("Expected 2 viewers, 3 requests and 12 bytes, got %+v", report)
+	}
+	want := []PathReport{{"/a.txt", 2, 10}, {"/b.txt", 1, 2}}
+	if len(report.Paths) != 2 || report.Paths[0] != want[0] || report.Paths[1] != want[1] {
+		t.Errorf("Expected paths %v, got %v", want, report.Paths)
+	}
+}
+
+// TestSessionReport_Disconnect checks a report is saved when the CLI goes away
+func TestSessionReport_Disconnect(t *testing.T) {
+	relay := newTestRelay(t)
+	dir := filepath.Join(t.TempDir(), "reports")
+	writer, err := NewReportWriter(dir)
+	if err != nil {
+		t.Fatalf("Failed to create report writer: %v", err)
+	}
+	relay.handlers.SetReportWriter(writer)
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+	cli.conn.Close()
+
+	var files []string
+	deadline := time.Now().Add(5 * time.Second)
+	for len(files) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		files, _ = filepath.Glob(filepath.Join(dir, "*-"+cli.sessionID+".json"))
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected one report file, got %v", files)
+	}
+
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var report SessionReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Invalid report %s: %v", data, err)
+	}
+	if report.Reason != SessionEndDisconnected || report.Requests != 0 || report.Paths == nil {
+		t.Errorf("Unexpected report %s", data)
+	}
+}
+
+// TestSessionReport_PathLimit checks paths beyond the limit are totalled together
+func TestSessionReport_PathLimit(t *testing.T) {
+	session := &Session{ID: "a1b2c3d4e5f6", CreatedAt: time.Now()}
+	for i := 0; i < maxReportPaths+2; i++ {
+		session.recordUsage("viewer", "/file"+strconv.Itoa(i), 10)
+	}
+	session.recordUsage("viewer", "/file0", 10)
+
+	report := session.finish(SessionEndExpired)
+	if len(report.Paths) != maxReportPaths || report.OtherPaths == nil || report.OtherPaths.Hits != 2 {
+		t.Errorf("Expected %d paths and 2 other hits, got %d and %+v", maxReportPaths, len(report.Paths), report.OtherPaths)
+	}
+	if report.UniqueViewers != 1 || report.Requests != maxReportPaths+3 {
+		t.Errorf("Expected 1 viewer and %d requests, got %+v", maxReportPaths+3, report)
+	}
+	if again := session.finish(SessionEndDisconnected); again != report {
+		t.Error("Expected finish to return the first report")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -22,6 +23,74 @@ type PendingRequest struct {
 	ID             string
 	ResponseWriter http.ResponseWriter
 	Done           chan struct{}
+	StartedAt      time.Time // When the request was forwarded to the CLI
+	trace          *requestTrace // Round-trip spans (nil if tracing is disabled)
+	streaming      atomic.Bool   // Response headers have been relayed
+	canceled       atomic.Bool   // The viewer went away mid-transfer
+	chunks         chunkQueue    // Body data waiting to be written to the viewer
+}
+
+// Writes that may run on an event publisher's goroutine are bounded, so a
+// stalled viewer or CLI can't hold up the publisher
+const (
+	viewerOutboxSize   = 16               // Messages queued for a viewer socket before they're dropped
+	viewerWriteTimeout = 10 * time.Second // Before a stalled viewer socket is closed
+	cliNoticeTimeout   = 10 * time.Second // For notices written to a CLI outside its request flow
+)
+
+// ViewerSocket describes a viewer's live-update WebSocket
+type ViewerSocket struct {
+	ID          string
+	RemoteIP    string
+	UserAgent   string
+	ConnectedAt time.Time
+	outbox      chan []byte   // Messages waiting for writeLoop
+	done        chan struct{} // Closed when the socket has gone
+}
+
+// newViewerSocket creates a viewer socket's state and starts its writer
+func newViewerSocket(conn *websocket.Conn, remoteIP, userAgent string) *ViewerSocket {
+	v := &ViewerSocket{
+		ID:          generateViewerID(),
+		RemoteIP:    remoteIP,
+		UserAgent:   userAgent,
+		ConnectedAt: time.Now(),
+		outbox:      make(chan []byte, viewerOutboxSize),
+		done:        make(chan struct{}),
+	}
+	go v.writeLoop(conn)
+	return v
+}
+
+// send queues a text message for the viewer's socket without blocking. A
+// viewer too slow to keep up misses messages rather than delaying the sender.
+func (v *ViewerSocket) send(msg []byte) {
+	select {
+	case v.outbox <- msg:
+	default:
+	}
+}
+
+// writeLoop writes queued messages until the socket goes, closing it if a
+// write fails or stalls so the reader notices
+func (v *ViewerSocket) writeLoop(conn *websocket.Conn) {
+	for {
+		select {
+		case msg := <-v.outbox:
+			conn.SetWriteDeadline(time.Now().Add(viewerWriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				conn.Close()
+				return
+			}
+		case <-v.done:
+			return
+		}
+	}
+}
+
+// close stops the socket's writer
+func (v *ViewerSocket) close() {
+	close(v.done)
 }
 
 // Session represents an active CLI connection and its associated state
@@ -29,14 +98,31 @@ type PendingRequest struct {
 type Session struct {
 	ID              string
 	WebSocket       *websocket.Conn
+	CreatedAt       time.Time
 	ExpiresAt       time.Time
 	ViewerCount     int
 	MaxViewers      int
-	PasswordHash    []byte // bcrypt hash of password (empty if no password)
+	PasswordHash    []byte // bcrypt, argon2id or scrypt hash of password (empty if no password)
+	PasswordKDF     *PasswordKDF // Key derivation viewers apply to the password before login (nil if none)
 	FailedAttempts  int    // Rate limiting: failed password attempts
 	LastAttemptTime time.Time // Rate limiting: time of last attempt
+	AuthTokens      map[string]time.Time // Relay-issued bearer and login cookie tokens and their expiry
+	AccessLinks     map[string]*AccessLink // Limited-use links by token
+	IPFilter        *IPFilter // Viewer IP restrictions (nil if unrestricted)
+	OIDCAllow       []string  // E-mails/domains allowed via OIDC login (empty if not required)
+	APIKey          *APIKey   // Key the CLI registered with (nil if anonymous)
+	ActivityFeed    bool      // Send viewer activity messages to the CLI
+	ExpiryWarnings  bool      // Send expiringSoon messages to the CLI
+	Paused          bool      // The CLI has paused sharing
+	Bandwidth       *bandwidthLimiter // Per-session bandwidth limit (nil if unlimited)
 	PendingReqs     map[string]*PendingRequest
-	ViewerSockets   map[*websocket.Conn]bool // Connected viewer WebSockets for live updates
+	ViewerSockets   map[*websocket.Conn]*ViewerSocket // Connected viewer WebSockets for live updates
+	BytesSent       atomic.Int64 // Response bytes relayed to viewers
+	transfers       transferCounters // Failed transfers, for stats messages
+	usage           sessionUsage     // Served requests, for the end-of-life report
+	viewed          bool      // A viewer request has been served
+	lastLimitEvent  time.Time // When a viewer limit webhook was last sent
+	expiryWarned    time.Duration // Smallest expiry warning threshold passed (0 if none)
 	mu              sync.Mutex
 }
 
@@ -47,6 +133,13 @@ type SessionStore struct {
 	mu       sync.RWMutex
 	host     string // Relay server host for URL generation
 	stopCh   chan struct{} // Channel to stop the expiry goroutine
+	hasher   PasswordHasher // Hashes plaintext share passwords
+	signingKey []byte // HMAC key for signed URLs
+	metrics    *Metrics // Relay metrics served at /metrics
+	lastExpirySweep atomic.Int64 // Unix nanoseconds of the last expiry check (0 if not started)
+	events          *EventBus // Session and request events
+	expiryWarnings  []time.Duration // Warning thresholds before expiry, longest first
+	maxDuration     time.Duration   // Longest a session may last, from registration (0 = unlimited)
 }
 
 // ============================================================================
@@ -55,11 +148,30 @@ type SessionStore struct {
 
 // NewSessionStore creates a new in-memory session store
 func NewSessionStore(host string) *SessionStore {
-	return &SessionStore{
+	s := &SessionStore{
 		sessions: make(map[string]*Session),
 		host:     host,
 		stopCh:   make(chan struct{}),
+		hasher:   &BcryptHasher{Cost: bcrypt.DefaultCost},
+		signingKey: generateSigningKey(),
+		metrics:    NewMetrics(),
+		events:     NewEventBus(),
+		expiryWarnings: DefaultExpiryWarnings,
 	}
+	s.metrics.subscribe(s.events)
+	s.subscribeViewerCounts()
+	s.subscribeActivityFeed()
+	s.subscribeTransferStats()
+	s.subscribeSessionUsage()
+	s.subscribeViewerExpiry()
+	s.subscribeExpiryWarnings()
+	s.subscribeViewerPause()
+	return s
+}
+
+// SetPasswordHasher replaces the hasher used for plaintext share passwords
+func (s *SessionStore) SetPasswordHasher(hasher PasswordHasher) {
+	s.hasher = hasher
 }
 
 // DefaultSessionDuration is the default session expiry duration (30 minutes)
@@ -72,6 +184,7 @@ const ExpiryCheckInterval = 10 * time.Second
 // and removes expired sessions. It sends an expired message to the CLI before closing.
 // Requirements: 4.1, 4.2
 func (s *SessionStore) StartExpiryChecker() {
+	s.lastExpirySweep.Store(time.Now().UnixNano())
 	go func() {
 		ticker := time.NewTicker(ExpiryCheckInterval)
 		defer ticker.Stop()
@@ -80,6 +193,8 @@ func (s *SessionStore) StartExpiryChecker() {
 			select {
 			case <-ticker.C:
 				s.expireSessions()
+				s.warnExpiringSessions(time.Now())
+				s.lastExpirySweep.Store(time.Now().UnixNano())
 			case <-s.stopCh:
 				return
 			}
@@ -102,7 +217,7 @@ func (s *SessionStore) expireSessions() {
 	// First pass: identify expired sessions
 	s.mu.RLock()
 	for id, session := range s.sessions {
-		if now.After(session.ExpiresAt) {
+		if now.After(session.expiry()) {
 			expiredIDs = append(expiredIDs, id)
 		}
 	}
@@ -126,25 +241,36 @@ func (s *SessionStore) ExpireSession(id string) {
 		return
 	}
 
-	// Send expired message to CLI before closing
+	// Send expired message to CLI before closing, with the session's summary
+	report := session.finish(SessionEndExpired)
 	if session.WebSocket != nil {
 		expiredMsg := NewExpiredMessage()
+		expiredMsg.Summary = report
 		msgBytes, err := SerializeMessage(expiredMsg)
 		if err == nil {
 			session.mu.Lock()
-			session.WebSocket.WriteMessage(1, msgBytes) // 1 = TextMessage
+			session.sendNotice(msgBytes)
 			session.WebSocket.Close()
 			session.mu.Unlock()
 		}
 	}
 
+	s.events.Publish(SessionExpiredEvent{Session: session})
+
 	// Remove the session
 	s.RemoveSession(id)
 }
 
 // IsExpired checks if a session has expired
 func (s *Session) IsExpired() bool {
-	return time.Now().After(s.ExpiresAt)
+	return time.Now().After(s.expiry())
+}
+
+// expiry returns the session's expiry time (which may be changed while it runs)
+func (s *Session) expiry() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ExpiresAt
 }
 
 
@@ -167,34 +293,56 @@ func (s *SessionStore) CreateSession(ws *websocket.Conn, expiresAt time.Time) (*
 
 // CreateSessionWithPassword creates a new session with optional password protection
 func (s *SessionStore) CreateSessionWithPassword(ws *websocket.Conn, expiresAt time.Time, password string) (*Session, error) {
-	id, err := generateSessionID()
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate session ID: %w", err)
-	}
-
 	var passwordHash []byte
 	if password != "" {
-		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		hash, err := s.hasher.Hash([]byte(password))
 		if err != nil {
 			return nil, fmt.Errorf("failed to hash password: %w", err)
 		}
 		passwordHash = hash
 	}
 
+	return s.createSession(ws, expiresAt, passwordHash)
+}
+
+// CreateSessionWithVerifier creates a new session protected by a password
+// verifier computed by the CLI, so the relay never stores the plaintext password.
+// An empty verifier creates an unprotected session.
+func (s *SessionStore) CreateSessionWithVerifier(ws *websocket.Conn, expiresAt time.Time, passwordHash []byte) (*Session, error) {
+	if len(passwordHash) > 0 {
+		if err := ValidatePasswordVerifier(passwordHash); err != nil {
+			return nil, err
+		}
+	}
+	return s.createSession(ws, expiresAt, passwordHash)
+}
+
+// createSession creates a new session with a trusted password hash. The
+// relay's own hasher may be configured beyond the bounds set for CLI verifiers.
+func (s *SessionStore) createSession(ws *websocket.Conn, expiresAt time.Time, passwordHash []byte) (*Session, error) {
+	id, err := generateSessionID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
 	session := &Session{
 		ID:            id,
 		WebSocket:     ws,
+		CreatedAt:     time.Now(),
 		ExpiresAt:     expiresAt,
 		ViewerCount:   0,
 		MaxViewers:    3,
 		PasswordHash:  passwordHash,
+		AuthTokens:    make(map[string]time.Time),
+		AccessLinks:   make(map[string]*AccessLink),
 		PendingReqs:   make(map[string]*PendingRequest),
-		ViewerSockets: make(map[*websocket.Conn]bool),
+		ViewerSockets: make(map[*websocket.Conn]*ViewerSocket),
 	}
 
 	s.mu.Lock()
-	// Check for collision (extremely unlikely but handle it)
-	for s.sessions[id] != nil {
+	// Check for collision (extremely unlikely but handle it), and never
+	// issue a name from the relay's operational namespace
+	for s.sessions[id] != nil || IsReservedName(id) {
 		id, err = generateSessionID()
 		if err != nil {
 			s.mu.Unlock()
@@ -205,6 +353,7 @@ func (s *SessionStore) CreateSessionWithPassword(ws *websocket.Conn, expiresAt t
 	s.sessions[id] = session
 	s.mu.Unlock()
 
+	s.events.Publish(SessionCreatedEvent{Session: session})
 	return session, nil
 }
 
@@ -220,7 +369,7 @@ func (s *SessionStore) GetSession(id string) *Session {
 	}
 
 	// Check if session has expired
-	if time.Now().After(session.ExpiresAt) {
+	if session.IsExpired() {
 		s.RemoveSession(id)
 		return nil
 	}
@@ -245,6 +394,14 @@ func (s *SessionStore) RemoveSession(id string) {
 		delete(s.sessions, id)
 	}
 	s.mu.Unlock()
+
+	if session != nil {
+		reason := SessionEndDisconnected
+		if session.IsExpired() {
+			reason = SessionEndExpired
+		}
+		s.events.Publish(SessionEndedEvent{Session: session, Report: session.finish(reason)})
+	}
 }
 
 // GenerateURL creates the public URL for a session
@@ -269,13 +426,13 @@ func (s *SessionStore) IncrementViewers(id string) error {
 	}
 
 	session.mu.Lock()
-	defer session.mu.Unlock()
-
 	if session.ViewerCount >= session.MaxViewers {
+		session.mu.Unlock()
+		s.events.Publish(ViewerLimitEvent{Session: session})
 		return ErrMaxViewersReached
 	}
-
 	session.ViewerCount++
+	session.mu.Unlock()
 	return nil
 }
 
@@ -369,6 +526,13 @@ func (s *SessionStore) SessionExists(id string) bool {
 	return exists
 }
 
+// subscribeViewerCounts keeps viewers' live-update sockets told how many
+// viewers are connected
+func (s *SessionStore) subscribeViewerCounts() {
+	Subscribe(s.events, func(e ViewerJoinedEvent) { s.BroadcastViewerCount(e.Session.ID) })
+	Subscribe(s.events, func(e ViewerLeftEvent) { s.BroadcastViewerCount(e.Session.ID) })
+}
+
 // BroadcastViewerCount sends updated viewer count to all connected viewer WebSockets
 func (s *SessionStore) BroadcastViewerCount(sessionID string) {
 	session := s.GetSession(sessionID)
@@ -376,16 +540,28 @@ func (s *SessionStore) BroadcastViewerCount(sessionID string) {
 		return
 	}
 
-	session.mu.Lock()
-	viewerCount := len(session.ViewerSockets)
-	sockets := make([]*websocket.Conn, 0, len(session.ViewerSockets))
-	for conn := range session.ViewerSockets {
-		sockets = append(sockets, conn)
+	msg := fmt.Sprintf(`{"type":"viewerCount","count":%d}`, session.liveViewerCount())
+	session.broadcastToViewers([]byte(msg))
+}
+
+// broadcastToViewers sends a message to all connected viewer WebSockets
+func (s *Session) broadcastToViewers(msg []byte) {
+	s.mu.Lock()
+	sockets := make(map[*websocket.Conn]*ViewerSocket, len(s.ViewerSockets))
+	for conn, viewer := range s.ViewerSockets {
+		sockets[conn] = viewer
 	}
-	session.mu.Unlock()
+	s.mu.Unlock()
 
-	msg := fmt.Sprintf(`{"type":"viewerCount","count":%d}`, viewerCount)
-	for _, conn := range sockets {
-		conn.WriteMessage(1, []byte(msg)) // 1 = TextMessage
+	for _, viewer := range sockets {
+		viewer.send(msg)
 	}
 }
+
+// sendNotice writes a message to the CLI outside its request flow, giving up
+// after cliNoticeTimeout. The caller must hold s.mu.
+func (s *Session) sendNotice(msg []byte) error {
+	s.WebSocket.SetWriteDeadline(time.Now().Add(cliNoticeTimeout))
+	defer s.WebSocket.SetWriteDeadline(time.Time{})
+	return s.WebSocket.WriteMessage(websocket.TextMessage, msg)
+}
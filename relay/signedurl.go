@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ============================================================================
+// Signed URLs
+// URL format: /{session-id}/s/{expiry}.{scope}.{signature}/path/to/file
+// The signature is an HMAC over the session ID, path scope and expiry, so a
+// signed URL grants access to that path (or directory) only.
+// ============================================================================
+
+// signedURLPrefix marks a signed URL within a session path
+const signedURLPrefix = "/s/"
+
+// signedCookiePrefix names the cookie that carries a signed scope to
+// follow-up requests (e.g. links in a signed directory listing)
+const signedCookiePrefix = "fwdcast_sig_"
+
+// Error types for signed URLs
+var (
+	ErrSignatureMalformed = errors.New("malformed signed URL")
+	ErrSignatureInvalid   = errors.New("invalid signature")
+	ErrSignatureExpired   = errors.New("signed URL expired")
+	ErrSignatureScope     = errors.New("path outside signed scope")
+)
+
+// SignedScope is a verified signed URL grant
+type SignedScope struct {
+	Token     string
+	Path      string // Path prefix the signature grants access to
+	ExpiresAt time.Time
+}
+
+// generateSigningKey creates a random HMAC key for signed URLs.
+// Sessions live in memory, so a per-process key is sufficient.
+func generateSigningKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("failed to generate URL signing key: %v", err))
+	}
+	return key
+}
+
+// SetSigningKey replaces the HMAC key used for signed URLs
+func (s *SessionStore) SetSigningKey(key []byte) {
+	s.signingKey = key
+}
+
+// signature computes the HMAC for a session, path scope and expiry
+func (s *SessionStore) signature(sessionID, scope string, expiresAt int64) []byte {
+	mac := hmac.New(sha256.New, s.signingKey)
+	fmt.Fprintf(mac, "%s\n%s\n%d", sessionID, scope, expiresAt)
+	return mac.Sum(nil)
+}
+
+// SignPath creates a signed URL token granting access to scope until expiresAt.
+// A zero expiresAt, or one past the session expiry, is capped to the session expiry.
+func (s *SessionStore) SignPath(sessionID, scope string, expiresAt time.Time) (*SignedScope, error) {
+	session := s.GetSession(sessionID)
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	scope = cleanResourcePath(scope)
+
+	session.mu.Lock()
+	if expiresAt.IsZero() || expiresAt.After(session.ExpiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+	session.mu.Unlock()
+
+	exp := expiresAt.Unix()
+	token := strconv.FormatInt(exp, 10) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(scope)) + "." +
+		base64.RawURLEncoding.EncodeToString(s.signature(sessionID, scope, exp))
+
+	return &SignedScope{
+		Token:     token,
+		Path:      scope,
+		ExpiresAt: time.Unix(exp, 0),
+	}, nil
+}
+
+// VerifySignedToken checks a signed URL token for a session and returns its scope
+func (s *SessionStore) VerifySignedToken(sessionID, token string) (*SignedScope, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrSignatureMalformed
+	}
+
+	exp, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrSignatureMalformed
+	}
+	scope, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrSignatureMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrSignatureMalformed
+	}
+
+	if !hmac.Equal(sig, s.signature(sessionID, string(scope), exp)) {
+		return nil, ErrSignatureInvalid
+	}
+	expiresAt := time.Unix(exp, 0)
+	if time.Now().After(expiresAt) {
+		return nil, ErrSignatureExpired
+	}
+
+	return &SignedScope{
+		Token:     token,
+		Path:      string(scope),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Allows reports whether resourcePath falls within the signed scope.
+// A scope ending in "/" covers everything below it; otherwise it covers the
+// exact path and, if it names a directory, everything below that.
+func (sc *SignedScope) Allows(resourcePath string) bool {
+	return scopeAllows(sc.Path, resourcePath)
+}
+
+// scopeAllows reports whether resourcePath falls within a path scope, as
+// described for SignedScope.Allows
+func scopeAllows(scope, resourcePath string) bool {
+	resourcePath = cleanResourcePath(resourcePath)
+	if resourcePath == scope || scope == "/" {
+		return true
+	}
+	dir := strings.TrimSuffix(scope, "/") + "/"
+	return strings.HasPrefix(resourcePath, dir) || resourcePath+"/" == dir
+}
+
+// GenerateSignedURL creates the public URL for a signed scope
+func (s *SessionStore) GenerateSignedURL(sessionID string, scope *SignedScope) string {
+	return s.GenerateURL(sessionID) + "s/" + scope.Token + scope.Path
+}
+
+// cleanResourcePath normalizes a path within a share, resolving "." and ".."
+// so they cannot escape a signed scope, and keeps a trailing slash
+func cleanResourcePath(p string) string {
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// parseSignedURLPath splits "/s/{token}/rest" into the token and "/rest"
+func parseSignedURLPath(resourcePath string) (token, rest string, ok bool) {
+	if !strings.HasPrefix(resourcePath, signedURLPrefix) {
+		return "", "", false
+	}
+	token, rest, _ = strings.Cut(strings.TrimPrefix(resourcePath, signedURLPrefix), "/")
+	if strings.Count(token, ".") != 2 {
+		return "", "", false
+	}
+	return token, "/" + rest, true
+}
+
+// setSignedCookie remembers a signed scope so follow-up requests within it
+// (e.g. links in a signed directory listing) are also allowed
+func setSignedCookie(w http.ResponseWriter, sessionID string, scope *SignedScope) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     signedCookiePrefix + sessionID,
+		Value:    scope.Token,
+		Path:     "/" + sessionID + strings.TrimSuffix(scope.Path, "/"),
+		Expires:  scope.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// signedCookieAllows reports whether the request carries a signed-scope cookie
+// covering resourcePath
+func (h *Handlers) signedCookieAllows(r *http.Request, sessionID, resourcePath string) bool {
+	cookie, err := r.Cookie(signedCookiePrefix + sessionID)
+	if err != nil {
+		return false
+	}
+	scope, err := h.store.VerifySignedToken(sessionID, cookie.Value)
+	return err == nil && scope.Allows(resourcePath)
+}
+
+// handleSignURLMessage issues a signed URL requested by the CLI
+func (h *Handlers) handleSignURLMessage(session *Session, msg *SignURLMessage) {
+	var expiresAt time.Time
+	if msg.ExpiresAt != 0 {
+		expiresAt = time.Unix(msg.ExpiresAt, 0)
+	}
+
+	// Answer either way, so the CLI isn't left waiting
+	var reply *SignedURLMessage
+	var scope *SignedScope
+	err := ErrExpiryInPast
+	if expiresAt.IsZero() || expiresAt.After(time.Now()) {
+		scope, err = h.store.SignPath(session.ID, msg.Path, expiresAt)
+	}
+	if err != nil {
+		session.logger().Warn("Failed to sign URL", "error", err)
+		reply = &SignedURLMessage{Type: TypeSignedURL, ID: msg.ID, Error: err.Error()}
+	} else {
+		url := h.store.GenerateSignedURL(session.ID, scope)
+		reply = NewSignedURLMessage(msg.ID, scope.Path, url, scope.ExpiresAt.Unix())
+	}
+
+	respBytes, err := SerializeMessage(reply)
+	if err != nil {
+		session.logger().Error("Failed to serialize signedUrl message", "error", err)
+		return
+	}
+
+	session.mu.Lock()
+	err = session.WebSocket.WriteMessage(websocket.TextMessage, respBytes)
+	session.mu.Unlock()
+	if err != nil {
+		session.logger().Warn("Failed to send signedUrl message", "error", err)
+	}
+}
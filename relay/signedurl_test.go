@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSignedScope_Allows checks path prefix matching for signed scopes
+func TestSignedScope_Allows(t *testing.T) {
+	cases := []struct {
+		scope, path string
+		want        bool
+	}{
+		{"/docs/report.pdf", "/docs/report.pdf", true},
+		{"/docs/report.pdf", "/docs/other.pdf", false},
+		{"/docs/", "/docs/", true},
+		{"/docs/", "/docs/a/b.txt", true},
+		{"/docs/", "/docs2/a.txt", false},
+		{"/docs", "/docs/a.txt", true},
+		{"/docs", "/docs/", true},
+		{"/docs", "/docsecret.txt", false},
+		{"/docs/", "/docs/../secret.txt", false},
+		{"/", "/anything", true},
+	}
+
+	for _, tc := range cases {
+		scope := &SignedScope{Path: cleanResourcePath(tc.scope)}
+		if got := scope.Allows(tc.path); got != tc.want {
+			t.Errorf("scope %q allows %q = %v, want %v", tc.scope, tc.path, got, tc.want)
+		}
+	}
+}
+
+// TestSignPath_RoundTrip checks that signatures verify only for the session they were issued for
+func TestSignPath_RoundTrip(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	session, _ := store.CreateSession(nil, time.Now().Add(30*time.Minute))
+	other, _ := store.CreateSession(nil, time.Now().Add(30*time.Minute))
+
+	scope, err := store.SignPath(session.ID, "/docs/", time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to sign path: %v", err)
+	}
+
+	verified, err := store.VerifySignedToken(session.ID, scope.Token)
+	if err != nil || verified.Path != "/docs/" {
+		t.Fatalf("Expected token to verify, got %+v, %v", verified, err)
+	}
+	if _, err := store.VerifySignedToken(other.ID, scope.Token); err != ErrSignatureInvalid {
+		t.Errorf("Expected ErrSignatureInvalid for another session, got %v", err)
+	}
+
+	// Tampering with the scope invalidates the signature
+	parts := strings.Split(scope.Token, ".")
+	forged := parts[0] + "." + "Lw" + "." + parts[2] // base64url("/")
+	if _, err := store.VerifySignedToken(session.ID, forged); err != ErrSignatureInvalid {
+		t.Errorf("Expected ErrSignatureInvalid for forged scope, got %v", err)
+	}
+
+	expired, _ := store.SignPath(session.ID, "/docs/", time.Now().Add(-time.Minute))
+	if _, err := store.VerifySignedToken(session.ID, expired.Token); err != ErrSignatureExpired {
+		t.Errorf("Expected ErrSignatureExpired, got %v", err)
+	}
+}
+
+// TestHandleViewerRequest_SignedScope checks that a signed URL outside its
+// scope is refused on a password-protected session
+func TestHandleViewerRequest_SignedScope(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	h := NewHandlers(store)
+	session, _ := store.CreateSessionWithPassword(nil, time.Now().Add(30*time.Minute), "secret")
+	scope, _ := store.SignPath(session.ID, "/docs/report.pdf", time.Time{})
+
+	w := httptest.NewRecorder()
+	h.HandleViewerRequest(w, httptest.NewRequest(http.MethodGet, "/"+session.ID+"/s/"+scope.Token+"/secret.txt", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+
+	// The signed cookie does not unlock paths outside the scope either
+	r := httptest.NewRequest(http.MethodGet, "/"+session.ID+"/secret.txt", nil)
+	r.AddCookie(&http.Cookie{Name: signedCookiePrefix + session.ID, Value: scope.Token})
+	w = httptest.NewRecorder()
+	h.HandleViewerRequest(w, r)
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected redirect to login, got %d", w.Code)
+	}
+}
+
+// TestHandleViewerRequest_SharePathUnderS checks that share paths that only
+// look like signed URLs, e.g. s/a.b.c, are served normally
+func TestHandleViewerRequest_SharePathUnderS(t *testing.T) {
+	relay := newTestRelay(t)
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+
+	served := make(chan *RequestMessage, 1)
+	go func() { served <- cli.serve("contents") }()
+	resp, err := http.Get(relay.server.URL + "/" + cli.sessionID + "/s/a.b.c")
+	if err != nil {
+		t.Fatalf("Viewer request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if req := <-served; req.Path != "/s/a.b.c" {
+		t.Errorf("Expected /s/a.b.c forwarded, got %s", req.Path)
+	}
+
+	// On a protected session such paths need the password, not a signature
+	store := NewSessionStore("localhost:8080")
+	h := NewHandlers(store)
+	session, _ := store.CreateSessionWithPassword(nil, time.Now().Add(30*time.Minute), "secret")
+	w := httptest.NewRecorder()
+	h.HandleViewerRequest(w, httptest.NewRequest(http.MethodGet, "/"+session.ID+"/s/jquery.min.js", nil))
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected redirect to login, got %d", w.Code)
+	}
+}
+
+// TestSignURLMessage_Replies checks the CLI gets a signedUrl answer whether
+// or not the URL could be signed
+func TestSignURLMessage_Replies(t *testing.T) {
+	relay := newTestRelay(t)
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+
+	cli.send(&SignURLMessage{Type: TypeSignURL, ID: "ok", Path: "/docs/"})
+	signed, ok := cli.read().(*SignedURLMessage)
+	if !ok || signed.ID != "ok" || signed.Error != "" || signed.URL == "" {
+		t.Errorf("Expected a signed URL, got %+v", signed)
+	}
+
+	cli.send(&SignURLMessage{Type: TypeSignURL, ID: "past", Path: "/docs/", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	refused, ok := cli.read().(*SignedURLMessage)
+	if !ok || refused.ID != "past" || refused.Error == "" || refused.URL != "" {
+		t.Errorf("Expected an error for an expiry in the past, got %+v", refused)
+	}
+}
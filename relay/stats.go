@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ============================================================================
+// Transfer Statistics for the CLI
+// The CLI can only see what it sends; the relay sees what viewers actually
+// receive. CLIs that register with stats get a periodic stats message with
+// delivered bytes, downloads in progress, queued requests, viewer counts and
+// failed transfers.
+// ============================================================================
+
+// StatsInterval is how often a stats message is sent, if anything changed
+const StatsInterval = 2 * time.Second
+
+// transferCounters counts the outcomes of a session's forwarded requests
+type transferCounters struct {
+	canceled atomic.Int64 // Viewer went away mid-transfer
+	timeouts atomic.Int64 // 504 responses
+	errors   atomic.Int64 // Other 5xx responses
+}
+
+// SessionStats is a point-in-time view of a session's transfers
+type SessionStats struct {
+	BytesDelivered  int64
+	ActiveDownloads int
+	Queued          int
+	Viewers         int
+	LiveViewers     int
+	Canceled        int64
+	Timeouts        int64
+	Errors          int64
+}
+
+// Stats returns the session's current transfer statistics
+func (s *Session) Stats() SessionStats {
+	stats := SessionStats{
+		BytesDelivered: s.BytesSent.Load(),
+		Canceled:       s.transfers.canceled.Load(),
+		Timeouts:       s.transfers.timeouts.Load(),
+		Errors:         s.transfers.errors.Load(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, req := range s.PendingReqs {
+		if req.streaming.Load() {
+			stats.ActiveDownloads++
+		} else {
+			stats.Queued++
+		}
+	}
+	stats.Viewers = s.ViewerCount
+	stats.LiveViewers = len(s.ViewerSockets)
+	return stats
+}
+
+// transferCanceled counts a response the viewer stopped reading, once per request
+func (s *Session) transferCanceled(req *PendingRequest) {
+	if req.canceled.CompareAndSwap(false, true) {
+		s.transfers.canceled.Add(1)
+	}
+}
+
+// subscribeTransferStats counts failed responses to forwarded requests
+func (s *SessionStore) subscribeTransferStats() {
+	Subscribe(s.events, func(e RequestFinishedEvent) {
+		if !e.Forwarded || e.Status < http.StatusInternalServerError {
+			return
+		}
+		session := s.GetSession(e.SessionID)
+		if session == nil {
+			return
+		}
+		if e.Status == http.StatusGatewayTimeout {
+			session.transfers.timeouts.Add(1)
+		} else {
+			session.transfers.errors.Add(1)
+		}
+	})
+}
+
+// reportStats sends stats messages to the CLI until the session ends
+func (h *Handlers) reportStats(session *Session) {
+	ticker := time.NewTicker(h.statsInterval)
+	defer ticker.Stop()
+
+	var last SessionStats
+	for range ticker.C {
+		if h.store.GetSession(session.ID) != session {
+			return
+		}
+
+		stats := session.Stats()
+		if stats == last {
+			continue
+		}
+		last = stats
+
+		msgBytes, err := SerializeMessage(NewStatsMessage(stats, time.Now()))
+		if err != nil {
+			return
+		}
+		session.mu.Lock()
+		err = session.WebSocket.WriteMessage(websocket.TextMessage, msgBytes)
+		session.mu.Unlock()
+		if err != nil {
+			session.logger().Debug("Failed to send stats", "error", err)
+			return
+		}
+	}
+}
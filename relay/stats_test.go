@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// readStatsUntil reads messages until a stats message satisfies done
+func (c *testCLI) readStatsUntil(done func(*StatsMessage) bool) {
+	c.t.Helper()
+	for {
+		if stats, ok := c.read().(*StatsMessage); ok && done(stats) {
+			return
+		}
+	}
+}
+
+// TestStats_Transfer checks the CLI sees a download in progress and the
+// bytes delivered
+func TestStats_Transfer(t *testing.T) {
+	relay := newTestRelay(t)
+	relay.handlers.statsInterval = 20 * time.Millisecond
+	register := NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix())
+	register.Stats = true
+	cli := relay.connectCLI(t, register)
+
+	done := make(chan string)
+	go func() {
+		resp, err := http.Get(relay.server.URL + "/" + cli.sessionID + "/file.txt")
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		done <- string(body)
+	}()
+
+	// Skip stats until the request arrives; it is queued until answered
+	var req *RequestMessage
+	for req == nil {
+		if msg, ok := cli.read().(*RequestMessage); ok {
+			req = msg
+		}
+	}
+	cli.readStatsUntil(func(s *StatsMessage) bool { return s.Queued == 1 && s.Viewers == 1 })
+
+	cli.send(NewResponseMessage(req.ID, http.StatusOK, map[string]string{"Content-Type": "text/plain"}))
+	cli.send(NewDataMessage(req.ID, base64.StdEncoding.EncodeToString([]byte("hello"))))
+	cli.readStatsUntil(func(s *StatsMessage) bool {
+		return s.ActiveDownloads == 1 && s.Queued == 0 && s.BytesDelivered == 5
+	})
+
+	cli.send(NewEndMessage(req.ID))
+	if body := <-done; body != "hello" {
+		t.Fatalf("Expected hello, got %q", body)
+	}
+	cli.readStatsUntil(func(s *StatsMessage) bool {
+		return s.ActiveDownloads == 0 && s.Viewers == 0 && s.BytesDelivered == 5
+	})
+}
+
+// TestStats_OptIn checks CLIs that didn't ask for stats don't get them
+func TestStats_OptIn(t *testing.T) {
+	relay := newTestRelay(t)
+	relay.handlers.statsInterval = 10 * time.Millisecond
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+
+	cli.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := cli.conn.ReadMessage(); err == nil {
+		t.Errorf("Expected no stats without opting in, got %s", data)
+	}
+}
+
+// TestStats_FailedTransfers checks 5xx responses and abandoned downloads are counted
+func TestStats_FailedTransfers(t *testing.T) {
+	store := NewSessionStore("localhost:8080")
+	session, _ := store.CreateSession(nil, time.Now().Add(time.Hour))
+
+	for _, status := range []int{http.StatusOK, http.StatusGatewayTimeout, http.StatusBadGateway, http.StatusGatewayTimeout} {
+		store.Events().Publish(RequestFinishedEvent{SessionID: session.ID, Forwarded: true, Status: status})
+	}
+	// Refused before reaching the CLI: not a transfer
+	store.Events().Publish(RequestFinishedEvent{SessionID: session.ID, Status: http.StatusServiceUnavailable})
+
+	req := &PendingRequest{ID: "req1"}
+	session.transferCanceled(req)
+	session.transferCanceled(req)
+
+	stats := session.Stats()
+	if stats.Timeouts != 2 || stats.Errors != 1 || stats.Canceled != 1 {
+		t.Errorf("Expected 2 timeouts, 1 error and 1 canceled, got %+v", stats)
+	}
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Tracing
+// OpenTelemetry-compatible spans for the viewer request → relay → CLI round
+// trip. Trace context is propagated with the W3C traceparent format (from the
+// viewer's request, and to the CLI in RequestMessage), and spans are exported
+// as OTLP/HTTP JSON or printed to stdout. Configured with the standard
+// OTEL_TRACES_EXPORTER, OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_SERVICE_NAME.
+// ============================================================================
+
+// Span kinds and status codes, as numbered in OTLP
+const (
+	SpanKindInternal = 1
+	SpanKindServer   = 2
+
+	spanStatusError = 2
+)
+
+// Batching for exported spans
+const (
+	traceBatchSize     = 512
+	traceFlushInterval = 5 * time.Second
+	traceQueueLimit    = 2048            // Spans beyond this are dropped if the exporter falls behind
+	traceCloseTimeout  = 5 * time.Second // How long shutdown waits for the last export
+)
+
+// SpanContext identifies a span within a trace
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+// IsValid reports whether the context has non-zero IDs
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent formats the context as a W3C traceparent header value
+func (sc SpanContext) TraceParent() string {
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-01"
+}
+
+// ParseTraceParent parses a W3C traceparent header value
+func ParseTraceParent(value string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	return sc, sc.IsValid()
+}
+
+// Span is a timed operation within a trace. A nil *Span is a no-op,
+// so callers needn't check whether tracing is enabled.
+type Span struct {
+	Context    SpanContext
+	Parent     [8]byte // Zero for a root span
+	Name       string
+	Kind       int
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Err        string // Error status message, if the operation failed
+
+	tracer *Tracer
+	ended  bool
+	mu     sync.Mutex
+}
+
+// SetAttribute records a string, int, int64 or bool attribute
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Err = err.Error()
+	s.mu.Unlock()
+}
+
+// Finish ends the span and queues it for export. Later calls are ignored.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+	s.tracer.enqueue(s)
+}
+
+// SpanContext returns the span's context, or a zero context for a nil span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.Context
+}
+
+// SpanExporter sends finished spans to a backend
+type SpanExporter interface {
+	Export(spans []*Span) error
+}
+
+// Tracer creates spans and batches them for export. A nil *Tracer
+// creates nil spans, which disables tracing at no cost.
+type Tracer struct {
+	exporter SpanExporter
+	queue    []*Span
+	mu       sync.Mutex
+	exportMu sync.Mutex // Serializes exports so batches stay in order
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewTracer creates a tracer exporting to exporter and starts its flush loop
+func NewTracer(exporter SpanExporter) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// run flushes queued spans every traceFlushInterval, and once more on Close
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.Flush()
+		case <-t.stop:
+			t.Flush()
+			return
+		}
+	}
+}
+
+// Close stops the flush loop after exporting the spans still queued, or
+// when ctx is done
+func (t *Tracer) Close(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.once.Do(func() { close(t.stop) })
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TracerFromEnv creates the tracer selected by OTEL_TRACES_EXPORTER:
+// "otlp" (to OTEL_EXPORTER_OTLP_ENDPOINT), "console" (stdout) or "none".
+// Returns nil if tracing is disabled.
+func TracerFromEnv() (*Tracer, error) {
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "fwdcast-relay"
+	}
+
+	switch exporter := strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER")); exporter {
+	case "", "none":
+		return nil, nil
+	case "console", "stdout":
+		return NewTracer(&StdoutExporter{Out: os.Stdout}), nil
+	case "otlp":
+		endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "http://localhost:4318"
+		}
+		return NewTracer(NewOTLPExporter(endpoint, service)), nil
+	default:
+		return nil, fmt.Errorf("invalid OTEL_TRACES_EXPORTER %q (want otlp, console or none)", exporter)
+	}
+}
+
+// StartSpan starts a span. A parent with a valid context continues its trace;
+// otherwise a new trace is started.
+func (t *Tracer) StartSpan(name string, kind int, parent SpanContext) *Span {
+	if t == nil {
+		return nil
+	}
+	span := &Span{
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: make(map[string]interface{}),
+		tracer:     t,
+	}
+	if parent.IsValid() {
+		span.Context.TraceID = parent.TraceID
+		span.Parent = parent.SpanID
+	} else {
+		rand.Read(span.Context.TraceID[:])
+	}
+	rand.Read(span.Context.SpanID[:])
+	return span
+}
+
+// enqueue adds a finished span to the export queue
+func (t *Tracer) enqueue(span *Span) {
+	t.mu.Lock()
+	if len(t.queue) >= traceQueueLimit {
+		t.mu.Unlock()
+		return
+	}
+	t.queue = append(t.queue, span)
+	full := len(t.queue) >= traceBatchSize
+	t.mu.Unlock()
+
+	if full {
+		go t.Flush()
+	}
+}
+
+// Flush exports all queued spans
+func (t *Tracer) Flush() {
+	if t == nil {
+		return
+	}
+	t.exportMu.Lock()
+	defer t.exportMu.Unlock()
+
+	t.mu.Lock()
+	spans := t.queue
+	t.queue = nil
+	t.mu.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+	if err := t.exporter.Export(spans); err != nil {
+		slog.Warn("Failed to export trace spans", "spans", len(spans), "error", err)
+	}
+}
+
+// SetTracer enables tracing of viewer requests
+func (h *Handlers) SetTracer(tracer *Tracer) {
+	h.tracer = tracer
+}
+
+// ============================================================================
+// Viewer Request Traces
+// ============================================================================
+
+// requestTrace holds the spans of one viewer request's round trip through the
+// CLI. Its methods are called from both the viewer's and the CLI's goroutines.
+type requestTrace struct {
+	root   *Span // HandleViewerRequest
+	wait   *Span // Request forwarded until the CLI's first ResponseMessage
+	stream *Span // First ResponseMessage until the end of the stream
+	mu     sync.Mutex
+}
+
+// awaitResponse starts the span covering the CLI's handling of the request
+// and returns its traceparent for the CLI to continue the trace
+func (rt *requestTrace) awaitResponse() string {
+	if rt == nil || rt.root == nil {
+		return ""
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.wait = rt.root.tracer.StartSpan("first response", SpanKindInternal, rt.root.Context)
+	return rt.wait.Context.TraceParent()
+}
+
+// responseStarted ends the wait span and starts the stream span
+func (rt *requestTrace) responseStarted(status int) {
+	if rt == nil || rt.root == nil {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.wait.Finish()
+	rt.stream = rt.root.tracer.StartSpan("stream response", SpanKindInternal, rt.root.Context)
+	rt.stream.SetAttribute("http.response.status_code", status)
+}
+
+// finish ends any open spans, marking them failed if err is set
+func (rt *requestTrace) finish(err error) {
+	if rt == nil || rt.root == nil {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	for _, span := range []*Span{rt.wait, rt.stream} {
+		span.SetError(err)
+		span.Finish()
+	}
+}
+
+// ============================================================================
+// Exporters
+// ============================================================================
+
+// StdoutExporter writes one OTLP JSON span per line, for local testing
+type StdoutExporter struct {
+	Out io.Writer
+}
+
+// Export writes spans to the output
+func (e *StdoutExporter) Export(spans []*Span) error {
+	enc := json.NewEncoder(e.Out)
+	for _, span := range spans {
+		if err := enc.Encode(otlpSpanFrom(span)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OTLPExporter posts spans to an OTLP/HTTP collector using the JSON encoding
+type OTLPExporter struct {
+	URL     string
+	Service string
+	Client  *http.Client
+}
+
+// NewOTLPExporter creates an exporter for a collector's base URL
+// (e.g. http://localhost:4318)
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+	return &OTLPExporter{
+		URL:     strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		Service: service,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Export posts spans to the collector
+func (e *OTLPExporter) Export(spans []*Span) error {
+	req := otlpTraceRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{otlpAttribute("service.name", e.Service)}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "fwdcast-relay"},
+		}},
+	}}}
+	scope := &req.ResourceSpans[0].ScopeSpans[0]
+	for _, span := range spans {
+		scope.Spans = append(scope.Spans, otlpSpanFrom(span))
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := e.Client.Post(e.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// OTLP JSON encoding (IDs are hex, times are decimal strings of nanoseconds)
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+// otlpAttribute encodes an attribute value
+func otlpAttribute(key string, value interface{}) otlpKeyValue {
+	var v otlpAnyValue
+	switch value := value.(type) {
+	case bool:
+		v.BoolValue = &value
+	case int:
+		s := strconv.Itoa(value)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return otlpKeyValue{Key: key, Value: v}
+}
+
+// otlpSpanFrom encodes a finished span
+func otlpSpanFrom(span *Span) otlpSpan {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	out := otlpSpan{
+		TraceID:           hex.EncodeToString(span.Context.TraceID[:]),
+		SpanID:            hex.EncodeToString(span.Context.SpanID[:]),
+		Name:              span.Name,
+		Kind:              span.Kind,
+		StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+	}
+	if span.Parent != [8]byte{} {
+		out.ParentSpanID = hex.EncodeToString(span.Parent[:])
+	}
+	keys := make([]string, 0, len(span.Attributes))
+	for key := range span.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		out.Attributes = append(out.Attributes, otlpAttribute(key, span.Attributes[key]))
+	}
+	if span.Err != "" {
+		out.Status = &otlpStatus{Code: spanStatusError, Message: span.Err}
+	}
+	return out
+}
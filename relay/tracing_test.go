@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingExporter keeps exported spans for inspection
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *recordingExporter) Export(spans []*Span) error {
+	e.mu.Lock()
+	e.spans = append(e.spans, spans...)
+	e.mu.Unlock()
+	return nil
+}
+
+// byName returns exported spans by name
+func (e *recordingExporter) byName() map[string]*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	spans := make(map[string]*Span)
+	for _, span := range e.spans {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+// TestParseTraceParent checks W3C traceparent parsing
+func TestParseTraceParent(t *testing.T) {
+	sc, ok := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok {
+		t.Fatal("Expected valid traceparent")
+	}
+	if sc.TraceParent() != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("Round trip gave %q", sc.TraceParent())
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-zzzzzzzzzzzzzzzz-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceParent(bad); ok {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+// TestTracing_ViewerRoundTrip checks the spans of a request served by the CLI,
+// and that the CLI receives trace context continuing the viewer's trace
+func TestTracing_ViewerRoundTrip(t *testing.T) {
+	relay := newTestRelay(t)
+	exporter := &recordingExporter{}
+	tracer := NewTracer(exporter)
+	relay.handlers.SetTracer(tracer)
+	cli := relay.connectCLI(t, NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix()))
+
+	done := make(chan *RequestMessage)
+	go func() { done <- cli.serve("hello") }()
+
+	req, _ := http.NewRequest(http.MethodGet, relay.server.URL+"/"+cli.sessionID+"/hello.txt", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Viewer request failed: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	forwarded := <-done
+
+	// The handler's deferred span ends just after the response completes
+	var spans map[string]*Span
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		tracer.Flush()
+		if spans = exporter.byName(); len(spans) == 4 {
+			break
+		}
+	}
+
+	root := spans["HandleViewerRequest"]
+	if root == nil {
+		t.Fatalf("Expected root span, got %v", spans)
+	}
+	if got := root.SpanContext().TraceParent(); got[3:35] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected root span to continue the viewer's trace, got %s", got)
+	}
+	for _, name := range []string{"forward request", "first response", "stream response"} {
+		span := spans[name]
+		if span == nil {
+			t.Errorf("Expected %q span", name)
+			continue
+		}
+		if span.Parent != root.Context.SpanID || span.Context.TraceID != root.Context.TraceID {
+			t.Errorf("Expected %q to be a child of the request span", name)
+		}
+	}
+	if wait := spans["first response"]; wait != nil && forwarded.TraceParent != wait.Context.TraceParent() {
+		t.Errorf("Expected CLI to receive the first response span's context, got %q", forwarded.TraceParent)
+	}
+}
+
+// TestTracing_Disabled checks a nil tracer is a no-op
+func TestTracing_Disabled(t *testing.T) {
+	var tracer *Tracer
+	span := tracer.StartSpan("noop", SpanKindInternal, SpanContext{})
+	span.SetAttribute("key", "value")
+	span.SetError(errors.New("ignored"))
+	span.Finish()
+	tracer.Flush()
+	if err := tracer.Close(context.Background()); err != nil {
+		t.Errorf("Expected closing a nil tracer to succeed: %v", err)
+	}
+
+	rt := &requestTrace{root: span}
+	if rt.awaitResponse() != "" {
+		t.Error("Expected no trace context when tracing is disabled")
+	}
+	rt.responseStarted(http.StatusOK)
+	rt.finish(nil)
+}
+
+// TestTracer_Close checks closing exports the spans still queued
+func TestTracer_Close(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := NewTracer(exporter)
+	tracer.StartSpan("last", SpanKindInternal, SpanContext{}).Finish()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tracer.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if exporter.byName()["last"] == nil {
+		t.Error("Expected the queued span to be exported on close")
+	}
+	if err := tracer.Close(ctx); err != nil {
+		t.Errorf("Expected a second Close to succeed: %v", err)
+	}
+}
+
+// TestOTLPExporter checks spans are posted in the OTLP JSON encoding
+func TestOTLPExporter(t *testing.T) {
+	var body []byte
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+
+	tracer := &Tracer{exporter: NewOTLPExporter(collector.URL, "fwdcast-test")}
+	span := tracer.StartSpan("HandleViewerRequest", SpanKindServer, SpanContext{})
+	span.SetAttribute("http.response.status_code", 504)
+	span.SetError(ErrRequestTimeout)
+	span.Finish()
+	tracer.Flush()
+
+	var req otlpTraceRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("Invalid OTLP body %q: %v", body, err)
+	}
+	got := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if got.Name != "HandleViewerRequest" || got.Kind != SpanKindServer || got.Status == nil || got.Status.Code != spanStatusError {
+		t.Errorf("Unexpected span: %+v", got)
+	}
+	if !bytes.Contains(body, []byte(`"intValue":"504"`)) || !bytes.Contains(body, []byte(`"stringValue":"fwdcast-test"`)) {
+		t.Errorf("Expected typed attributes in %s", body)
+	}
+}
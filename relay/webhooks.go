@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================================
+// Session Lifecycle Webhooks
+// Events are queued without blocking the caller and POSTed as JSON by a
+// single worker, in order. Each delivery is signed with HMAC-SHA256 over
+// "{timestamp}.{body}" so receivers can verify it came from this relay and
+// reject replays. Failed deliveries are retried with exponential backoff;
+// when the queue is full, new events are dropped rather than slowing the
+// relay down.
+// ============================================================================
+
+// Webhook event types
+const (
+	WebhookSessionCreated = "session.created"
+	WebhookSessionViewed  = "session.viewed"       // First viewer request served
+	WebhookViewerLimit    = "session.viewer_limit" // A viewer was turned away by the viewer limit
+	WebhookAuthFailed     = "session.auth_failed"  // Repeated wrong passwords locked the session out
+	WebhookSessionExpired = "session.expired"
+)
+
+// webhookEventTypes lists the valid event types, for WEBHOOK_EVENTS
+var webhookEventTypes = []string{
+	WebhookSessionCreated,
+	WebhookSessionViewed,
+	WebhookViewerLimit,
+	WebhookAuthFailed,
+	WebhookSessionExpired,
+}
+
+// Webhook defaults
+const (
+	DefaultWebhookQueueSize   = 1000
+	DefaultWebhookMaxAttempts = 5
+	WebhookFlushTimeout       = 5 * time.Second // How long shutdown waits for queued events
+	webhookTimeout            = 10 * time.Second
+	webhookMaxBackoff         = time.Minute
+
+	// webhookRepeatInterval limits how often a noisy event (viewer limit)
+	// is sent for one session
+	webhookRepeatInterval = time.Minute
+)
+
+// Webhook request headers
+const (
+	WebhookSignatureHeader = "X-Fwdcast-Signature" // sha256=<hex HMAC of "{timestamp}.{body}">
+	WebhookTimestampHeader = "X-Fwdcast-Timestamp" // Unix seconds
+	WebhookEventHeader     = "X-Fwdcast-Event"
+	WebhookDeliveryHeader  = "X-Fwdcast-Delivery" // Event ID, stable across retries
+)
+
+// WebhookConfig configures webhook delivery
+type WebhookConfig struct {
+	URL         string
+	Secret      string
+	Events      map[string]bool // Event types to send (nil for all)
+	QueueSize   int
+	MaxAttempts int
+}
+
+// WebhookConfigFromEnv reads WEBHOOK_URL, WEBHOOK_SECRET, WEBHOOK_EVENTS,
+// WEBHOOK_QUEUE_SIZE and WEBHOOK_MAX_ATTEMPTS.
+// Returns nil if WEBHOOK_URL is unset (webhooks disabled).
+func WebhookConfigFromEnv() (*WebhookConfig, error) {
+	rawURL := os.Getenv("WEBHOOK_URL")
+	if rawURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid WEBHOOK_URL %q", rawURL)
+	}
+
+	secret := os.Getenv("WEBHOOK_SECRET")
+	if len(secret) < 16 {
+		return nil, errors.New("WEBHOOK_SECRET must be at least 16 characters")
+	}
+
+	config := &WebhookConfig{URL: rawURL, Secret: secret}
+	if events := os.Getenv("WEBHOOK_EVENTS"); events != "" {
+		config.Events = make(map[string]bool)
+		for _, event := range strings.Split(events, ",") {
+			event = strings.TrimSpace(event)
+			if !isWebhookEventType(event) {
+				return nil, fmt.Errorf("unknown webhook event %q (want %s)", event, strings.Join(webhookEventTypes, ", "))
+			}
+			config.Events[event] = true
+		}
+	}
+
+	queueSize, err := envUint("WEBHOOK_QUEUE_SIZE", DefaultWebhookQueueSize, 32)
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := envUint("WEBHOOK_MAX_ATTEMPTS", DefaultWebhookMaxAttempts, 8)
+	if err != nil {
+		return nil, err
+	}
+	if queueSize == 0 || attempts == 0 {
+		return nil, errors.New("WEBHOOK_QUEUE_SIZE and WEBHOOK_MAX_ATTEMPTS must be at least 1")
+	}
+	config.QueueSize = int(queueSize)
+	config.MaxAttempts = int(attempts)
+	return config, nil
+}
+
+// isWebhookEventType reports whether event is a known event type
+func isWebhookEventType(event string) bool {
+	for _, t := range webhookEventTypes {
+		if t == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEvent is the JSON body of a webhook delivery
+type WebhookEvent struct {
+	ID      string                 `json:"id"`
+	Type    string                 `json:"type"`
+	Time    time.Time              `json:"time"`
+	Session *WebhookSession        `json:"session"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// WebhookSession identifies the session an event is about
+type WebhookSession struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	APIKey string `json:"apiKey,omitempty"`
+}
+
+// WebhookDispatcher queues and delivers webhook events
+type WebhookDispatcher struct {
+	config  WebhookConfig
+	client  *http.Client
+	queue   chan *WebhookEvent
+	backoff time.Duration // Delay before the first retry, doubling after each
+	dropped atomic.Uint64 // Events discarded because the queue was full
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewWebhookDispatcher creates a dispatcher and starts its delivery worker
+func NewWebhookDispatcher(config WebhookConfig) *WebhookDispatcher {
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultWebhookQueueSize
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultWebhookMaxAttempts
+	}
+	d := &WebhookDispatcher{
+		config:  config,
+		client:  &http.Client{Timeout: webhookTimeout},
+		queue:   make(chan *WebhookEvent, config.QueueSize),
+		backoff: time.Second,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// Emit queues an event without blocking. Safe to call on a nil dispatcher.
+func (d *WebhookDispatcher) Emit(eventType string, session *WebhookSession, data map[string]interface{}) {
+	if d == nil || (d.config.Events != nil && !d.config.Events[eventType]) {
+		return
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	event := &WebhookEvent{
+		ID:      "evt_" + hex.EncodeToString(id),
+		Type:    eventType,
+		Time:    time.Now().UTC(),
+		Session: session,
+		Data:    data,
+	}
+
+	select {
+	case d.queue <- event:
+	default:
+		d.dropped.Add(1)
+		slog.Warn("Webhook queue full, dropping event", "event", eventType, "session_id", session.ID)
+	}
+}
+
+// Dropped returns how many events were discarded because the queue was full
+func (d *WebhookDispatcher) Dropped() uint64 {
+	return d.dropped.Load()
+}
+
+// Close stops the worker after one last attempt at each queued event, or
+// when ctx is done
+func (d *WebhookDispatcher) Close(ctx context.Context) error {
+	d.once.Do(func() { close(d.stop) })
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run delivers queued events until Close
+func (d *WebhookDispatcher) run() {
+	defer close(d.done)
+	for {
+		select {
+		case event := <-d.queue:
+			d.deliver(event)
+		case <-d.stop:
+			for {
+				select {
+				case event := <-d.queue:
+					d.send(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver sends an event, retrying with backoff until it succeeds, fails
+// permanently, runs out of attempts or the dispatcher is closed
+func (d *WebhookDispatcher) deliver(event *WebhookEvent) {
+	delay := d.backoff
+	for attempt := 1; ; attempt++ {
+		err := d.send(event)
+		if err == nil {
+			return
+		}
+
+		var permanent *permanentWebhookError
+		if errors.As(err, &permanent) || attempt >= d.config.MaxAttempts {
+			slog.Warn("Webhook delivery failed", "event", event.Type, "delivery", event.ID,
+				"session_id", event.Session.ID, "attempts", attempt, "error", err)
+			return
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-d.stop:
+			return
+		}
+		delay = min(delay*2, webhookMaxBackoff)
+	}
+}
+
+// permanentWebhookError is a rejection that retrying won't fix
+type permanentWebhookError struct {
+	status int
+}
+
+func (e *permanentWebhookError) Error() string {
+	return fmt.Sprintf("webhook rejected with status %d", e.status)
+}
+
+// send makes one delivery attempt
+func (d *WebhookDispatcher) send(event *WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return &permanentWebhookError{}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, d.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "fwdcast-relay")
+	req.Header.Set(WebhookEventHeader, event.Type)
+	req.Header.Set(WebhookDeliveryHeader, event.ID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(d.config.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	default:
+		return &permanentWebhookError{status: resp.StatusCode}
+	}
+}
+
+// SignWebhook computes the signature header value for a delivery
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SetWebhooks sends webhooks for session lifecycle events
+func (s *SessionStore) SetWebhooks(d *WebhookDispatcher) {
+	s.events.SubscribeAll(func(e Event) {
+		switch e := e.(type) {
+		case SessionRegisteredEvent:
+			// Sent once registration is complete, so the API key is known
+			s.emitWebhook(d, WebhookSessionCreated, e.Session, map[string]interface{}{
+				"expiresAt":         e.Session.expiry().UTC(),
+				"passwordProtected": len(e.Session.PasswordHash) > 0,
+			})
+		case RequestStartedEvent:
+			if e.Session.markViewed() {
+				s.emitWebhook(d, WebhookSessionViewed, e.Session, nil)
+			}
+		case ViewerLimitEvent:
+			if e.Session.limitReportDue() {
+				s.emitWebhook(d, WebhookViewerLimit, e.Session, map[string]interface{}{"maxViewers": e.Session.MaxViewers})
+			}
+		case AuthFailedEvent:
+			if e.Attempts == MaxFailedAttempts {
+				s.emitWebhook(d, WebhookAuthFailed, e.Session, map[string]interface{}{
+					"attempts":       e.Attempts,
+					"clientIp":       e.RemoteIP,
+					"lockoutSeconds": int(AuthLockoutDuration.Seconds()),
+				})
+			}
+		case SessionExpiredEvent:
+			s.emitWebhook(d, WebhookSessionExpired, e.Session, map[string]interface{}{
+				"durationSeconds": int(time.Since(e.Session.CreatedAt).Seconds()),
+				"bytesSent":       e.Session.BytesSent.Load(),
+			})
+		}
+	})
+}
+
+// emitWebhook queues a webhook event about a session
+func (s *SessionStore) emitWebhook(d *WebhookDispatcher, eventType string, session *Session, data map[string]interface{}) {
+	info := &WebhookSession{ID: session.ID, URL: s.GenerateURL(session.ID)}
+	session.mu.Lock()
+	if session.APIKey != nil {
+		info.APIKey = session.APIKey.Name
+	}
+	session.mu.Unlock()
+	d.Emit(eventType, info, data)
+}
+
+// markViewed records that the session has served a viewer request,
+// reporting whether this is the first
+func (s *Session) markViewed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first := !s.viewed
+	s.viewed = true
+	return first
+}
+
+// limitReportDue reports whether a viewer limit webhook should be sent,
+// at most once per webhookRepeatInterval
+func (s *Session) limitReportDue() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.lastLimitEvent) < webhookRepeatInterval {
+		return false
+	}
+	s.lastLimitEvent = time.Now()
+	return true
+}
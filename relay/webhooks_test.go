@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "test-webhook-secret-0123"
+
+// webhookReceiver is a local stand-in for a webhook endpoint
+type webhookReceiver struct {
+	server   *httptest.Server
+	events   chan *WebhookEvent
+	requests atomic.Int32
+	status   func(n int32) int // Response status for the nth request
+}
+
+func newWebhookReceiver(t *testing.T, status func(n int32) int) *webhookReceiver {
+	rcv := &webhookReceiver{events: make(chan *WebhookEvent, 100), status: status}
+	rcv.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := rcv.requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get(WebhookSignatureHeader); got != SignWebhook(testWebhookSecret, r.Header.Get(WebhookTimestampHeader), body) {
+			t.Errorf("Bad signature %q", got)
+		}
+		if code := rcv.status(n); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		var event WebhookEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("Invalid event body: %v", err)
+		}
+		if r.Header.Get(WebhookEventHeader) != event.Type || r.Header.Get(WebhookDeliveryHeader) != event.ID {
+			t.Errorf("Headers don't match event %+v", event)
+		}
+		rcv.events <- &event
+	}))
+	t.Cleanup(rcv.server.Close)
+	return rcv
+}
+
+// next waits for the next delivered event
+func (rcv *webhookReceiver) next(t *testing.T) *WebhookEvent {
+	t.Helper()
+	select {
+	case event := <-rcv.events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for webhook")
+		return nil
+	}
+}
+
+func newTestDispatcher(t *testing.T, rcv *webhookReceiver, events map[string]bool) *WebhookDispatcher {
+	d := NewWebhookDispatcher(WebhookConfig{URL: rcv.server.URL, Secret: testWebhookSecret, Events: events, MaxAttempts: 3})
+	d.backoff = 10 * time.Millisecond
+	t.Cleanup(func() { d.Close(context.Background()) })
+	return d
+}
+
+func alwaysOK(int32) int { return http.StatusOK }
+
+// TestWebhookConfigFromEnv checks webhook configuration validation
+func TestWebhookConfigFromEnv(t *testing.T) {
+	if config, err := WebhookConfigFromEnv(); config != nil || err != nil {
+		t.Fatalf("Expected webhooks disabled by default, got %v, %v", config, err)
+	}
+
+	t.Setenv("WEBHOOK_URL", "https://hooks.example.com/fwdcast")
+	if _, err := WebhookConfigFromEnv(); err == nil {
+		t.Error("Expected error without WEBHOOK_SECRET")
+	}
+
+	t.Setenv("WEBHOOK_SECRET", testWebhookSecret)
+	t.Setenv("WEBHOOK_EVENTS", "session.created, session.expired")
+	config, err := WebhookConfigFromEnv()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(config.Events) != 2 || !config.Events[WebhookSessionExpired] || config.QueueSize != DefaultWebhookQueueSize {
+		t.Errorf("Unexpected config: %+v", config)
+	}
+
+	t.Setenv("WEBHOOK_EVENTS", "session.deleted")
+	if _, err := WebhookConfigFromEnv(); err == nil {
+		t.Error("Expected error for unknown event type")
+	}
+
+	t.Setenv("WEBHOOK_EVENTS", "")
+	t.Setenv("WEBHOOK_URL", "ftp://hooks.example.com/")
+	if _, err := WebhookConfigFromEnv(); err == nil {
+		t.Error("Expected error for non-HTTP URL")
+	}
+}
+
+// TestWebhookDispatcher_RetriesWithBackoff checks transient failures are retried
+func TestWebhookDispatcher_RetriesWithBackoff(t *testing.T) {
+	rcv := newWebhookReceiver(t, func(n int32) int {
+		if n < 3 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	d := newTestDispatcher(t, rcv, nil)
+
+	d.Emit(WebhookSessionCreated, &WebhookSession{ID: "a1b2c3d4e5f6"}, nil)
+	if event := rcv.next(t); event.Type != WebhookSessionCreated || event.Session.ID != "a1b2c3d4e5f6" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if n := rcv.requests.Load(); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+}
+
+// TestWebhookDispatcher_PermanentFailure checks client errors aren't retried
+func TestWebhookDispatcher_PermanentFailure(t *testing.T) {
+	rcv := newWebhookReceiver(t, func(n int32) int {
+		if n == 1 {
+			return http.StatusBadRequest
+		}
+		return http.StatusOK
+	})
+	d := newTestDispatcher(t, rcv, nil)
+
+	d.Emit(WebhookSessionCreated, &WebhookSession{ID: "first"}, nil)
+	d.Emit(WebhookSessionExpired, &WebhookSession{ID: "second"}, nil)
+	if event := rcv.next(t); event.Session.ID != "second" {
+		t.Errorf("Expected the rejected event to be dropped, got %+v", event)
+	}
+	if n := rcv.requests.Load(); n != 2 {
+		t.Errorf("Expected 2 requests, got %d", n)
+	}
+}
+
+// TestWebhookDispatcher_FiltersAndDrops checks event filtering and the bounded queue
+func TestWebhookDispatcher_FiltersAndDrops(t *testing.T) {
+	release := make(chan struct{})
+	blocked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer blocked.Close()
+
+	d := NewWebhookDispatcher(WebhookConfig{
+		URL:       blocked.URL,
+		Secret:    testWebhookSecret,
+		Events:    map[string]bool{WebhookSessionCreated: true},
+		QueueSize: 2,
+	})
+	defer d.Close(context.Background())
+	defer close(release)
+
+	// The worker takes one event and blocks; two more fill the queue
+	for i := 0; i < 5; i++ {
+		d.Emit(WebhookSessionCreated, &WebhookSession{ID: "s"}, nil)
+		d.Emit(WebhookSessionExpired, &WebhookSession{ID: "s"}, nil) // Filtered out
+		time.Sleep(10 * time.Millisecond)
+	}
+	if dropped := d.Dropped(); dropped != 2 {
+		t.Errorf("Expected 2 dropped events, got %d", dropped)
+	}
+}
+
+// TestWebhooks_SessionLifecycle checks the store emits lifecycle events
+func TestWebhooks_SessionLifecycle(t *testing.T) {
+	rcv := newWebhookReceiver(t, alwaysOK)
+	store := NewSessionStore("localhost:8080")
+	store.SetWebhooks(newTestDispatcher(t, rcv, nil))
+	h := NewHandlers(store)
+
+	session, _ := store.CreateSessionWithPassword(nil, time.Now().Add(time.Hour), "hunter2")
+	store.Events().Publish(SessionRegisteredEvent{Session: session})
+	event := rcv.next(t)
+	if event.Type != WebhookSessionCreated || event.Session.URL != store.GenerateURL(session.ID) || event.Data["passwordProtected"] != true {
+		t.Errorf("Unexpected created event %+v", event)
+	}
+
+	// Only the first view is reported
+	store.Events().Publish(RequestStartedEvent{Session: session, RequestID: "1"})
+	store.Events().Publish(RequestStartedEvent{Session: session, RequestID: "2"})
+	if event := rcv.next(t); event.Type != WebhookSessionViewed {
+		t.Errorf("Expected viewed event, got %s", event.Type)
+	}
+
+	// Hitting the limit repeatedly is reported once
+	for i := 0; i < 5; i++ {
+		store.IncrementViewers(session.ID)
+	}
+	if event := rcv.next(t); event.Type != WebhookViewerLimit || event.Data["maxViewers"] != float64(3) {
+		t.Errorf("Unexpected limit event %+v", event)
+	}
+
+	// A lockout is reported once the failures reach the limit
+	r := httptest.NewRequest(http.MethodPost, "/"+session.ID+"/__auth__", nil)
+	for i := 0; i < MaxFailedAttempts; i++ {
+		h.authFailed(r, session, AuthMethodPassword)
+	}
+	if event := rcv.next(t); event.Type != WebhookAuthFailed || event.Data["clientIp"] != "192.0.2.1" {
+		t.Errorf("Unexpected auth event %+v", event)
+	}
+
+	store.ExpireSession(session.ID)
+	if event := rcv.next(t); event.Type != WebhookSessionExpired {
+		t.Errorf("Expected expired event, got %s", event.Type)
+	}
+
+	select {
+	case event := <-rcv.events:
+		t.Errorf("Unexpected extra event %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestWebhooks_CreatedCarriesAPIKey checks session.created names the API key
+// the CLI registered with
+func TestWebhooks_CreatedCarriesAPIKey(t *testing.T) {
+	rcv := newWebhookReceiver(t, alwaysOK)
+	relay := newTestRelay(t)
+	relay.store.SetWebhooks(newTestDispatcher(t, rcv, nil))
+	keys, err := LoadAPIKeyStore(writeKeyStore(t, `{"keys": [{"name": "ci", "key": "ci-secret"}]}`))
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	relay.handlers.SetAPIKeyStore(keys)
+
+	register := NewRegisterMessage("/tmp/share", time.Now().Add(time.Hour).Unix())
+	register.APIKey = "ci-secret"
+	cli := relay.connectCLI(t, register)
+
+	event := rcv.next(t)
+	if event.Type != WebhookSessionCreated || event.Session.ID != cli.sessionID || event.Session.APIKey != "ci" {
+		t.Errorf("Unexpected created event %+v", event)
+	}
+}